@@ -0,0 +1,224 @@
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Roles a token can have, each allowed what the ones before it are.
+const (
+	// ReadOnly lists and inspects tasks, services, nodes and the like
+	ReadOnly = "read-only"
+	// Submitter also runs, stops and changes tasks, services, cron jobs
+	// and workflows
+	Submitter = "submitter"
+	// Admin also backs up, exports and imports the manager's state
+	Admin = "admin"
+)
+
+var ranks = map[string]int{ReadOnly: 1, Submitter: 2, Admin: 3}
+
+func ValidRole(role string) bool {
+	return ranks[role] > 0
+}
+
+// Allows reports whether role may do what needs the required role.
+func Allows(role string, required string) bool {
+	return ranks[role] > 0 && ranks[role] >= ranks[required]
+}
+
+var (
+	ErrNoToken      = errors.New("[auth] no token")
+	ErrInvalidToken = errors.New("[auth] invalid token")
+	ErrExpiredToken = errors.New("[auth] expired token")
+)
+
+// Identity is who a token was given to, and what they may do.
+type Identity struct {
+	Name string `yaml:"name" json:"n"`
+	Role string `yaml:"role" json:"r"`
+	// Namespaces limits the token to the tasks of these namespaces, all
+	// namespaces if empty
+	Namespaces []string `yaml:"namespaces" json:"ns,omitempty"`
+}
+
+// InNamespace reports whether id may see and change the tasks of namespace.
+func (id Identity) InNamespace(namespace string) bool {
+	return len(id.Namespaces) == 0 || slices.Contains(id.Namespaces, namespace)
+}
+
+// Token is an entry of a tokens file.
+type Token struct {
+	Identity `yaml:",inline"`
+	Token    string `yaml:"token"`
+}
+
+// Authenticator checks the tokens of API requests: the static ones listed in
+// a tokens file, and the ones signed with a secret by Sign.
+type Authenticator struct {
+	tokens []Token
+	secret []byte
+}
+
+// Load reads the tokens file and the secret file, either of which may be
+// empty to not accept that kind of token.
+func Load(tokensFile string, secretFile string) (*Authenticator, error) {
+	a := &Authenticator{}
+
+	if tokensFile != "" {
+		data, err := os.ReadFile(tokensFile)
+		if err != nil {
+			return nil, fmt.Errorf("[auth] unable to read %s: %v", tokensFile, err)
+		}
+		var f struct {
+			Tokens []Token `yaml:"tokens"`
+		}
+		err = yaml.Unmarshal(data, &f)
+		if err != nil {
+			return nil, fmt.Errorf("[auth] unable to parse %s: %v", tokensFile, err)
+		}
+		for i, t := range f.Tokens {
+			if t.Name == "" || t.Token == "" || !ValidRole(t.Role) {
+				return nil, fmt.Errorf("[auth] token %d in %s needs a name, a token and a role of %s, %s or %s", i+1, tokensFile, ReadOnly, Submitter, Admin)
+			}
+		}
+		a.tokens = f.Tokens
+	}
+
+	if secretFile != "" {
+		secret, err := LoadSecret(secretFile)
+		if err != nil {
+			return nil, err
+		}
+		a.secret = secret
+	}
+
+	return a, nil
+}
+
+// LoadSecret reads the secret tokens are signed with.
+func LoadSecret(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("[auth] unable to read %s: %v", path, err)
+	}
+	secret := []byte(strings.TrimSpace(string(data)))
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("[auth] the secret in %s must be at least 32 characters", path)
+	}
+	return secret, nil
+}
+
+// Authenticate returns the identity token was given to.
+func (a *Authenticator) Authenticate(token string) (Identity, error) {
+	if token == "" {
+		return Identity{}, ErrNoToken
+	}
+
+	for _, t := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(t.Token), []byte(token)) == 1 {
+			return t.Identity, nil
+		}
+	}
+
+	if a.secret != nil && strings.HasPrefix(token, signedPrefix) {
+		return verify(a.secret, token)
+	}
+
+	return Identity{}, ErrInvalidToken
+}
+
+// signedPrefix starts signed tokens, which are followed by their claims and
+// the signature of the claims, both base64 encoded.
+const signedPrefix = "kst1."
+
+type claims struct {
+	Identity
+	Expires int64 `json:"e,omitempty"`
+}
+
+// Sign returns a token for id signed with secret, which expires after ttl,
+// or never if ttl is 0.
+func Sign(secret []byte, id Identity, ttl time.Duration) (string, error) {
+	if id.Name == "" || !ValidRole(id.Role) {
+		return "", fmt.Errorf("[auth] a token needs a name and a role of %s, %s or %s", ReadOnly, Submitter, Admin)
+	}
+
+	c := claims{Identity: id}
+	if ttl > 0 {
+		c.Expires = time.Now().Add(ttl).Unix()
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("[auth] unable to encode token: %v", err)
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return signedPrefix + payload + "." + signature(secret, payload), nil
+}
+
+func verify(secret []byte, token string) (Identity, error) {
+	payload, sig, ok := strings.Cut(strings.TrimPrefix(token, signedPrefix), ".")
+	if !ok || !hmac.Equal([]byte(sig), []byte(signature(secret, payload))) {
+		return Identity{}, ErrInvalidToken
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return Identity{}, ErrInvalidToken
+	}
+	var c claims
+	err = json.Unmarshal(data, &c)
+	if err != nil || !ValidRole(c.Role) {
+		return Identity{}, ErrInvalidToken
+	}
+	if c.Expires != 0 && time.Now().Unix() >= c.Expires {
+		return Identity{}, ErrExpiredToken
+	}
+
+	return c.Identity, nil
+}
+
+func signature(secret []byte, payload string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Header is the header requests carry their token in, as "Bearer <token>".
+const Header = "Authorization"
+
+// FromRequest returns the token r carries, if any.
+func FromRequest(r *http.Request) string {
+	token, ok := strings.CutPrefix(r.Header.Get(Header), "Bearer ")
+	if !ok {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+type contextKey struct{}
+
+// WithIdentity returns a copy of ctx carrying id.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the identity of the request ctx belongs to, if any.
+func FromContext(ctx context.Context) (Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(Identity)
+	return id, ok
+}
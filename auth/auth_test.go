@@ -0,0 +1,186 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var secret = []byte("0123456789abcdef0123456789abcdef")
+
+// signed returns a token for c signed with key, bypassing the checks of Sign.
+func signed(key []byte, c claims) string {
+	data, _ := json.Marshal(c)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return signedPrefix + payload + "." + signature(key, payload)
+}
+
+func TestAuthenticate(t *testing.T) {
+	a := &Authenticator{
+		tokens: []Token{{Identity: Identity{Name: "ci", Role: Submitter}, Token: "static-token"}},
+		secret: secret,
+	}
+	alice := Identity{Name: "alice", Role: ReadOnly, Namespaces: []string{"team-a"}}
+
+	valid, err := Sign(secret, alice, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forever, err := Sign(secret, alice, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, sig, _ := strings.Cut(strings.TrimPrefix(valid, signedPrefix), ".")
+
+	tests := []struct {
+		name  string
+		token string
+		id    Identity
+		err   error
+	}{
+		{"static token", "static-token", Identity{Name: "ci", Role: Submitter}, nil},
+		{"signed token", valid, alice, nil},
+		{"signed token without expiry", forever, alice, nil},
+		{"no token", "", Identity{}, ErrNoToken},
+		{"unknown static token", "static-tokem", Identity{}, ErrInvalidToken},
+		{"expired", signed(secret, claims{Identity: alice, Expires: time.Now().Add(-time.Minute).Unix()}), Identity{}, ErrExpiredToken},
+		{"signed with another secret", signed([]byte("another secret, just as long as it"), claims{Identity: alice}), Identity{}, ErrInvalidToken},
+		{"claims changed", signedPrefix + base64.RawURLEncoding.EncodeToString([]byte(`{"n":"alice","r":"admin"}`)) + "." + sig, Identity{}, ErrInvalidToken},
+		{"signature changed", signedPrefix + payload + "." + strings.ToUpper(sig), Identity{}, ErrInvalidToken},
+		{"no signature", signedPrefix + payload, Identity{}, ErrInvalidToken},
+		{"payload not base64", signedPrefix + "!!!." + signature(secret, "!!!"), Identity{}, ErrInvalidToken},
+		{"payload not json", signedPrefix + "bm9wZQ." + signature(secret, "bm9wZQ"), Identity{}, ErrInvalidToken},
+		{"unknown role", signed(secret, claims{Identity: Identity{Name: "mallory", Role: "root"}}), Identity{}, ErrInvalidToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, err := a.Authenticate(tt.token)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("error %v, want %v", err, tt.err)
+			}
+			if id.Name != tt.id.Name || id.Role != tt.id.Role || strings.Join(id.Namespaces, ",") != strings.Join(tt.id.Namespaces, ",") {
+				t.Fatalf("identity %+v, want %+v", id, tt.id)
+			}
+		})
+	}
+}
+
+func TestSignedTokensNeedASecret(t *testing.T) {
+	token, err := Sign(secret, Identity{Name: "alice", Role: Admin}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a := &Authenticator{}
+	if _, err := a.Authenticate(token); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("a manager without a secret accepted a signed token: %v", err)
+	}
+}
+
+func TestSignRejectsIncompleteIdentities(t *testing.T) {
+	for _, id := range []Identity{{Role: Admin}, {Name: "alice"}, {Name: "alice", Role: "root"}} {
+		if _, err := Sign(secret, id, 0); err == nil {
+			t.Fatalf("signed a token for %+v", id)
+		}
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		role     string
+		required string
+		allowed  bool
+	}{
+		{ReadOnly, ReadOnly, true},
+		{ReadOnly, Submitter, false},
+		{ReadOnly, Admin, false},
+		{Submitter, ReadOnly, true},
+		{Submitter, Submitter, true},
+		{Submitter, Admin, false},
+		{Admin, ReadOnly, true},
+		{Admin, Admin, true},
+		{"", ReadOnly, false},
+		{"root", ReadOnly, false},
+	}
+
+	for _, tt := range tests {
+		if got := Allows(tt.role, tt.required); got != tt.allowed {
+			t.Errorf("Allows(%q, %q) = %v, want %v", tt.role, tt.required, got, tt.allowed)
+		}
+	}
+}
+
+func TestFromRequest(t *testing.T) {
+	tests := []struct {
+		header string
+		token  string
+	}{
+		{"Bearer abc", "abc"},
+		{"Bearer  abc ", "abc"},
+		{"", ""},
+		{"Basic abc", ""},
+		{"abc", ""},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		if tt.header != "" {
+			r.Header.Set(Header, tt.header)
+		}
+		if got := FromRequest(r); got != tt.token {
+			t.Errorf("%q: token %q, want %q", tt.header, got, tt.token)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name string, data string) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, []byte(data), 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	tests := []struct {
+		name   string
+		tokens string
+		secret string
+		ok     bool
+	}{
+		{"tokens and secret", "tokens:\n  - {name: ci, role: submitter, token: t1}\n", string(secret) + "\n", true},
+		{"no files", "", "", true},
+		{"token without a role", "tokens:\n  - {name: ci, token: t1}\n", "", false},
+		{"token with an unknown role", "tokens:\n  - {name: ci, role: root, token: t1}\n", "", false},
+		{"token without a name", "tokens:\n  - {role: admin, token: t1}\n", "", false},
+		{"short secret", "", "too short", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokens, secretFile string
+			if tt.tokens != "" {
+				tokens = write("tokens.yaml", tt.tokens)
+			}
+			if tt.secret != "" {
+				secretFile = write("secret", tt.secret)
+			}
+
+			_, err := Load(tokens, secretFile)
+			if tt.ok && err != nil {
+				t.Fatalf("rejected: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("accepted")
+			}
+		})
+	}
+}
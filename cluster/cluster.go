@@ -0,0 +1,327 @@
+package cluster
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/raft"
+	raftboltdb "github.com/hashicorp/raft-boltdb"
+)
+
+// ErrNoLeader is returned when the cluster has no leader to take a write.
+var ErrNoLeader = errors.New("[cluster] no leader")
+
+const (
+	applyTimeout     = 10 * time.Second
+	retainSnapshots  = 2
+	transportTimeout = 10 * time.Second
+)
+
+// Config describes this member of a cluster. The Transport and store fields
+// are optional; by default the member talks TCP on Bind and keeps its Raft
+// log and snapshots in Dir. Tests can set them to the in-memory versions to
+// run several members in one process.
+type Config struct {
+	// ID names this member; the manager uses its API address so members
+	// can find the leader's API
+	ID string
+	// Bind is the address the Raft transport listens on
+	Bind string
+	// Peers maps the ID of every member, this one included, to its Raft
+	// address. It is used to bootstrap a new cluster and ignored once the
+	// cluster has state.
+	Peers map[string]string
+	Dir   string
+	// TLS secures the Raft traffic between members if set
+	TLS *tls.Config
+
+	Transport raft.Transport
+	Logs      raft.LogStore
+	Stable    raft.StableStore
+	Snapshots raft.SnapshotStore
+}
+
+// Cluster replicates the stores registered with it through a Raft group.
+// Every member serves reads from its own copy; writes are applied through
+// the leader's log.
+type Cluster struct {
+	ID     string
+	Raft   *raft.Raft
+	stores map[string]replica
+	leader chan bool
+	closer []io.Closer
+	mu     sync.Mutex
+}
+
+// New creates a cluster member. Register its stores before calling Start.
+func New() *Cluster {
+	return &Cluster{
+		stores: make(map[string]replica),
+		leader: make(chan bool, 1),
+	}
+}
+
+// Start joins or bootstraps the Raft group described by cfg.
+func (c *Cluster) Start(cfg Config) error {
+	c.ID = cfg.ID
+
+	rc := raft.DefaultConfig()
+	rc.LocalID = raft.ServerID(cfg.ID)
+	rc.NotifyCh = c.leader
+	rc.LogOutput = log.Writer()
+	rc.LogLevel = "WARN"
+
+	err := c.openStorage(&cfg)
+	if err != nil {
+		c.closeStorage()
+		return err
+	}
+
+	r, err := raft.NewRaft(rc, (*fsm)(c), cfg.Logs, cfg.Stable, cfg.Snapshots, cfg.Transport)
+	if err != nil {
+		c.closeStorage()
+		return fmt.Errorf("[cluster] unable to start raft: %v", err)
+	}
+	c.Raft = r
+
+	existing, err := raft.HasExistingState(cfg.Logs, cfg.Stable, cfg.Snapshots)
+	if err != nil {
+		return fmt.Errorf("[cluster] unable to read raft state: %v", err)
+	}
+	if existing {
+		return nil
+	}
+
+	var servers []raft.Server
+	for id, addr := range cfg.Peers {
+		servers = append(servers, raft.Server{ID: raft.ServerID(id), Address: raft.ServerAddress(addr)})
+	}
+	if len(servers) == 0 {
+		servers = []raft.Server{{ID: rc.LocalID, Address: cfg.Transport.LocalAddr()}}
+	}
+
+	err = r.BootstrapCluster(raft.Configuration{Servers: servers}).Error()
+	if err != nil && !errors.Is(err, raft.ErrCantBootstrap) {
+		return fmt.Errorf("[cluster] unable to bootstrap: %v", err)
+	}
+	log.Printf("[cluster] bootstrapped cluster of %d members\n", len(servers))
+	return nil
+}
+
+func (c *Cluster) openStorage(cfg *Config) error {
+	if cfg.Dir != "" {
+		err := os.MkdirAll(cfg.Dir, 0700)
+		if err != nil {
+			return fmt.Errorf("[cluster] unable to create %s: %v", cfg.Dir, err)
+		}
+	}
+
+	if cfg.Logs == nil || cfg.Stable == nil {
+		file := filepath.Join(cfg.Dir, "raft.db")
+		db, err := raftboltdb.NewBoltStore(file)
+		if err != nil {
+			return fmt.Errorf("[cluster] unable to open %s: %v", file, err)
+		}
+		c.closer = append(c.closer, db)
+		if cfg.Logs == nil {
+			cfg.Logs = db
+		}
+		if cfg.Stable == nil {
+			cfg.Stable = db
+		}
+	}
+
+	if cfg.Snapshots == nil {
+		s, err := raft.NewFileSnapshotStore(cfg.Dir, retainSnapshots, log.Writer())
+		if err != nil {
+			return fmt.Errorf("[cluster] unable to open snapshots in %s: %v", cfg.Dir, err)
+		}
+		cfg.Snapshots = s
+	}
+
+	if cfg.Transport == nil {
+		// the other members reach this one on the address the peers list
+		// for it, which matters when Bind is a wildcard address
+		var advertise net.Addr
+		if addr, ok := cfg.Peers[cfg.ID]; ok {
+			a, err := net.ResolveTCPAddr("tcp", addr)
+			if err != nil {
+				return fmt.Errorf("[cluster] invalid raft address %s: %v", addr, err)
+			}
+			advertise = a
+		}
+
+		if cfg.TLS != nil {
+			stream, err := newTLSStream(cfg.Bind, advertise, cfg.TLS)
+			if err != nil {
+				return fmt.Errorf("[cluster] unable to listen on %s: %v", cfg.Bind, err)
+			}
+			t := raft.NewNetworkTransport(stream, 3, transportTimeout, log.Writer())
+			c.closer = append(c.closer, t)
+			cfg.Transport = t
+		} else {
+			t, err := raft.NewTCPTransport(cfg.Bind, advertise, 3, transportTimeout, log.Writer())
+			if err != nil {
+				return fmt.Errorf("[cluster] unable to listen on %s: %v", cfg.Bind, err)
+			}
+			c.closer = append(c.closer, t)
+			cfg.Transport = t
+		}
+	}
+
+	return nil
+}
+
+func (c *Cluster) closeStorage() {
+	for _, cl := range c.closer {
+		cl.Close()
+	}
+	c.closer = nil
+}
+
+// IsLeader reports whether this member currently leads the cluster.
+func (c *Cluster) IsLeader() bool {
+	return c.Raft != nil && c.Raft.State() == raft.Leader
+}
+
+// Leader returns the ID of the current leader, empty if there is none.
+func (c *Cluster) Leader() string {
+	if c.Raft == nil {
+		return ""
+	}
+	_, id := c.Raft.LeaderWithID()
+	return string(id)
+}
+
+// Member is one member of the cluster as the Raft configuration lists it.
+type Member struct {
+	ID      string
+	Address string
+	Leader  bool
+}
+
+// Status describes the cluster as this member sees it.
+type Status struct {
+	ID      string
+	State   string
+	Leader  string
+	Members []Member
+}
+
+func (c *Cluster) Status() (Status, error) {
+	s := Status{ID: c.ID, State: c.Raft.State().String(), Leader: c.Leader()}
+
+	future := c.Raft.GetConfiguration()
+	err := future.Error()
+	if err != nil {
+		return s, fmt.Errorf("[cluster] unable to get configuration: %v", err)
+	}
+
+	for _, srv := range future.Configuration().Servers {
+		s.Members = append(s.Members, Member{
+			ID:      string(srv.ID),
+			Address: string(srv.Address),
+			Leader:  string(srv.ID) == s.Leader,
+		})
+	}
+	return s, nil
+}
+
+// RunLeader calls lead every time this member becomes the leader and
+// cancels the context it passed as soon as leadership is lost. It returns
+// once ctx is cancelled and lead has returned.
+func (c *Cluster) RunLeader(ctx context.Context, lead func(ctx context.Context)) {
+	var cancel context.CancelFunc
+	var done chan struct{}
+
+	stop := func() {
+		if cancel == nil {
+			return
+		}
+		cancel()
+		<-done
+		cancel = nil
+	}
+	defer stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case isLeader := <-c.leader:
+			if isLeader && cancel == nil {
+				log.Printf("[cluster] %s is now the leader\n", c.ID)
+				var leadCtx context.Context
+				leadCtx, cancel = context.WithCancel(ctx)
+				done = make(chan struct{})
+				go func() {
+					defer close(done)
+					lead(leadCtx)
+				}()
+			}
+			if !isLeader && cancel != nil {
+				log.Printf("[cluster] %s lost leadership\n", c.ID)
+				stop()
+			}
+		}
+	}
+}
+
+// Shutdown leaves the Raft group and closes the Raft storage. The
+// registered stores are left for their owner to close.
+func (c *Cluster) Shutdown() error {
+	if c.Raft == nil {
+		return nil
+	}
+	err := c.Raft.Shutdown().Error()
+	c.closeStorage()
+	return err
+}
+
+// command is one write to a replicated store, as kept in the Raft log.
+type command struct {
+	Store string
+	Op    string
+	Key   string
+	Value json.RawMessage `json:",omitempty"`
+}
+
+const (
+	opPut    = "put"
+	opDelete = "delete"
+)
+
+func (c *Cluster) apply(cmd command) error {
+	if c.Raft == nil {
+		return fmt.Errorf("[cluster] %s is not started", c.ID)
+	}
+
+	data, err := json.Marshal(cmd)
+	if err != nil {
+		return fmt.Errorf("[cluster] unable to encode %s of %s %s: %v", cmd.Op, cmd.Store, cmd.Key, err)
+	}
+
+	future := c.Raft.Apply(data, applyTimeout)
+	err = future.Error()
+	if errors.Is(err, raft.ErrNotLeader) || errors.Is(err, raft.ErrLeadershipLost) {
+		return fmt.Errorf("%w: %s of %s %s: %v", ErrNoLeader, cmd.Op, cmd.Store, cmd.Key, err)
+	}
+	if err != nil {
+		return fmt.Errorf("[cluster] unable to apply %s of %s %s: %v", cmd.Op, cmd.Store, cmd.Key, err)
+	}
+
+	if err, ok := future.Response().(error); ok {
+		return err
+	}
+	return nil
+}
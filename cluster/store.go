@@ -0,0 +1,210 @@
+package cluster
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+
+	"github.com/hashicorp/raft"
+	"github.com/surajsharma/kanastar/store"
+)
+
+// replica is the local copy of a replicated store, as the FSM sees it.
+type replica interface {
+	put(key string, data []byte) error
+	delete(key string) error
+	dump() (map[string]json.RawMessage, error)
+	clear() error
+}
+
+// Store is a store.Store whose writes go through the cluster's Raft log
+// before they reach the local store; reads are served by the local store
+// directly and may trail the leader by the writes not yet applied here.
+type Store[T any] struct {
+	c     *Cluster
+	name  string
+	local store.Store[T]
+	key   func(*T) string
+}
+
+// Register replicates local as the store name. key returns the key a value
+// is stored under, which a snapshot needs to restore the store.
+func Register[T any](c *Cluster, name string, local store.Store[T], key func(*T) string) *Store[T] {
+	s := &Store[T]{c: c, name: name, local: local, key: key}
+
+	c.mu.Lock()
+	c.stores[name] = s
+	c.mu.Unlock()
+
+	return s
+}
+
+func (s *Store[T]) Put(key string, value *T) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("[cluster] unable to encode %s %s: %v", s.name, key, err)
+	}
+	return s.c.apply(command{Store: s.name, Op: opPut, Key: key, Value: buf})
+}
+
+func (s *Store[T]) Get(key string) (*T, error) {
+	return s.local.Get(key)
+}
+
+func (s *Store[T]) Delete(key string) error {
+	return s.c.apply(command{Store: s.name, Op: opDelete, Key: key})
+}
+
+func (s *Store[T]) List(q store.Query[T]) (store.Page[T], error) {
+	return s.local.List(q)
+}
+
+func (s *Store[T]) Count() (int, error) {
+	return s.local.Count()
+}
+
+func (s *Store[T]) Close() error {
+	return s.local.Close()
+}
+
+func (s *Store[T]) put(key string, data []byte) error {
+	var v T
+	err := json.Unmarshal(data, &v)
+	if err != nil {
+		return fmt.Errorf("[cluster] unable to decode %s %s: %v", s.name, key, err)
+	}
+	return s.local.Put(key, &v)
+}
+
+func (s *Store[T]) delete(key string) error {
+	return s.local.Delete(key)
+}
+
+func (s *Store[T]) dump() (map[string]json.RawMessage, error) {
+	values, err := store.All(s.local)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make(map[string]json.RawMessage, len(values))
+	for _, v := range values {
+		buf, err := json.Marshal(v)
+		if err != nil {
+			return nil, fmt.Errorf("[cluster] unable to encode %s: %v", s.name, err)
+		}
+		out[s.key(v)] = buf
+	}
+	return out, nil
+}
+
+func (s *Store[T]) clear() error {
+	values, err := store.All(s.local)
+	if err != nil {
+		return err
+	}
+	for _, v := range values {
+		err := s.local.Delete(s.key(v))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fsm applies the Raft log to the registered stores.
+type fsm Cluster
+
+func (f *fsm) replica(name string) (replica, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	r, ok := f.stores[name]
+	return r, ok
+}
+
+// Apply returns the error of the write, if any, as the response of the
+// Raft future so the member that made the write sees it.
+func (f *fsm) Apply(l *raft.Log) interface{} {
+	var cmd command
+	err := json.Unmarshal(l.Data, &cmd)
+	if err != nil {
+		log.Printf("[cluster] skipping undecodable log entry %d: %v\n", l.Index, err)
+		return fmt.Errorf("[cluster] unable to decode log entry %d: %v", l.Index, err)
+	}
+
+	r, ok := f.replica(cmd.Store)
+	if !ok {
+		log.Printf("[cluster] skipping log entry %d for unknown store %s\n", l.Index, cmd.Store)
+		return fmt.Errorf("[cluster] unknown store %s", cmd.Store)
+	}
+
+	switch cmd.Op {
+	case opPut:
+		return r.put(cmd.Key, cmd.Value)
+	case opDelete:
+		return r.delete(cmd.Key)
+	default:
+		return fmt.Errorf("[cluster] unknown operation %s on %s", cmd.Op, cmd.Store)
+	}
+}
+
+// Snapshot copies every store. Raft does not call Apply while it runs, so
+// the copy is consistent with the log index it is taken at.
+func (f *fsm) Snapshot() (raft.FSMSnapshot, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := snapshot{}
+	for name, r := range f.stores {
+		values, err := r.dump()
+		if err != nil {
+			return nil, fmt.Errorf("[cluster] unable to snapshot %s: %v", name, err)
+		}
+		s[name] = values
+	}
+	return s, nil
+}
+
+// Restore replaces the content of every store with that of the snapshot.
+func (f *fsm) Restore(rc io.ReadCloser) error {
+	defer rc.Close()
+
+	var s snapshot
+	err := json.NewDecoder(rc).Decode(&s)
+	if err != nil {
+		return fmt.Errorf("[cluster] unable to decode snapshot: %v", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name, r := range f.stores {
+		err := r.clear()
+		if err != nil {
+			return fmt.Errorf("[cluster] unable to clear %s: %v", name, err)
+		}
+		for key, data := range s[name] {
+			err := r.put(key, data)
+			if err != nil {
+				return fmt.Errorf("[cluster] unable to restore %s %s: %v", name, key, err)
+			}
+		}
+	}
+
+	log.Printf("[cluster] restored %d stores from snapshot\n", len(s))
+	return nil
+}
+
+// snapshot holds the values of every store by key.
+type snapshot map[string]map[string]json.RawMessage
+
+func (s snapshot) Persist(sink raft.SnapshotSink) error {
+	err := json.NewEncoder(sink).Encode(s)
+	if err != nil {
+		sink.Cancel()
+		return fmt.Errorf("[cluster] unable to write snapshot: %v", err)
+	}
+	return sink.Close()
+}
+
+func (s snapshot) Release() {}
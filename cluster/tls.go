@@ -0,0 +1,36 @@
+package cluster
+
+import (
+	"crypto/tls"
+	"net"
+	"time"
+
+	"github.com/hashicorp/raft"
+)
+
+// tlsStream carries the Raft traffic between members over mutual TLS.
+type tlsStream struct {
+	net.Listener
+	advertise net.Addr
+	config    *tls.Config
+}
+
+func newTLSStream(bind string, advertise net.Addr, config *tls.Config) (*tlsStream, error) {
+	l, err := tls.Listen("tcp", bind, config)
+	if err != nil {
+		return nil, err
+	}
+	if advertise == nil {
+		advertise = l.Addr()
+	}
+	return &tlsStream{Listener: l, advertise: advertise, config: config}, nil
+}
+
+func (s *tlsStream) Dial(address raft.ServerAddress, timeout time.Duration) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	return tls.DialWithDialer(dialer, "tcp", string(address), s.config)
+}
+
+func (s *tlsStream) Addr() net.Addr {
+	return s.advertise
+}
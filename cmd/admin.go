@@ -0,0 +1,204 @@
+package cmd
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/datadir"
+	"github.com/surajsharma/kanastar/manager"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(adminCmd)
+
+	adminCmd.AddCommand(adminBackupCmd)
+	adminBackupCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	adminBackupCmd.Flags().StringP("output", "o", "", "File to write the backup to (default kanastar-backup-<time>.zip)")
+
+	adminCmd.AddCommand(adminRestoreCmd)
+	adminRestoreCmd.Flags().StringP("filename", "f", "", "Backup file to restore")
+	adminRestoreCmd.Flags().String("data-dir", ".", "Directory the manager keeps its database files in")
+	adminRestoreCmd.MarkFlagRequired("filename")
+
+	adminCmd.AddCommand(adminExportCmd)
+	adminExportCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	adminExportCmd.Flags().StringP("output", "o", "-", "File to write the export to, - for stdout")
+
+	adminCmd.AddCommand(adminImportCmd)
+	adminImportCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	adminImportCmd.Flags().StringP("filename", "f", "", "Export file to import")
+	adminImportCmd.MarkFlagRequired("filename")
+}
+
+var adminCmd = &cobra.Command{
+	Use:   "admin",
+	Short: "Back up, restore, export and import manager state, and create certificates and tokens.",
+	Long: `Kanastar admin command.
+
+	backup and restore copy the database files of a manager running with
+	--dbType persistent. export and import move its state as JSON, which works
+	with any store type, e.g. to go from memory to persistent stores or to
+	rebuild a manager on a new VM.`,
+}
+
+var adminBackupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Take a consistent backup of a running manager.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		output, _ := cmd.Flags().GetString("output")
+
+		url := fmt.Sprintf("%s://%s/admin/backup", utils.Scheme, mgr)
+		resp, err := utils.HTTP.Get(url)
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("[cmd] error taking backup: %v", decodeErrResponse(resp))
+		}
+
+		if output == "" {
+			_, params, _ := strings.Cut(resp.Header.Get("Content-Disposition"), "filename=")
+			output = strings.Trim(params, `"`)
+		}
+
+		f, err := os.OpenFile(output, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err != nil {
+			log.Fatalf("[cmd] unable to create %s: %v", output, err)
+		}
+
+		n, err := io.Copy(f, resp.Body)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(output)
+			log.Fatalf("[cmd] error writing backup to %s: %v", output, err)
+		}
+
+		log.Printf("[cmd] wrote backup of %s to %s (%d bytes)", mgr, output, n)
+	},
+}
+
+var adminRestoreCmd = &cobra.Command{
+	Use:   "restore",
+	Short: "Restore a backup into a manager's data directory.",
+	Long: `Restore the database files from a backup taken with "kanactl admin backup".
+
+	The manager must be stopped; start it again with --dbType persistent
+	and the same --data-dir once the restore finished.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		filename, _ := cmd.Flags().GetString("filename")
+		path, _ := cmd.Flags().GetString("data-dir")
+
+		// held like a running manager does, so neither can start while
+		// the database files are replaced
+		dd, err := datadir.Open(path, "manager")
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+		defer dd.Close()
+		dir := dd.Path
+
+		z, err := zip.OpenReader(filename)
+		if err != nil {
+			log.Fatalf("[cmd] unable to open backup %s: %v", filename, err)
+		}
+		defer z.Close()
+
+		for _, f := range z.File {
+			name, ok := strings.CutSuffix(f.Name, ".db")
+			if !ok || !slices.Contains(manager.StoreNames, name) {
+				log.Printf("[cmd] skipping unexpected file %s in backup", f.Name)
+				continue
+			}
+
+			r, err := f.Open()
+			if err != nil {
+				log.Fatalf("[cmd] unable to read %s from backup: %v", f.Name, err)
+			}
+
+			err = store.RestoreBoltFile(filepath.Join(dir, f.Name), 0600, r)
+			r.Close()
+			if err != nil {
+				log.Fatalf("[cmd] unable to restore %s: %v", f.Name, err)
+			}
+			log.Printf("[cmd] restored %s", filepath.Join(dir, f.Name))
+		}
+	},
+}
+
+var adminExportCmd = &cobra.Command{
+	Use:   "export",
+	Short: "Export the state of a manager as JSON.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		output, _ := cmd.Flags().GetString("output")
+
+		url := fmt.Sprintf("%s://%s/admin/export", utils.Scheme, mgr)
+		resp, err := utils.HTTP.Get(url)
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("[cmd] error exporting state: %v", decodeErrResponse(resp))
+		}
+
+		out := os.Stdout
+		if output != "-" {
+			out, err = os.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+			if err != nil {
+				log.Fatalf("[cmd] unable to create %s: %v", output, err)
+			}
+			defer out.Close()
+		}
+
+		_, err = io.Copy(out, resp.Body)
+		if err != nil {
+			log.Fatalf("[cmd] error writing export: %v", err)
+		}
+	},
+}
+
+var adminImportCmd = &cobra.Command{
+	Use:   "import",
+	Short: "Import state exported from a manager.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+
+		data := readSpecFile(filename)
+
+		url := fmt.Sprintf("%s://%s/admin/import", utils.Scheme, mgr)
+		resp, err := utils.HTTP.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusNoContent {
+			log.Fatalf("[cmd] error importing state: %v", decodeErrResponse(resp))
+		}
+
+		log.Printf("[cmd] imported %s into %s", filename, mgr)
+	},
+}
@@ -0,0 +1,132 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/pki"
+)
+
+func init() {
+	adminCmd.AddCommand(adminCertsCmd)
+
+	adminCertsCmd.AddCommand(certsInitCmd)
+	certsInitCmd.Flags().StringP("output", "o", "certs", "Directory to write ca.pem and ca-key.pem to")
+	certsInitCmd.Flags().String("name", "kanastar-ca", "Common name of the CA")
+	certsInitCmd.Flags().Duration("validity", 10*365*24*time.Hour, "How long the CA is valid for")
+
+	adminCertsCmd.AddCommand(certsIssueCmd)
+	certsIssueCmd.Flags().StringP("output", "o", "certs", "Directory to write <name>.pem and <name>-key.pem to")
+	certsIssueCmd.Flags().String("ca", "", "CA certificate to sign with (default <output>/ca.pem)")
+	certsIssueCmd.Flags().String("ca-key", "", "Key of the CA (default <output>/ca-key.pem)")
+	certsIssueCmd.Flags().StringSlice("hosts", nil, "List (csv) of host names and IP addresses the node's API is reached on")
+	certsIssueCmd.Flags().Bool("client", false, "Issue a client certificate, for kanactl, instead of a node certificate")
+	certsIssueCmd.Flags().Duration("validity", 365*24*time.Hour, "How long the certificate is valid for")
+}
+
+var adminCertsCmd = &cobra.Command{
+	Use:   "certs",
+	Short: "Create a cluster CA and the certificates signed by it.",
+	Long: `Kanastar admin certs command.
+
+	With TLS on, the manager, the workers and kanactl only talk to each other
+	with certificates signed by the cluster CA. init creates the CA, and issue
+	signs a node certificate for each manager and worker, which serves its API
+	and authenticates it to the others, or a client certificate for kanactl.`,
+}
+
+var certsInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the cluster CA.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		name, _ := cmd.Flags().GetString("name")
+		validity, _ := cmd.Flags().GetDuration("validity")
+
+		ca, err := pki.NewCA(name, validity)
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+		certPEM, keyPEM, err := ca.PEM()
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+
+		writePair(output, "ca", certPEM, keyPEM)
+	},
+}
+
+var certsIssueCmd = &cobra.Command{
+	Use:   "issue <name>",
+	Short: "Sign a node or client certificate with the cluster CA.",
+	Args:  cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		output, _ := cmd.Flags().GetString("output")
+		caFile, _ := cmd.Flags().GetString("ca")
+		caKeyFile, _ := cmd.Flags().GetString("ca-key")
+		hosts, _ := cmd.Flags().GetStringSlice("hosts")
+		client, _ := cmd.Flags().GetBool("client")
+		validity, _ := cmd.Flags().GetDuration("validity")
+
+		if caFile == "" {
+			caFile = filepath.Join(output, "ca.pem")
+		}
+		if caKeyFile == "" {
+			caKeyFile = filepath.Join(output, "ca-key.pem")
+		}
+
+		kind := pki.Node
+		if client {
+			kind = pki.Client
+		} else if len(hosts) == 0 {
+			log.Fatalf("[cmd] a node certificate needs the --hosts its API is reached on")
+		}
+
+		ca, err := pki.LoadCA(caFile, caKeyFile)
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+		certPEM, keyPEM, err := ca.Issue(args[0], kind, hosts, validity)
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+
+		writePair(output, args[0], certPEM, keyPEM)
+	},
+}
+
+// writePair writes <name>.pem and <name>-key.pem to dir, the key readable by
+// its owner only. Existing files are left alone.
+func writePair(dir string, name string, certPEM []byte, keyPEM []byte) {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		log.Fatalf("[cmd] unable to create %s: %v", dir, err)
+	}
+
+	certFile := filepath.Join(dir, name+".pem")
+	keyFile := filepath.Join(dir, name+"-key.pem")
+	for _, f := range []struct {
+		path string
+		data []byte
+		perm os.FileMode
+	}{{keyFile, keyPEM, 0600}, {certFile, certPEM, 0644}} {
+		fd, err := os.OpenFile(f.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, f.perm)
+		if err != nil {
+			log.Fatalf("[cmd] unable to create %s: %v", f.path, err)
+		}
+		_, err = fd.Write(f.data)
+		if cerr := fd.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			log.Fatalf("[cmd] unable to write %s: %v", f.path, err)
+		}
+	}
+
+	log.Printf("[cmd] wrote %s and %s", certFile, keyFile)
+}
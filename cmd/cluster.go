@@ -0,0 +1,49 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/cluster"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(clusterCmd)
+	clusterCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+}
+
+var clusterCmd = &cobra.Command{
+	Use:   "cluster",
+	Short: "Show the managers of a highly available cluster.",
+	Long: `Kanastar cluster command.
+
+	The cluster command lists the managers replicating the cluster state and
+	which of them is the leader, as seen by the manager it asks.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+
+		var status cluster.Status
+		err := getJSON(fmt.Sprintf("%s://%s/cluster", utils.Scheme, mgr), &status)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Printf("Manager %s is %s\n", status.ID, status.State)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "MANAGER\tRAFT ADDRESS\tLEADER\t")
+		for _, m := range status.Members {
+			leader := ""
+			if m.Leader {
+				leader = "*"
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t\n", m.ID, m.Address, leader)
+		}
+		w.Flush()
+	},
+}
@@ -0,0 +1,156 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/surajsharma/kanastar/config"
+	"github.com/surajsharma/kanastar/pki"
+	"github.com/surajsharma/kanastar/scheduler"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+var cfgFile string
+
+// loadConfig builds the effective config for cmd: defaults, then the config
+// file, then KANASTAR_* environment variables, then any flags given on the
+// command line. It exits if the result does not validate.
+func loadConfig(cmd *cobra.Command) config.Config {
+	c, err := config.Load(cfgFile)
+	if err != nil {
+		log.Fatalf("[cmd] %v", err)
+	}
+
+	flags := cmd.Flags()
+	setTLS(flags, &c.TLS)
+	switch cmd.Name() {
+	case "manager":
+		m := &c.Manager
+		setString(flags, "host", &m.Host)
+		setInt(flags, "port", &m.Port)
+		setStringSlice(flags, "workers", &m.Workers)
+		setString(flags, "scheduler", &m.Scheduler)
+		setString(flags, "dbType", &m.DbType)
+		setString(flags, "data-dir", &m.DataDir)
+		setInt(flags, "schedulerWorkers", &m.SchedulerWorkers)
+		setBool(flags, "preemption", &m.Preemption)
+		setDuration(flags, "gracePeriod", &m.GracePeriod)
+		setString(flags, "raft-bind", &m.Raft.Bind)
+		setString(flags, "advertise", &m.Raft.Advertise)
+		setStringSlice(flags, "raft-peers", &m.Raft.Peers)
+		setString(flags, "tokens", &m.Auth.TokensFile)
+		setString(flags, "token-secret", &m.Auth.SecretFile)
+		setString(flags, "audit-log", &m.Auth.AuditLog)
+	case "worker":
+		w := &c.Worker
+		setString(flags, "host", &w.Host)
+		setInt(flags, "port", &w.Port)
+		setString(flags, "dbtype", &w.DbType)
+		setString(flags, "data-dir", &w.DataDir)
+		setString(flags, "name", &w.Name)
+		setInt(flags, "parallelism", &w.Parallelism)
+		setDuration(flags, "gracePeriod", &w.GracePeriod)
+		setString(flags, "orphans", &w.OrphanPolicy)
+	}
+
+	err = c.Validate()
+	if err != nil {
+		log.Fatalf("[cmd] invalid configuration:\n%v", err)
+	}
+
+	utils.RetryAttempts = c.Retry.Attempts
+	utils.RetryDelay = time.Duration(c.Retry.Delay)
+	scheduler.CpuSampleInterval = time.Duration(c.Scheduler.CpuSampleInterval)
+
+	return c
+}
+
+// setupClient makes every request to the manager and the workers go over
+// TLS, authenticated with the certificate in the config, if one is set, and
+// makes kanactl's own commands send the token in the config. The certs
+// commands are left alone since they make the certificates in the first place.
+func setupClient(cmd *cobra.Command) {
+	if cmd.Parent() == adminCertsCmd {
+		return
+	}
+
+	c, err := config.Load(cfgFile)
+	if err != nil {
+		log.Fatalf("[cmd] %v", err)
+	}
+	setTLS(cmd.Flags(), &c.TLS)
+	setString(cmd.Flags(), "token", &c.Client.Token)
+
+	if c.TLS.Enabled() {
+		tc, err := pki.ClientConfig(tlsFiles(c.TLS))
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+		utils.UseTLS(tc)
+	}
+
+	// the manager forwards its clients' tokens, never sends its own
+	if c.Client.Token != "" && cmd != managerCmd && cmd != workerCmd {
+		utils.UseToken(c.Client.Token)
+	}
+}
+
+func setTLS(flags *pflag.FlagSet, t *config.TLS) {
+	setString(flags, "tls-ca", &t.CA)
+	setString(flags, "tls-cert", &t.Cert)
+	setString(flags, "tls-key", &t.Key)
+}
+
+func tlsFiles(t config.TLS) pki.Files {
+	return pki.Files{CA: t.CA, Cert: t.Cert, Key: t.Key}
+}
+
+// printConfig prints c as YAML if --print-config was given and reports
+// whether it did.
+func printConfig(cmd *cobra.Command, c config.Config) bool {
+	show, _ := cmd.Flags().GetBool("print-config")
+	if !show {
+		return false
+	}
+
+	out, err := c.Redacted().YAML()
+	if err != nil {
+		log.Fatalf("[cmd] %v", err)
+	}
+	fmt.Print(out)
+	return true
+}
+
+func setString(flags *pflag.FlagSet, name string, v *string) {
+	if flags.Changed(name) {
+		*v, _ = flags.GetString(name)
+	}
+}
+
+func setInt(flags *pflag.FlagSet, name string, v *int) {
+	if flags.Changed(name) {
+		*v, _ = flags.GetInt(name)
+	}
+}
+
+func setBool(flags *pflag.FlagSet, name string, v *bool) {
+	if flags.Changed(name) {
+		*v, _ = flags.GetBool(name)
+	}
+}
+
+func setStringSlice(flags *pflag.FlagSet, name string, v *[]string) {
+	if flags.Changed(name) {
+		*v, _ = flags.GetStringSlice(name)
+	}
+}
+
+func setDuration(flags *pflag.FlagSet, name string, v *config.Duration) {
+	if flags.Changed(name) {
+		d, _ := flags.GetDuration(name)
+		*v = config.Duration(d)
+	}
+}
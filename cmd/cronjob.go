@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/cronjob"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(cronJobCmd)
+	cronJobCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+
+	cronJobCmd.AddCommand(cronJobCreateCmd)
+	cronJobCreateCmd.Flags().StringP("filename", "f", "cronjob.json", "Cron job specification file")
+
+	cronJobCmd.AddCommand(cronJobListCmd)
+}
+
+var cronJobCmd = &cobra.Command{
+	Use:   "cronjob",
+	Short: "Manage cron-scheduled tasks.",
+	Long: `Kanastar cronjob command.
+
+	A cron job starts a task from a template whenever its cron schedule fires.`,
+}
+
+var cronJobCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a cron job from a specification file.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+
+		data := readSpecFile(filename)
+
+		url := fmt.Sprintf("%s://%s/cronjobs", utils.Scheme, mgr)
+		resp, err := utils.HTTP.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			log.Fatalf("[cmd] error creating cron job: %v", decodeErrResponse(resp))
+		}
+
+		var c cronjob.CronJob
+		json.NewDecoder(resp.Body).Decode(&c)
+		log.Printf("[cmd] created cron job %s, next run at %v", c.Name, c.Next(time.Now()))
+	},
+}
+
+var cronJobListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List cron jobs.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+
+		var jobs []*cronjob.CronJob
+		err := getJSON(fmt.Sprintf("%s://%s/cronjobs", utils.Scheme, mgr), &jobs)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "NAME\tSCHEDULE\tTIMEZONE\tSUSPENDED\tACTIVE\tLAST RUN\tNEXT RUN\t")
+		for _, c := range jobs {
+			last := "<never>"
+			if !c.LastScheduleTime.IsZero() {
+				last = fmt.Sprintf("%s ago", units.HumanDuration(time.Since(c.LastScheduleTime)))
+			}
+
+			tz := valueOr(c.TimeZone, "UTC")
+			next := c.Next(time.Now()).Format(time.RFC3339)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%t\t%d\t%s\t%s\t\n", c.Name, c.Schedule, tz, c.Suspend, len(c.Active), last, next)
+		}
+		w.Flush()
+	},
+}
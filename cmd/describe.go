@@ -0,0 +1,137 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/manager"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+	describeCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+}
+
+var describeCmd = &cobra.Command{
+	Use:   "describe <task-id>",
+	Short: "Show details of a single task.",
+	Long: `Kanastar describe command.
+
+	The describe command shows the full record of a task, the worker it is
+	assigned to, its recent events and the state of its container.`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+
+		url := fmt.Sprintf("%s://%s/tasks/%s", utils.Scheme, mgr, args[0])
+		resp, err := utils.HTTP.Get(url)
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode == http.StatusNotFound {
+			log.Fatalf("[cmd] task %v not found (%v)", args[0], resp.StatusCode)
+		}
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("[cmd] error describing task %v: %v", args[0], decodeErrResponse(resp))
+		}
+
+		var detail manager.TaskDetail
+		err = json.NewDecoder(resp.Body).Decode(&detail)
+		if err != nil {
+			log.Fatalf("[cmd] error decoding response: %v", err)
+		}
+
+		printTaskDetail(detail)
+	},
+}
+
+func printTaskDetail(d manager.TaskDetail) {
+	t := d.Task
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintf(w, "ID:\t%s\n", t.ID)
+	fmt.Fprintf(w, "Name:\t%s\n", t.Name)
+	fmt.Fprintf(w, "State:\t%s\n", t.State)
+	if t.State == task.Pending && t.PendingReason != "" {
+		fmt.Fprintf(w, "Pending Reason:\t%s (%d attempts, next at %s)\n", t.PendingReason, t.ScheduleAttempts, t.NextScheduleTime.Format(time.RFC3339))
+	}
+	fmt.Fprintf(w, "Image:\t%s\n", t.Image)
+	fmt.Fprintf(w, "Worker:\t%s\n", valueOr(d.Worker, "<unassigned>"))
+	fmt.Fprintf(w, "Memory:\t%s\n", units.BytesSize(float64(t.Memory)))
+	fmt.Fprintf(w, "Disk:\t%s\n", units.BytesSize(float64(t.Disk)))
+	fmt.Fprintf(w, "Cpu:\t%v\n", t.Cpu)
+	fmt.Fprintf(w, "Restart Policy:\t%s\n", valueOr(t.RestartPolicy, "<none>"))
+	fmt.Fprintf(w, "Restart Count:\t%d\n", t.RestartCount)
+	fmt.Fprintf(w, "Health Check:\t%s\n", valueOr(t.HealthCheck, "<none>"))
+	fmt.Fprintf(w, "Started:\t%s\n", formatTime(t.StartTime))
+	fmt.Fprintf(w, "Finished:\t%s\n", formatTime(t.FinishTime))
+	w.Flush()
+
+	fmt.Println("\nContainer:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if c := d.Container; c != nil {
+		fmt.Fprintf(w, "  ID:\t%s\n", c.ID)
+		fmt.Fprintf(w, "  Name:\t%s\n", strings.TrimPrefix(c.Name, "/"))
+		fmt.Fprintf(w, "  Status:\t%s\n", c.Status)
+		fmt.Fprintf(w, "  Exit Code:\t%d\n", c.ExitCode)
+		if c.OOMKilled {
+			fmt.Fprintf(w, "  OOM Killed:\ttrue\n")
+		}
+		if c.Error != "" {
+			fmt.Fprintf(w, "  Error:\t%s\n", c.Error)
+		}
+		fmt.Fprintf(w, "  Started At:\t%s\n", c.StartedAt)
+		fmt.Fprintf(w, "  Restarts:\t%d\n", c.RestartCount)
+		for port, bindings := range c.Ports {
+			for _, b := range bindings {
+				fmt.Fprintf(w, "  Port:\t%s -> %s:%s\n", port, b.HostIP, b.HostPort)
+			}
+		}
+	} else if t.ContainerID != "" {
+		fmt.Fprintf(w, "  ID:\t%s\n", t.ContainerID)
+		fmt.Fprintf(w, "  Status:\t<unavailable>\n")
+	} else {
+		fmt.Fprintf(w, "  <none>\n")
+	}
+	w.Flush()
+
+	fmt.Println("\nEvents:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	if len(d.Events) == 0 {
+		fmt.Fprintf(w, "  <none>\n")
+	} else {
+		fmt.Fprintln(w, "  AGE\tSTATE\tID\t")
+		for _, e := range d.Events {
+			fmt.Fprintf(w, "  %s ago\t%s\t%s\t\n", units.HumanDuration(time.Since(e.Timestamp)), e.State, e.ID)
+		}
+	}
+	w.Flush()
+}
+
+func valueOr(s string, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "<never>"
+	}
+	return fmt.Sprintf("%s (%s ago)", t.Format(time.RFC3339), units.HumanDuration(time.Since(t)))
+}
@@ -1,10 +1,20 @@
 package cmd
 
 import (
+	"context"
+	"crypto/tls"
 	"log"
+	"os"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/auth"
+	"github.com/surajsharma/kanastar/cluster"
+	"github.com/surajsharma/kanastar/config"
+	"github.com/surajsharma/kanastar/datadir"
 	"github.com/surajsharma/kanastar/manager"
+	"github.com/surajsharma/kanastar/pki"
+	"github.com/surajsharma/kanastar/store"
 	"github.com/surajsharma/kanastar/utils"
 )
 
@@ -21,35 +31,145 @@ var managerCmd = &cobra.Command{
 	◻ Periodically polling workers to get task updates`,
 
 	Run: func(cmd *cobra.Command, args []string) {
+		c := loadConfig(cmd)
+		if printConfig(cmd, c) {
+			return
+		}
+
 		if !utils.IsDockerDaemonUp() {
 			return
 		}
 
-		host, _ := cmd.Flags().GetString("host")
-		port, _ := cmd.Flags().GetInt("port")
-		workers, _ := cmd.Flags().GetStringSlice("workers")
-		scheduler, _ := cmd.Flags().GetString("scheduler")
-		dbType, _ := cmd.Flags().GetString("dbType")
+		mc := c.Manager
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		dir, err := datadir.Open(mc.DataDir, "manager")
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+		defer dir.Close()
+
+		log.Printf("[cmd] starting manager with data dir %s", dir.Path)
+		m, err := manager.New(mc.Workers, mc.Scheduler, mc.DbType, dir.Path)
+		if err != nil {
+			log.Fatalf("[cmd] unable to start manager: %v", err)
+		}
+		m.Preemption = mc.Preemption
+		m.SchedulerWorkers = mc.SchedulerWorkers
+		m.ReconcileInterval = time.Duration(mc.ReconcileInterval)
+		m.UpdateInterval = time.Duration(mc.UpdateInterval)
+		m.HealthCheckInterval = time.Duration(mc.HealthCheckInterval)
+		m.StatsInterval = time.Duration(mc.StatsInterval)
+		m.MaxRestarts = mc.MaxRestarts
+		m.MaxWorkerFailures = mc.MaxWorkerFailures
+		m.TaskRetention = retention(c.Retention.Tasks)
+		m.EventRetention = retention(c.Retention.Events)
+		m.CompactInterval = time.Duration(c.Retention.Interval)
+		m.Quotas = make(map[string]manager.Quota, len(mc.Quotas))
+		for name, q := range mc.Quotas {
+			m.Quotas[name] = manager.Quota{Memory: q.Memory, Disk: q.Disk, Cpu: q.Cpu, Tasks: q.Tasks}
+		}
+		api := manager.Api{Address: mc.Host, Port: mc.Port, Manager: m}
 
-		log.Println("[cmd] starting manager")
-		m := manager.New(workers, scheduler, dbType)
-		api := manager.Api{Address: host, Port: port, Manager: m}
-		go m.ProcessTasks()
-		go m.UpdateTasks()
-		go m.DoHealthChecks()
-		// go m.UpdateNodeStats()
-		log.Printf("[cmd] starting manager API on http://%s:%d", host, port)
-		api.Start()
+		if mc.Auth.Enabled() {
+			api.Auth, err = auth.Load(mc.Auth.TokensFile, mc.Auth.SecretFile)
+			if err != nil {
+				m.Close()
+				log.Fatalf("[cmd] %v", err)
+			}
+		}
+		if mc.Auth.AuditLog != "" {
+			f, err := os.OpenFile(mc.Auth.AuditLog, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+			if err != nil {
+				m.Close()
+				log.Fatalf("[cmd] unable to open audit log: %v", err)
+			}
+			defer f.Close()
+			api.Audit = log.New(f, "", log.LstdFlags|log.LUTC)
+		}
+
+		var peerTLS *tls.Config
+		if c.TLS.Enabled() {
+			api.TLS, err = pki.ServerConfig(tlsFiles(c.TLS))
+			if err == nil {
+				peerTLS, err = pki.PeerConfig(tlsFiles(c.TLS))
+			}
+			if err != nil {
+				m.Close()
+				log.Fatalf("[cmd] %v", err)
+			}
+		}
+
+		var l loops
+		var group *cluster.Cluster
+		if mc.Raft.Bind != "" {
+			peers, err := mc.Raft.PeerMap()
+			if err != nil {
+				m.Close()
+				log.Fatalf("[cmd] unable to start manager cluster: %v", err)
+			}
+			group = cluster.New()
+			m.EnableCluster(group)
+
+			log.Printf("[cmd] joining manager cluster as %s, raft on %s", mc.Raft.Advertise, mc.Raft.Bind)
+			err = group.Start(cluster.Config{
+				ID:    mc.Raft.Advertise,
+				Bind:  mc.Raft.Bind,
+				Peers: peers,
+				Dir:   dir.File("raft"),
+				TLS:   peerTLS,
+			})
+			if err != nil {
+				m.Close()
+				log.Fatalf("[cmd] unable to start manager cluster: %v", err)
+			}
+			l.run(ctx, func(ctx context.Context) { group.RunLeader(ctx, m.Lead) })
+		} else {
+			l.run(ctx, m.Lead)
+		}
+
+		log.Printf("[cmd] starting manager API on %s://%s:%d", utils.Scheme, mc.Host, mc.Port)
+		drained := serve(ctx, stop, &api, &l, time.Duration(mc.GracePeriod))
+
+		if group != nil {
+			err = group.Shutdown()
+			if err != nil {
+				log.Printf("[cmd] error leaving manager cluster: %v", err)
+			}
+		}
+		if !drained {
+			log.Println("[cmd] manager stopped without closing its stores")
+			return
+		}
+		m.Close()
+		log.Println("[cmd] manager stopped")
 
 	},
 }
 
+func retention(p config.Policy) store.Retention {
+	return store.Retention{TTL: time.Duration(p.TTL), MaxCount: p.MaxCount}
+}
+
 func init() {
 	rootCmd.AddCommand(managerCmd)
 	managerCmd.Flags().StringP("host", "H", "0.0.0.0", "Hostname or IP address")
 	managerCmd.Flags().IntP("port", "p", 5555, "Port on which to listen")
 	managerCmd.Flags().StringSliceP("workers", "w", []string{"localhost:5556"}, "List (csv) of workers on which the manager will schedule tasks.")
 	managerCmd.Flags().StringP("scheduler", "s", "epvm", "Name of scheduler to use (\"epvm\",\"roundrobin\", or \"greedy\")")
-	managerCmd.Flags().StringP("dbType", "d", "memory", "Type of datastore to use for events and tasks (\"memory\" or \"persistent\")")
+	managerCmd.Flags().StringP("dbType", "d", "memory", "Type of datastore to use for events and tasks (\"memory\", \"persistent\" or \"sqlite\")")
+	managerCmd.Flags().String("data-dir", ".", "Directory the manager keeps its database files in")
+	managerCmd.Flags().Int("schedulerWorkers", manager.DefaultSchedulerWorkers, "Number of tasks the manager places on workers concurrently")
+	managerCmd.Flags().Duration("gracePeriod", time.Duration(config.Default().Manager.GracePeriod), "How long to wait for work in progress when shutting down")
+	managerCmd.Flags().Bool("preemption", false, "Stop lower priority tasks to make room for higher priority ones when no worker has capacity")
+	managerCmd.Flags().String("raft-bind", "", "Address to talk Raft to the other managers on; enables high availability")
+	managerCmd.Flags().String("advertise", "", "Address the other managers reach this manager's API on")
+	managerCmd.Flags().StringSlice("raft-peers", nil, "List (csv) of all managers in the cluster as <api address>=<raft address>")
+	managerCmd.Flags().String("tokens", "", "File of static API tokens and their roles; requires a token with every request")
+	managerCmd.Flags().String("token-secret", "", "File of the secret API tokens are signed with; requires a token with every request")
+	managerCmd.Flags().String("audit-log", "", "File to append the audit records to (default the log)")
+	managerCmd.Flags().Bool("print-config", false, "Print the effective configuration and exit")
 
 }
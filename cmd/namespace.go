@@ -0,0 +1,60 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/manager"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(namespaceCmd)
+	namespaceCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+}
+
+var namespaceCmd = &cobra.Command{
+	Use:   "namespace",
+	Short: "List namespaces with their quotas and usage.",
+	Long: `Kanastar namespace command.
+
+	Lists the namespaces that have tasks or a quota, with what their
+	unfinished tasks use of the quota. A dash means no limit.`,
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+
+		var namespaces []manager.Namespace
+		err := getJSON(fmt.Sprintf("%s://%s/namespaces", utils.Scheme, mgr), &namespaces)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "NAMESPACE\tTASKS\tCPU\tMEMORY\tDISK\t")
+		for _, ns := range namespaces {
+			q := manager.Quota{}
+			if ns.Quota != nil {
+				q = *ns.Quota
+			}
+			u := ns.Usage
+			fmt.Fprintf(w, "%s\t%d/%s\t%g/%s\t%s/%s\t%s/%s\t\n", ns.Name,
+				u.Tasks, quotaLimit(q.Tasks > 0, fmt.Sprint(q.Tasks)),
+				u.Cpu, quotaLimit(q.Cpu > 0, fmt.Sprint(q.Cpu)),
+				units.BytesSize(float64(u.Memory)), quotaLimit(q.Memory > 0, units.BytesSize(float64(q.Memory))),
+				units.BytesSize(float64(u.Disk)), quotaLimit(q.Disk > 0, units.BytesSize(float64(q.Disk))))
+		}
+		w.Flush()
+	},
+}
+
+func quotaLimit(set bool, value string) string {
+	if !set {
+		return "-"
+	}
+	return value
+}
@@ -33,14 +33,17 @@ var nodeCmd = &cobra.Command{
 
 		manager, _ := cmd.Flags().GetString("manager")
 
-		url := fmt.Sprintf("http://%s/nodes", manager)
-		resp, err := http.Get(url)
+		url := fmt.Sprintf("%s://%s/nodes", utils.Scheme, manager)
+		resp, err := utils.HTTP.Get(url)
 
 		if err != nil {
-			log.Println("[cmd] request to manager could not be completed")
+			log.Fatalf("[cmd] request to manager could not be completed: %v", err)
 		}
 
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("[cmd] error listing nodes: %v", decodeErrResponse(resp))
+		}
 
 		body, _ := io.ReadAll(resp.Body)
 
@@ -48,10 +51,10 @@ var nodeCmd = &cobra.Command{
 		json.Unmarshal(body, &nodes)
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
-		fmt.Fprintln(w, "NAME\tMEMORY (MiB)\tDISK (GiB)\tROLE\tTASKS\t")
+		fmt.Fprintln(w, "NAME\tMEMORY (MiB)\tDISK (GiB)\tROLE\tTASKS\tORPHANS\t")
 
 		for _, node := range nodes {
-			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t\n", node.Name, node.Memory/1000, node.Disk/1000/1000/1000, node.Role, node.TaskCount)
+			fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\t%d\t\n", node.Name, node.Memory/1000, node.Disk/1000/1000/1000, node.Role, node.TaskCount, len(node.Stats.Orphans))
 		}
 		w.Flush()
 	},
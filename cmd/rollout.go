@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/service"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(rolloutCmd)
+	rolloutCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+
+	rolloutCmd.AddCommand(rolloutStatusCmd)
+	rolloutStatusCmd.Flags().BoolP("wait", "w", false, "Wait until the rollout completes or pauses")
+
+	rolloutCmd.AddCommand(rolloutUndoCmd)
+	rolloutUndoCmd.Flags().IntP("to-revision", "r", 0, "Revision to roll back to (default: the previous one)")
+}
+
+var rolloutCmd = &cobra.Command{
+	Use:   "rollout",
+	Short: "Inspect and undo service rollouts.",
+	Long: `Kanastar rollout command.
+
+	Changing a service's template rolls new replicas out in batches. The
+	rollout command shows the progress of a rollout and can roll a service
+	back to an earlier revision.`,
+}
+
+var rolloutStatusCmd = &cobra.Command{
+	Use:   "status <service>",
+	Short: "Show the rollout status of a service.",
+
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		wait, _ := cmd.Flags().GetBool("wait")
+
+		url := fmt.Sprintf("%s://%s/services/%s/rollout", utils.Scheme, mgr, args[0])
+
+		for {
+			var status service.RolloutStatus
+			err := getJSON(url, &status)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			if !wait || status.State != service.RolloutProgressing {
+				printRolloutStatus(status)
+				return
+			}
+
+			fmt.Printf("waiting for rollout of %s: %d of %d updated replicas available, %d outdated\n",
+				status.Service, status.Available, status.Replicas, status.Outdated)
+			time.Sleep(5 * time.Second)
+		}
+	},
+}
+
+var rolloutUndoCmd = &cobra.Command{
+	Use:   "undo <service>",
+	Short: "Roll a service back to an earlier revision.",
+
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		revision, _ := cmd.Flags().GetInt("to-revision")
+
+		data, _ := json.Marshal(service.RollbackRequest{Revision: revision})
+
+		url := fmt.Sprintf("%s://%s/services/%s/rollback", utils.Scheme, mgr, args[0])
+		resp, err := utils.HTTP.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("[cmd] error rolling back service %s: %v", args[0], decodeErrResponse(resp))
+		}
+
+		var s service.Service
+		json.NewDecoder(resp.Body).Decode(&s)
+		log.Printf("[cmd] service %s rolling back to revision %d", s.Name, s.Revision)
+	},
+}
+
+func printRolloutStatus(status service.RolloutStatus) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(w, "Service:\t%s\n", status.Service)
+	fmt.Fprintf(w, "Revision:\t%d\n", status.Revision)
+	fmt.Fprintf(w, "State:\t%s\n", status.State)
+	fmt.Fprintf(w, "Message:\t%s\n", status.Message)
+	fmt.Fprintf(w, "Replicas:\t%d desired, %d updated, %d available, %d outdated\n", status.Replicas, status.Updated, status.Available, status.Outdated)
+	if !status.LastUpdated.IsZero() {
+		fmt.Fprintf(w, "Last Change:\t%s ago\n", units.HumanDuration(time.Since(status.LastUpdated)))
+	}
+	w.Flush()
+
+	fmt.Println("\nRevisions:")
+	w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "  REVISION\tIMAGE\tCREATED\t")
+	for _, rev := range status.History {
+		marker := ""
+		if rev.Number == status.Revision {
+			marker = " (current)"
+		}
+		fmt.Fprintf(w, "  %d%s\t%s\t%s ago\t\n", rev.Number, marker, rev.Template.Image, units.HumanDuration(time.Since(rev.CreatedAt)))
+	}
+	w.Flush()
+}
@@ -14,6 +14,9 @@ var rootCmd = &cobra.Command{
 	// Uncomment the following line if your bare application
 	// has an action associated with it:
 	// Run: func(cmd *cobra.Command, args []string) { },
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+		setupClient(cmd)
+	},
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -32,7 +35,11 @@ func init() {
 	// Cobra supports persistent flags, which, if defined here,
 	// will be global for your application.
 
-	// rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.kanastar.yaml)")
+	rootCmd.PersistentFlags().StringVar(&cfgFile, "config", "", "config file (default is $HOME/.kanastar.yaml)")
+	rootCmd.PersistentFlags().String("tls-ca", "", "CA certificate the manager, workers and kanactl are signed by; enables TLS")
+	rootCmd.PersistentFlags().String("tls-cert", "", "Certificate to authenticate with, signed by the CA")
+	rootCmd.PersistentFlags().String("tls-key", "", "Key of the certificate")
+	rootCmd.PersistentFlags().String("token", "", "Token to authenticate to the manager with")
 
 	// Cobra also supports local flags, which will only run
 	// when this action is called directly.
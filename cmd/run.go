@@ -2,6 +2,7 @@ package cmd
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 
 	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/task"
 	"github.com/surajsharma/kanastar/utils"
 )
 
@@ -18,6 +20,7 @@ func init() {
 	rootCmd.AddCommand(runCmd)
 	runCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
 	runCmd.Flags().StringP("filename", "f", "task.json", "Task specification file")
+	runCmd.Flags().StringP("namespace", "n", "", "Namespace to run the task in, instead of the one in the file")
 }
 
 func fileExists(filename string) bool {
@@ -59,20 +62,33 @@ var runCmd = &cobra.Command{
 			log.Fatalf("[cmd] unable to read file: %v", filename)
 		}
 
+		if cmd.Flags().Changed("namespace") {
+			te := task.TaskEvent{}
+			err = json.Unmarshal(data, &te)
+			if err != nil {
+				log.Fatalf("[cmd] unable to parse %s: %v", filename, err)
+			}
+			te.Task.Namespace, _ = cmd.Flags().GetString("namespace")
+			data, err = json.Marshal(te)
+			if err != nil {
+				log.Fatalf("[cmd] unable to encode task: %v", err)
+			}
+		}
+
 		log.Printf("\n[cmd] attempting to run task: %v\n", string(data))
 
-		url := fmt.Sprintf("http://%s/tasks", manager)
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+		url := fmt.Sprintf("%s://%s/tasks", utils.Scheme, manager)
+		resp, err := utils.HTTP.Post(url, "application/json", bytes.NewBuffer(data))
 
 		if err != nil {
 			log.Panic(err)
 		}
 
+		defer resp.Body.Close()
+
 		if resp.StatusCode != http.StatusCreated {
-			log.Printf("[cmd] error sending request: %v", resp.StatusCode)
+			log.Fatalf("[cmd] error sending request: %v", decodeErrResponse(resp))
 		}
-
-		defer resp.Body.Close()
 		log.Println("[cmd] successfully sent task request to manager")
 	},
 }
@@ -0,0 +1,50 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/service"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(scaleCmd)
+	scaleCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	scaleCmd.Flags().IntP("replicas", "r", 1, "Number of replicas the service should run")
+	scaleCmd.MarkFlagRequired("replicas")
+}
+
+var scaleCmd = &cobra.Command{
+	Use:   "scale <service>",
+	Short: "Change the number of replicas of a service.",
+	Long: `Kanastar scale command.
+
+	The scale command sets how many replicas of a service the manager keeps running.`,
+
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		replicas, _ := cmd.Flags().GetInt("replicas")
+
+		data, _ := json.Marshal(service.ScaleRequest{Replicas: replicas})
+
+		url := fmt.Sprintf("%s://%s/services/%s/scale", utils.Scheme, mgr, args[0])
+		resp, err := utils.HTTP.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("[cmd] error scaling service %s: %v", args[0], decodeErrResponse(resp))
+		}
+
+		log.Printf("[cmd] service %s scaled to %d replicas", args[0], replicas)
+	},
+}
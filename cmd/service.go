@@ -0,0 +1,182 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/manager"
+	"github.com/surajsharma/kanastar/service"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+func init() {
+	rootCmd.AddCommand(serviceCmd)
+	serviceCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+
+	serviceCmd.AddCommand(serviceCreateCmd)
+	serviceCreateCmd.Flags().StringP("filename", "f", "service.json", "Service specification file")
+
+	serviceCmd.AddCommand(serviceUpdateCmd)
+	serviceUpdateCmd.Flags().StringP("filename", "f", "service.json", "Service specification file")
+
+	serviceCmd.AddCommand(serviceListCmd)
+}
+
+var serviceCmd = &cobra.Command{
+	Use:   "service",
+	Short: "Manage services.",
+	Long: `Kanastar service command.
+
+	A service keeps a number of identical tasks (replicas) running from a
+	template task, replacing replicas that fail or whose worker goes away.`,
+}
+
+var serviceCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a service from a specification file.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+
+		data := readSpecFile(filename)
+
+		url := fmt.Sprintf("%s://%s/services", utils.Scheme, mgr)
+		resp, err := utils.HTTP.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			log.Fatalf("[cmd] error creating service: %v", decodeErrResponse(resp))
+		}
+
+		var s service.Service
+		json.NewDecoder(resp.Body).Decode(&s)
+		log.Printf("[cmd] created service %s with %d replicas", s.Name, s.Replicas)
+	},
+}
+
+var serviceUpdateCmd = &cobra.Command{
+	Use:   "update",
+	Short: "Update a service, rolling out a changed template.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+
+		data := readSpecFile(filename)
+
+		var spec service.Service
+		err := json.Unmarshal(data, &spec)
+		if err != nil {
+			log.Fatalf("[cmd] unable to parse %v: %v", filename, err)
+		}
+
+		url := fmt.Sprintf("%s://%s/services/%s", utils.Scheme, mgr, spec.Name)
+		req, err := http.NewRequest(http.MethodPut, url, bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatalf("[cmd] error creating request %v: %v", url, err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		resp, err := utils.HTTP.Do(req)
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("[cmd] error updating service: %v", decodeErrResponse(resp))
+		}
+
+		var s service.Service
+		json.NewDecoder(resp.Body).Decode(&s)
+		log.Printf("[cmd] service %s is at revision %d (%s)", s.Name, s.Revision, s.Rollout.State)
+	},
+}
+
+var serviceListCmd = &cobra.Command{
+	Use:   "ls",
+	Short: "List services and their replicas.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+
+		var services []*service.Service
+		err := getJSON(fmt.Sprintf("%s://%s/services", utils.Scheme, mgr), &services)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var tasks []*task.Task
+		err = getJSON(fmt.Sprintf("%s://%s/tasks", utils.Scheme, mgr), &tasks)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		running := make(map[string]int)
+		for _, t := range tasks {
+			if t.Service != "" && t.DesiredState == task.Running && t.State == task.Running {
+				running[t.Service]++
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		fmt.Fprintln(w, "NAME\tREPLICAS\tIMAGE\t")
+		for _, s := range services {
+			fmt.Fprintf(w, "%s\t%d/%d\t%s\t\n", s.Name, running[s.Name], s.Replicas, s.Template.Image)
+		}
+		w.Flush()
+	},
+}
+
+func readSpecFile(filename string) []byte {
+	fullFilePath, err := filepath.Abs(filename)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if !fileExists(fullFilePath) {
+		log.Fatalf("[cmd] file %s does not exist.", filename)
+	}
+
+	data, err := os.ReadFile(fullFilePath)
+	if err != nil {
+		log.Fatalf("[cmd] unable to read file: %v", filename)
+	}
+
+	return data
+}
+
+func getJSON(url string, v interface{}) error {
+	resp, err := utils.HTTP.Get(url)
+	if err != nil {
+		return fmt.Errorf("[cmd] error connecting to %v: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("[cmd] request to %v failed: %v", url, decodeErrResponse(resp))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+func decodeErrResponse(resp *http.Response) string {
+	e := manager.ErrResponse{}
+	err := json.NewDecoder(resp.Body).Decode(&e)
+	if err != nil || e.Message == "" {
+		return resp.Status
+	}
+	return e.Message
+}
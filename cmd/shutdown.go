@@ -0,0 +1,88 @@
+package cmd
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// loops runs the background loops of a manager or worker and waits for them
+// to return once their context is cancelled.
+type loops struct {
+	wg sync.WaitGroup
+}
+
+func (l *loops) run(ctx context.Context, f func(context.Context)) {
+	l.wg.Add(1)
+	go func() {
+		defer l.wg.Done()
+		f(ctx)
+	}()
+}
+
+// wait waits for the loops to return until ctx is done and reports whether
+// they all did.
+func (l *loops) wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		l.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// signalContext is cancelled on SIGINT or SIGTERM.
+func signalContext() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+type server interface {
+	Start() error
+	Shutdown(ctx context.Context) error
+}
+
+// serve runs api until ctx is cancelled or the API fails, then calls stop so
+// the loops see it too, and shuts everything down within the grace period.
+// It reports whether the loops returned in time; if not, they may still be
+// using the stores, which must then be left open.
+func serve(ctx context.Context, stop context.CancelFunc, api server, l *loops, grace time.Duration) bool {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- api.Start()
+	}()
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			log.Printf("[cmd] API stopped: %v", err)
+		}
+	case <-ctx.Done():
+	}
+
+	stop()
+	log.Printf("[cmd] shutting down, waiting up to %v for work in progress", grace)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+
+	err := api.Shutdown(shutdownCtx)
+	if err != nil {
+		log.Printf("[cmd] error shutting down API: %v", err)
+	}
+
+	if !l.wait(shutdownCtx) {
+		log.Printf("[cmd] grace period of %v expired with work still in progress", grace)
+		return false
+	}
+	return true
+}
@@ -1,17 +1,25 @@
 package cmd
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 	"time"
 
 	"github.com/docker/go-units"
+	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/manager"
 	"github.com/surajsharma/kanastar/task"
 	"github.com/surajsharma/kanastar/utils"
 )
@@ -19,6 +27,13 @@ import (
 func init() {
 	rootCmd.AddCommand(statusCmd)
 	statusCmd.Flags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+	statusCmd.Flags().BoolP("watch", "W", false, "Keep watching the manager and redraw the table as tasks change")
+	statusCmd.Flags().String("state", "", "Only list tasks in this state")
+	statusCmd.Flags().String("worker", "", "Only list tasks assigned to this worker")
+	statusCmd.Flags().StringP("namespace", "n", "", "Only list tasks in this namespace")
+	statusCmd.Flags().StringSliceP("label", "l", nil, "Only list tasks with this key=value label, may be repeated")
+	statusCmd.Flags().Int("offset", 0, "Skip this many matching tasks")
+	statusCmd.Flags().Int("limit", 0, "List at most this many tasks, all if 0")
 }
 
 var statusCmd = &cobra.Command{
@@ -34,9 +49,22 @@ var statusCmd = &cobra.Command{
 		}
 
 		manager, _ := cmd.Flags().GetString("manager")
+		watch, _ := cmd.Flags().GetBool("watch")
+		namespace, _ := cmd.Flags().GetString("namespace")
 
-		url := fmt.Sprintf("http://%s/tasks", manager)
-		resp, _ := http.Get(url)
+		if watch {
+			watchTasks(manager, namespace)
+			return
+		}
+
+		url := fmt.Sprintf("%s://%s/tasks?%s", utils.Scheme, manager, taskQuery(cmd).Encode())
+		resp, err := utils.HTTP.Get(url)
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("[cmd] error listing tasks: %v", decodeErrResponse(resp))
+		}
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
 			log.Fatal(err)
@@ -49,20 +77,172 @@ var statusCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 
-		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
-		fmt.Fprintln(w, "ID\tNAME\tCREATED\tSTATE\tCONTAINERNAME\tIMAGE\t")
-		for _, task := range tasks {
-			var start string
-			if task.StartTime.IsZero() {
-				start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(time.Now().UTC())))
+		printTasks(os.Stdout, tasks)
+	},
+}
+
+func taskQuery(cmd *cobra.Command) url.Values {
+	q := url.Values{}
+
+	state, _ := cmd.Flags().GetString("state")
+	if state != "" {
+		q.Set("state", state)
+	}
+	worker, _ := cmd.Flags().GetString("worker")
+	if worker != "" {
+		q.Set("worker", worker)
+	}
+	namespace, _ := cmd.Flags().GetString("namespace")
+	if namespace != "" {
+		q.Set("namespace", namespace)
+	}
+	labels, _ := cmd.Flags().GetStringSlice("label")
+	for _, l := range labels {
+		q.Add("label", l)
+	}
+	offset, _ := cmd.Flags().GetInt("offset")
+	if offset > 0 {
+		q.Set("offset", strconv.Itoa(offset))
+	}
+	limit, _ := cmd.Flags().GetInt("limit")
+	if limit > 0 {
+		q.Set("limit", strconv.Itoa(limit))
+	}
+
+	return q
+}
+
+func printTasks(out io.Writer, tasks []*task.Task) {
+	w := tabwriter.NewWriter(out, 0, 0, 5, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "ID\tNAMESPACE\tNAME\tCREATED\tSTATE\tCONTAINERNAME\tIMAGE\t")
+	for _, t := range tasks {
+		var start string
+		if t.StartTime.IsZero() {
+			start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(time.Now().UTC())))
+		} else {
+			start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(t.StartTime)))
+		}
+
+		// TODO: there is a bug here, state for stopped jobs is showing as Running
+		state := strings.ToLower(t.State.String())
+		if t.PendingReason != "" && t.State == task.Pending {
+			state = fmt.Sprintf("%s: %s", state, t.PendingReason)
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t\n", t.ID.String(), t.NamespaceOrDefault(), t.Name, start, state, t.Name, t.Image)
+	}
+	w.Flush()
+}
+
+// watchTasks keeps a local copy of the manager's tasks up to date from the
+// watch stream and redraws the table on every change. If the stream drops it
+// reconnects from the last cursor it saw. A namespace limits it to the
+// tasks of that namespace.
+func watchTasks(addr string, namespace string) {
+	tasks := make(map[uuid.UUID]*task.Task)
+	var cursor uint64
+
+	for {
+		err := streamWatch(addr, manager.WatchTasks, namespace, cursor, func(ev manager.WatchEvent) {
+			cursor = ev.Cursor
+
+			var t task.Task
+			err := json.Unmarshal(ev.Object, &t)
+			if err != nil {
+				log.Printf("[cmd] unable to decode task from watch event %d: %v", ev.Cursor, err)
+				return
+			}
+
+			if ev.Type == "delete" {
+				delete(tasks, t.ID)
 			} else {
-				start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(task.StartTime)))
+				tasks[t.ID] = &t
 			}
 
-			// TODO: there is a bug here, state for stopped jobs is showing as Running
-			state := task.State
-			fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t\n", task.ID.String(), task.Name, start, state, task.Name, task.Image)
+			renderTasks(tasks)
+		})
+
+		if errors.Is(err, errWatchExpired) {
+			// our cursor fell out of the manager's history, start over from a fresh snapshot
+			tasks = make(map[uuid.UUID]*task.Task)
+			cursor = 0
 		}
-		w.Flush()
-	},
+
+		log.Printf("[cmd] watch stream closed: %v, reconnecting", err)
+		time.Sleep(2 * time.Second)
+	}
+}
+
+var errWatchExpired = errors.New("[cmd] watch cursor expired")
+
+func renderTasks(tasks map[uuid.UUID]*task.Task) {
+	list := make([]*task.Task, 0, len(tasks))
+	for _, t := range tasks {
+		list = append(list, t)
+	}
+
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name < list[j].Name
+	})
+
+	// clear the screen and move the cursor home before redrawing
+	fmt.Print("\033[H\033[2J")
+	fmt.Printf("Watching tasks, last update %s\n\n", time.Now().Format(time.TimeOnly))
+	printTasks(os.Stdout, list)
+}
+
+func streamWatch(addr string, kind string, namespace string, cursor uint64, handle func(manager.WatchEvent)) error {
+	url := fmt.Sprintf("%s://%s/watch?kind=%s", utils.Scheme, addr, kind)
+	if namespace != "" {
+		url = fmt.Sprintf("%s&namespace=%s", url, namespace)
+	}
+	if cursor > 0 {
+		url = fmt.Sprintf("%s&cursor=%d", url, cursor)
+	}
+
+	resp, err := utils.HTTP.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusGone {
+		return errWatchExpired
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("[cmd] unexpected response from manager: %v", decodeErrResponse(resp))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	var data strings.Builder
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if data.Len() == 0 {
+				continue
+			}
+
+			var ev manager.WatchEvent
+			err := json.Unmarshal([]byte(data.String()), &ev)
+			data.Reset()
+			if err != nil {
+				log.Printf("[cmd] unable to decode watch event: %v", err)
+				continue
+			}
+			handle(ev)
+		case strings.HasPrefix(line, "data:"):
+			// the cursor is carried in the event body as well as the id field
+			data.WriteString(strings.TrimSpace(strings.TrimPrefix(line, "data:")))
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+
+	return io.EOF
 }
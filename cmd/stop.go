@@ -29,8 +29,8 @@ var stopCmd = &cobra.Command{
 		}
 
 		manager, _ := cmd.Flags().GetString("manager")
-		url := fmt.Sprintf("http://%s/tasks/%s", manager, args[0])
-		client := &http.Client{}
+		url := fmt.Sprintf("%s://%s/tasks/%s", utils.Scheme, manager, args[0])
+		client := utils.HTTP
 		req, err := http.NewRequest("DELETE", url, nil)
 		if err != nil {
 			log.Printf("[cmd] error creating request %v: %v", url, err)
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/auth"
+)
+
+func init() {
+	adminCmd.AddCommand(adminTokenCmd)
+	adminTokenCmd.Flags().String("secret", "", "File of the secret the manager checks signed tokens with (manager.auth.secret_file)")
+	adminTokenCmd.Flags().String("role", auth.ReadOnly, "Role of the token (\"read-only\", \"submitter\" or \"admin\")")
+	adminTokenCmd.Flags().StringSlice("namespaces", nil, "List (csv) of namespaces the token is limited to (default all)")
+	adminTokenCmd.Flags().Duration("ttl", 0, "How long the token is valid for (default forever)")
+	adminTokenCmd.MarkFlagRequired("secret")
+}
+
+var adminTokenCmd = &cobra.Command{
+	Use:   "token <name>",
+	Short: "Sign an API token for a user of the manager.",
+	Long: `Kanastar admin token command.
+
+	Prints a token for name with the given role, limited to the given
+	namespaces if any, signed with the secret the manager checks tokens
+	with. Hand it to the user, who puts it under client.token in their
+	config file or passes it with --token.`,
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		secretFile, _ := cmd.Flags().GetString("secret")
+		role, _ := cmd.Flags().GetString("role")
+		namespaces, _ := cmd.Flags().GetStringSlice("namespaces")
+		ttl, _ := cmd.Flags().GetDuration("ttl")
+
+		secret, err := auth.LoadSecret(secretFile)
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+
+		token, err := auth.Sign(secret, auth.Identity{Name: args[0], Role: role, Namespaces: namespaces}, ttl)
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+		fmt.Println(token)
+	},
+}
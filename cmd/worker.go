@@ -3,9 +3,13 @@ package cmd
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/config"
+	"github.com/surajsharma/kanastar/datadir"
+	"github.com/surajsharma/kanastar/pki"
 	"github.com/surajsharma/kanastar/utils"
 	"github.com/surajsharma/kanastar/worker"
 )
@@ -19,36 +23,84 @@ var workerCmd = &cobra.Command{
 	The worker runs tasks and responds to the manager's requests about task state.`,
 
 	Run: func(cmd *cobra.Command, args []string) {
+		c := loadConfig(cmd)
+		if printConfig(cmd, c) {
+			return
+		}
 
 		if !utils.IsDockerDaemonUp() {
 			return
 		}
 
-		host, _ := cmd.Flags().GetString("host")
-		port, _ := cmd.Flags().GetInt("port")
-		name, _ := cmd.Flags().GetString("name")
-		dbType, _ := cmd.Flags().GetString("dbtype")
+		wc := c.Worker
+
+		ctx, stop := signalContext()
+		defer stop()
+
+		dir, err := datadir.Open(wc.DataDir, "worker")
+		if err != nil {
+			log.Fatalf("[cmd] %v, give each worker its own --data-dir", err)
+		}
+		defer dir.Close()
+
+		name, err := dir.Identity(wc.Name, func() string {
+			return fmt.Sprintf("worker-%s", uuid.New().String())
+		})
+		if err != nil {
+			log.Fatalf("[cmd] %v", err)
+		}
+
+		w, err := worker.New(name, wc.DbType, dir.Path)
+		if err != nil {
+			log.Fatalf("[cmd] unable to start worker: %v", err)
+		}
+		w.Parallelism = wc.Parallelism
+		w.RunInterval = time.Duration(wc.RunInterval)
+		w.UpdateInterval = time.Duration(wc.UpdateInterval)
+		w.StatsInterval = time.Duration(wc.StatsInterval)
+		w.OrphanPolicy = wc.OrphanPolicy
 
-		w := worker.New(name, dbType)
+		err = w.Recover()
+		if err != nil {
+			log.Printf("[cmd] unable to recover containers of worker %s: %v", w.Name, err)
+		}
 
 		log.Printf("[cmd] starting worker %s", w.Name)
-		api := worker.Api{Address: host, Port: port, Worker: w}
+		api := worker.Api{Address: wc.Host, Port: wc.Port, Worker: w}
+		if c.TLS.Enabled() {
+			api.TLS, err = pki.NodeServerConfig(tlsFiles(c.TLS))
+			if err != nil {
+				w.Close()
+				log.Fatalf("[cmd] %v", err)
+			}
+		}
 
-		go w.RunTasks()
-		go w.CollectStats()
-		go w.UpdateTasks()
+		var l loops
+		l.run(ctx, w.RunTasks)
+		l.run(ctx, w.CollectStats)
+		l.run(ctx, w.UpdateTasks)
+
+		log.Printf("[cmd] starting worker API on %s://%s:%d", utils.Scheme, wc.Host, wc.Port)
+		if !serve(ctx, stop, &api, &l, time.Duration(wc.GracePeriod)) {
+			log.Printf("[cmd] worker %s stopped without closing its store", w.Name)
+			return
+		}
 
-		log.Printf("[cmd] starting worker API on http://%s:%d", host, port)
-		api.Start()
+		w.Close()
+		log.Printf("[cmd] worker %s stopped", w.Name)
 	}}
 
 func init() {
 	rootCmd.AddCommand(workerCmd)
 	workerCmd.Flags().StringP("host", "H", "0.0.0.0", "Hostname or IP address")
 	workerCmd.Flags().IntP("port", "p", 5556, "Port on which to listen")
-	workerCmd.Flags().StringP("name", "n", fmt.Sprintf("worker-%s", uuid.New().String()), "Name of the worker")
-	workerCmd.Flags().Lookup("name").DefValue = "worker-[uuid]"
+	workerCmd.Flags().StringP("name", "n", "", "Name of the worker (default the name kept in the data dir, or worker-[uuid] the first time)")
+	workerCmd.Flags().String("data-dir", ".", "Directory the worker keeps its identity and task database in")
 
 	workerCmd.Flags().StringP("dbtype", "d", "memory", "Type of datastore for tasks (\"memory\" or \"persistent\")")
+	workerCmd.Flags().Duration("gracePeriod", time.Duration(config.Default().Worker.GracePeriod), "How long to wait for task starts and stops in progress when shutting down")
+	workerCmd.Flags().Int("parallelism", worker.DefaultParallelism, "Number of task starts and stops the worker runs at once")
+	workerCmd.Flags().String("orphans", worker.OrphanReport, "What to do on startup with containers of this worker no task accounts for (\"report\", \"stop\" or \"remove\")")
+	workerCmd.Flags().Bool("print-config", false, "Print the effective configuration and exit")
 
 }
@@ -0,0 +1,177 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/docker/go-units"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"github.com/surajsharma/kanastar/utils"
+	"github.com/surajsharma/kanastar/workflow"
+)
+
+func init() {
+	rootCmd.AddCommand(workflowCmd)
+	workflowCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "Manager to talk to")
+
+	workflowCmd.AddCommand(workflowCreateCmd)
+	workflowCreateCmd.Flags().StringP("filename", "f", "workflow.json", "Workflow specification file")
+
+	workflowCmd.AddCommand(workflowRunCmd)
+	workflowRunCmd.Flags().BoolP("wait", "w", false, "Wait for the run to finish, showing its progress")
+
+	workflowCmd.AddCommand(workflowStatusCmd)
+	workflowStatusCmd.Flags().StringP("run", "r", "latest", "ID of the run to show")
+}
+
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "Manage task workflows.",
+	Long: `Kanastar workflow command.
+
+	A workflow is a set of steps, each a task, that start once the steps
+	they depend on have completed.`,
+}
+
+var workflowCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a workflow from a specification file.",
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+
+		data := readSpecFile(filename)
+
+		url := fmt.Sprintf("%s://%s/workflows", utils.Scheme, mgr)
+		resp, err := utils.HTTP.Post(url, "application/json", strings.NewReader(string(data)))
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			log.Fatalf("[cmd] error creating workflow: %v", decodeErrResponse(resp))
+		}
+
+		var wf workflow.Workflow
+		json.NewDecoder(resp.Body).Decode(&wf)
+		log.Printf("[cmd] created workflow %s with %d steps", wf.Name, len(wf.Steps))
+	},
+}
+
+var workflowRunCmd = &cobra.Command{
+	Use:   "run <workflow>",
+	Short: "Start a run of a workflow.",
+
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		wait, _ := cmd.Flags().GetBool("wait")
+
+		url := fmt.Sprintf("%s://%s/workflows/%s/runs", utils.Scheme, mgr, args[0])
+		resp, err := utils.HTTP.Post(url, "application/json", nil)
+		if err != nil {
+			log.Fatalf("[cmd] error connecting to %v: %v", url, err)
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusCreated {
+			log.Fatalf("[cmd] error running workflow %s: %v", args[0], decodeErrResponse(resp))
+		}
+
+		var run workflow.Run
+		json.NewDecoder(resp.Body).Decode(&run)
+		log.Printf("[cmd] started run %v of workflow %s", run.ID, args[0])
+
+		if !wait {
+			return
+		}
+
+		for {
+			time.Sleep(5 * time.Second)
+
+			wf, r := fetchWorkflowRun(mgr, args[0], run.ID.String())
+			fmt.Print("\033[H\033[2J")
+			printWorkflowRun(wf, r)
+
+			if r.State != workflow.RunRunning {
+				return
+			}
+		}
+	},
+}
+
+var workflowStatusCmd = &cobra.Command{
+	Use:   "status <workflow>",
+	Short: "Show the progress of a workflow run.",
+
+	Args: cobra.ExactArgs(1),
+
+	Run: func(cmd *cobra.Command, args []string) {
+		mgr, _ := cmd.Flags().GetString("manager")
+		runID, _ := cmd.Flags().GetString("run")
+
+		wf, r := fetchWorkflowRun(mgr, args[0], runID)
+		printWorkflowRun(wf, r)
+	},
+}
+
+func fetchWorkflowRun(mgr string, name string, runID string) (*workflow.Workflow, *workflow.Run) {
+	var wf workflow.Workflow
+	err := getJSON(fmt.Sprintf("%s://%s/workflows/%s", utils.Scheme, mgr, name), &wf)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var r workflow.Run
+	err = getJSON(fmt.Sprintf("%s://%s/workflows/%s/runs/%s", utils.Scheme, mgr, name, runID), &r)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	return &wf, &r
+}
+
+func printWorkflowRun(wf *workflow.Workflow, r *workflow.Run) {
+	fmt.Printf("Workflow:  %s\n", wf.Name)
+	fmt.Printf("Run:       %s\n", r.ID)
+	fmt.Printf("State:     %s\n", r.State)
+	fmt.Printf("Started:   %s ago\n", units.HumanDuration(time.Since(r.StartTime)))
+	if !r.FinishTime.IsZero() {
+		fmt.Printf("Duration:  %s\n", units.HumanDuration(r.FinishTime.Sub(r.StartTime)))
+	}
+	fmt.Println()
+
+	deps := make(map[string][]string)
+	retries := make(map[string]int)
+	for _, s := range wf.Steps {
+		deps[s.Name] = s.DependsOn
+		retries[s.Name] = s.Retries
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', tabwriter.TabIndent)
+	fmt.Fprintln(w, "STEP\tSTATE\tDEPENDS ON\tATTEMPTS\tTASK\tMESSAGE\t")
+	for _, s := range r.Steps {
+		taskID := "-"
+		if s.TaskID != uuid.Nil {
+			taskID = s.TaskID.String()
+		}
+
+		after := "-"
+		if len(deps[s.Name]) > 0 {
+			after = strings.Join(deps[s.Name], ",")
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%s\t\n", s.Name, s.State, after, s.Attempts, retries[s.Name]+1, taskID, s.Message)
+	}
+	w.Flush()
+}
@@ -0,0 +1,421 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// EnvPrefix starts the environment variables that override the config file,
+// e.g. KANASTAR_MANAGER_RECONCILE_INTERVAL=5s.
+const EnvPrefix = "KANASTAR"
+
+// Duration is a time.Duration written as "10s" or "1m30s" in config files.
+type Duration time.Duration
+
+func (d Duration) String() string { return time.Duration(d).String() }
+
+func (d Duration) MarshalYAML() (interface{}, error) {
+	return d.String(), nil
+}
+
+func (d *Duration) UnmarshalYAML(value *yaml.Node) error {
+	parsed, err := time.ParseDuration(value.Value)
+	if err != nil {
+		return fmt.Errorf("[config] invalid duration %q: %v", value.Value, err)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+type Config struct {
+	Manager   Manager   `yaml:"manager"`
+	Worker    Worker    `yaml:"worker"`
+	Scheduler Scheduler `yaml:"scheduler"`
+	Retry     Retry     `yaml:"retry"`
+	Retention Retention `yaml:"retention"`
+	TLS       TLS       `yaml:"tls"`
+	Client    Client    `yaml:"client"`
+}
+
+type Manager struct {
+	Host                string   `yaml:"host"`
+	Port                int      `yaml:"port"`
+	Workers             []string `yaml:"workers"`
+	Scheduler           string   `yaml:"scheduler"`
+	DbType              string   `yaml:"db_type"`
+	DataDir             string   `yaml:"data_dir"`
+	SchedulerWorkers    int      `yaml:"scheduler_workers"`
+	Preemption          bool     `yaml:"preemption"`
+	GracePeriod         Duration `yaml:"grace_period"`
+	ReconcileInterval   Duration `yaml:"reconcile_interval"`
+	UpdateInterval      Duration `yaml:"update_interval"`
+	HealthCheckInterval Duration `yaml:"health_check_interval"`
+	StatsInterval       Duration `yaml:"stats_interval"`
+	MaxRestarts         int      `yaml:"max_restarts"`
+	MaxWorkerFailures   int      `yaml:"max_worker_failures"`
+	Raft                Raft     `yaml:"raft"`
+	Auth                Auth     `yaml:"auth"`
+	// Quotas caps what the unfinished tasks of each namespace may ask for
+	Quotas map[string]Quota `yaml:"quotas"`
+}
+
+// Quota caps the total memory and disk, in bytes like those of tasks, the
+// CPUs and the number of tasks of a namespace. Zero means no limit.
+type Quota struct {
+	Memory int64   `yaml:"memory"`
+	Disk   int64   `yaml:"disk"`
+	Cpu    float64 `yaml:"cpu"`
+	Tasks  int     `yaml:"tasks"`
+}
+
+// Auth makes the manager API require a token with every request. It is off
+// while both TokensFile and SecretFile are empty.
+type Auth struct {
+	// TokensFile lists static tokens with the name and role of each
+	TokensFile string `yaml:"tokens_file"`
+	// SecretFile holds the secret of the tokens signed by kanactl admin token
+	SecretFile string `yaml:"secret_file"`
+	// AuditLog is the file the audit records go to, instead of the log
+	AuditLog string `yaml:"audit_log"`
+}
+
+// Enabled reports whether tokens are required.
+func (a Auth) Enabled() bool {
+	return a.TokensFile != "" || a.SecretFile != ""
+}
+
+// Raft makes the manager one of a group of managers that replicate their
+// state and elect a leader. It is off while Bind is empty.
+type Raft struct {
+	// Bind is the address the manager talks Raft on
+	Bind string `yaml:"bind"`
+	// Advertise is the address the other managers reach this one's API on,
+	// which also names it in the group
+	Advertise string `yaml:"advertise"`
+	// Peers lists every manager of the group, this one included, as
+	// <api address>=<raft address>
+	Peers []string `yaml:"peers"`
+}
+
+// PeerMap returns the peers keyed by API address.
+func (r Raft) PeerMap() (map[string]string, error) {
+	peers := make(map[string]string, len(r.Peers))
+	for _, p := range r.Peers {
+		api, raft, ok := strings.Cut(p, "=")
+		if !ok || api == "" || raft == "" {
+			return nil, fmt.Errorf("[config] manager.raft.peers entry %q must be <api address>=<raft address>", p)
+		}
+		peers[api] = raft
+	}
+	return peers, nil
+}
+
+type Worker struct {
+	Host           string   `yaml:"host"`
+	Port           int      `yaml:"port"`
+	Name           string   `yaml:"name"`
+	DbType         string   `yaml:"db_type"`
+	DataDir        string   `yaml:"data_dir"`
+	Parallelism    int      `yaml:"parallelism"`
+	GracePeriod    Duration `yaml:"grace_period"`
+	RunInterval    Duration `yaml:"run_interval"`
+	UpdateInterval Duration `yaml:"update_interval"`
+	StatsInterval  Duration `yaml:"stats_interval"`
+	// what to do with containers of the worker no task accounts for when
+	// it starts: report, stop or remove them
+	OrphanPolicy string `yaml:"orphan_policy"`
+}
+
+// TLS names the PEM files the manager, workers and kanactl authenticate each
+// other with. The APIs are plain HTTP while all of them are empty.
+type TLS struct {
+	// CA is the certificate of the cluster CA, which signs all the others
+	CA   string `yaml:"ca"`
+	Cert string `yaml:"cert"`
+	Key  string `yaml:"key"`
+}
+
+// Enabled reports whether any of the files is set.
+func (t TLS) Enabled() bool {
+	return t.CA != "" || t.Cert != "" || t.Key != ""
+}
+
+// Client holds the settings of kanactl's own commands.
+type Client struct {
+	// Token authenticates kanactl to a manager that requires tokens
+	Token string `yaml:"token"`
+}
+
+type Scheduler struct {
+	// how long the scorers wait between the two CPU samples of a node
+	CpuSampleInterval Duration `yaml:"cpu_sample_interval"`
+}
+
+// Retention says how long the manager keeps finished tasks and task events,
+// and how many of each. Zero means no limit.
+type Retention struct {
+	Interval Duration `yaml:"interval"`
+	Tasks    Policy   `yaml:"tasks"`
+	Events   Policy   `yaml:"events"`
+}
+
+type Policy struct {
+	TTL      Duration `yaml:"ttl"`
+	MaxCount int      `yaml:"max_count"`
+}
+
+type Retry struct {
+	Attempts int      `yaml:"attempts"`
+	Delay    Duration `yaml:"delay"`
+}
+
+func Default() Config {
+	return Config{
+		Manager: Manager{
+			Host:                "0.0.0.0",
+			Port:                5555,
+			Workers:             []string{"localhost:5556"},
+			Scheduler:           "epvm",
+			DbType:              "memory",
+			DataDir:             ".",
+			SchedulerWorkers:    4,
+			GracePeriod:         Duration(30 * time.Second),
+			ReconcileInterval:   Duration(10 * time.Second),
+			UpdateInterval:      Duration(10 * time.Second),
+			HealthCheckInterval: Duration(60 * time.Second),
+			StatsInterval:       Duration(15 * time.Second),
+			MaxRestarts:         3,
+			MaxWorkerFailures:   3,
+		},
+		Worker: Worker{
+			Host:           "0.0.0.0",
+			Port:           5556,
+			DbType:         "memory",
+			DataDir:        ".",
+			Parallelism:    4,
+			GracePeriod:    Duration(30 * time.Second),
+			RunInterval:    Duration(10 * time.Second),
+			UpdateInterval: Duration(10 * time.Second),
+			StatsInterval:  Duration(15 * time.Second),
+			OrphanPolicy:   "report",
+		},
+		Scheduler: Scheduler{
+			CpuSampleInterval: Duration(3 * time.Second),
+		},
+		Retry: Retry{
+			Attempts: 10,
+			Delay:    Duration(5 * time.Second),
+		},
+		Retention: Retention{
+			Interval: Duration(5 * time.Minute),
+			Tasks:    Policy{TTL: Duration(7 * 24 * time.Hour), MaxCount: 1000},
+			Events:   Policy{TTL: Duration(7 * 24 * time.Hour), MaxCount: 10000},
+		},
+	}
+}
+
+// DefaultPath is where Load looks for a config file when none is given.
+func DefaultPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return home + "/.kanastar.yaml"
+}
+
+// Load returns the defaults overlaid with the config file at path and then
+// with any KANASTAR_* environment variables. A missing file is only an error
+// if the path was given explicitly.
+func Load(path string) (Config, error) {
+	c := Default()
+
+	explicit := path != ""
+	if !explicit {
+		path = DefaultPath()
+	}
+
+	if path != "" {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			err = yaml.Unmarshal(data, &c)
+			if err != nil {
+				return c, fmt.Errorf("[config] unable to parse %s: %v", path, err)
+			}
+		case explicit || !errors.Is(err, os.ErrNotExist):
+			return c, fmt.Errorf("[config] unable to read %s: %v", path, err)
+		}
+	}
+
+	err := applyEnv(reflect.ValueOf(&c).Elem(), EnvPrefix)
+	if err != nil {
+		return c, err
+	}
+
+	return c, nil
+}
+
+// applyEnv sets every field of v that has a matching environment variable,
+// named after the yaml keys leading to it.
+func applyEnv(v reflect.Value, prefix string) error {
+	t := v.Type()
+
+	for i := 0; i < t.NumField(); i++ {
+		field := v.Field(i)
+		key := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+		name := prefix + "_" + strings.ToUpper(key)
+
+		if field.Kind() == reflect.Struct {
+			err := applyEnv(field, name)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+
+		err := setField(field, value)
+		if err != nil {
+			return fmt.Errorf("[config] invalid value for %s: %v", name, err)
+		}
+	}
+
+	return nil
+}
+
+func setField(field reflect.Value, value string) error {
+	switch field.Interface().(type) {
+	case Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.Set(reflect.ValueOf(Duration(d)))
+	case string:
+		field.SetString(value)
+	case int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(n))
+	case bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case []string:
+		field.Set(reflect.ValueOf(strings.Split(value, ",")))
+	default:
+		return fmt.Errorf("unsupported type %v", field.Type())
+	}
+	return nil
+}
+
+// Validate reports every setting that is out of range, not just the first.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("[config] "+format, args...))
+		}
+	}
+
+	m := c.Manager
+	check(validPort(m.Port), "manager.port %d is not a valid port", m.Port)
+	check(len(m.Workers) > 0, "manager.workers must list at least one worker")
+	check(oneOf(m.Scheduler, "epvm", "roundrobin", "greedy"), "manager.scheduler %q must be one of epvm, roundrobin or greedy", m.Scheduler)
+	check(oneOf(m.DbType, "memory", "persistent", "sqlite"), "manager.db_type %q must be memory, persistent or sqlite", m.DbType)
+	check(m.DataDir != "", "manager.data_dir must not be empty")
+	check(m.SchedulerWorkers >= 1, "manager.scheduler_workers must be at least 1")
+	check(m.GracePeriod >= 0, "manager.grace_period must not be negative")
+	check(m.ReconcileInterval > 0, "manager.reconcile_interval must be positive")
+	check(m.UpdateInterval > 0, "manager.update_interval must be positive")
+	check(m.HealthCheckInterval > 0, "manager.health_check_interval must be positive")
+	check(m.StatsInterval > 0, "manager.stats_interval must be positive")
+	check(m.MaxRestarts >= 0, "manager.max_restarts must not be negative")
+	check(m.MaxWorkerFailures >= 1, "manager.max_worker_failures must be at least 1")
+	if m.Raft.Bind != "" {
+		check(m.Raft.Advertise != "", "manager.raft.advertise must be set when manager.raft.bind is")
+		peers, err := m.Raft.PeerMap()
+		if err != nil {
+			errs = append(errs, err)
+		}
+		_, listed := peers[m.Raft.Advertise]
+		check(len(peers) == 0 || listed, "manager.raft.peers must include this manager, %s", m.Raft.Advertise)
+	}
+
+	for name, q := range m.Quotas {
+		check(q.Memory >= 0 && q.Disk >= 0 && q.Cpu >= 0 && q.Tasks >= 0, "manager.quotas.%s must not be negative", name)
+	}
+
+	w := c.Worker
+	check(validPort(w.Port), "worker.port %d is not a valid port", w.Port)
+	check(oneOf(w.DbType, "memory", "persistent"), "worker.db_type %q must be memory or persistent", w.DbType)
+	check(w.DataDir != "", "worker.data_dir must not be empty")
+	check(w.Parallelism >= 1, "worker.parallelism must be at least 1")
+	check(w.GracePeriod >= 0, "worker.grace_period must not be negative")
+	check(w.RunInterval > 0, "worker.run_interval must be positive")
+	check(w.UpdateInterval > 0, "worker.update_interval must be positive")
+	check(w.StatsInterval > 0, "worker.stats_interval must be positive")
+	check(oneOf(w.OrphanPolicy, "report", "stop", "remove"), "worker.orphan_policy %q must be report, stop or remove", w.OrphanPolicy)
+
+	check(c.Scheduler.CpuSampleInterval > 0, "scheduler.cpu_sample_interval must be positive")
+	check(c.Retry.Attempts >= 1, "retry.attempts must be at least 1")
+	check(c.Retry.Delay >= 0, "retry.delay must not be negative")
+
+	t := c.TLS
+	check(!t.Enabled() || (t.CA != "" && t.Cert != "" && t.Key != ""), "tls.ca, tls.cert and tls.key must all be set, or none of them")
+
+	r := c.Retention
+	check(r.Interval > 0, "retention.interval must be positive")
+	check(r.Tasks.TTL >= 0, "retention.tasks.ttl must not be negative")
+	check(r.Tasks.MaxCount >= 0, "retention.tasks.max_count must not be negative")
+	check(r.Events.TTL >= 0, "retention.events.ttl must not be negative")
+	check(r.Events.MaxCount >= 0, "retention.events.max_count must not be negative")
+
+	return errors.Join(errs...)
+}
+
+// YAML renders the config as it would be written in a config file.
+func (c Config) YAML() (string, error) {
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return "", fmt.Errorf("[config] unable to render config: %v", err)
+	}
+	return string(data), nil
+}
+
+// Redacted returns a copy of the config with the secrets it holds, as
+// opposed to the files they are kept in, replaced, for printing it.
+func (c Config) Redacted() Config {
+	if c.Client.Token != "" {
+		c.Client.Token = "REDACTED"
+	}
+	return c
+}
+
+func validPort(p int) bool {
+	return p > 0 && p < 65536
+}
+
+func oneOf(s string, options ...string) bool {
+	for _, o := range options {
+		if s == o {
+			return true
+		}
+	}
+	return false
+}
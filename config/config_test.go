@@ -0,0 +1,224 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(c *Config)
+		// substrings of the errors, none when the config is valid
+		errs []string
+	}{
+		{"defaults", func(c *Config) {}, nil},
+		{"port zero", func(c *Config) { c.Manager.Port = 0 }, []string{"manager.port 0"}},
+		{"port too big", func(c *Config) { c.Worker.Port = 65536 }, []string{"worker.port 65536"}},
+		{"no workers", func(c *Config) { c.Manager.Workers = nil }, []string{"manager.workers"}},
+		{"unknown scheduler", func(c *Config) { c.Manager.Scheduler = "random" }, []string{`manager.scheduler "random"`}},
+		{"sqlite manager", func(c *Config) { c.Manager.DbType = "sqlite" }, nil},
+		{"sqlite worker", func(c *Config) { c.Worker.DbType = "sqlite" }, []string{`worker.db_type "sqlite"`}},
+		{"no scheduler workers", func(c *Config) { c.Manager.SchedulerWorkers = 0 }, []string{"manager.scheduler_workers"}},
+		{"zero grace period", func(c *Config) { c.Manager.GracePeriod = 0 }, nil},
+		{"negative grace period", func(c *Config) { c.Worker.GracePeriod = Duration(-time.Second) }, []string{"worker.grace_period"}},
+		{"zero interval", func(c *Config) { c.Manager.ReconcileInterval = 0 }, []string{"manager.reconcile_interval"}},
+		{"unknown orphan policy", func(c *Config) { c.Worker.OrphanPolicy = "ignore" }, []string{`worker.orphan_policy "ignore"`}},
+		{"negative quota", func(c *Config) { c.Manager.Quotas = map[string]Quota{"team": {Cpu: -1}} }, []string{"manager.quotas.team"}},
+		{"partial tls", func(c *Config) { c.TLS.CA = "ca.pem" }, []string{"tls.ca, tls.cert and tls.key"}},
+		{"full tls", func(c *Config) { c.TLS = TLS{CA: "ca.pem", Cert: "cert.pem", Key: "key.pem"} }, nil},
+		{"negative retention", func(c *Config) { c.Retention.Events.MaxCount = -1 }, []string{"retention.events.max_count"}},
+		{"raft", func(c *Config) {
+			c.Manager.Raft = Raft{Bind: ":7000", Advertise: "a:5555", Peers: []string{"a:5555=a:7000", "b:5555=b:7000"}}
+		}, nil},
+		{"raft without advertise", func(c *Config) { c.Manager.Raft.Bind = ":7000" }, []string{"manager.raft.advertise"}},
+		{"raft peers without self", func(c *Config) {
+			c.Manager.Raft = Raft{Bind: ":7000", Advertise: "a:5555", Peers: []string{"b:5555=b:7000"}}
+		}, []string{"manager.raft.peers must include this manager"}},
+		{"malformed raft peer", func(c *Config) {
+			c.Manager.Raft = Raft{Bind: ":7000", Advertise: "a:5555", Peers: []string{"b:5555"}}
+		}, []string{`entry "b:5555"`}},
+		{"every error", func(c *Config) {
+			c.Manager.Port = -1
+			c.Retry.Attempts = 0
+			c.Scheduler.CpuSampleInterval = 0
+		}, []string{"manager.port -1", "retry.attempts", "scheduler.cpu_sample_interval"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Default()
+			tt.edit(&c)
+
+			err := c.Validate()
+			if len(tt.errs) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("expected errors mentioning %q", tt.errs)
+			}
+			for _, want := range tt.errs {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not mention %q", err, want)
+				}
+			}
+			if n := strings.Count(err.Error(), "[config]"); n != len(tt.errs) {
+				t.Errorf("got %d errors, want %d: %v", n, len(tt.errs), err)
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		env  map[string]string
+		edit func(c *Config)
+		err  string
+	}{
+		{
+			name: "defaults",
+			edit: func(c *Config) {},
+		},
+		{
+			name: "file",
+			file: "manager:\n  port: 6000\n  grace_period: 1m30s\n",
+			edit: func(c *Config) {
+				c.Manager.Port = 6000
+				c.Manager.GracePeriod = Duration(90 * time.Second)
+			},
+		},
+		{
+			name: "env over file",
+			file: "manager:\n  port: 6000\n",
+			env:  map[string]string{"KANASTAR_MANAGER_PORT": "7000"},
+			edit: func(c *Config) { c.Manager.Port = 7000 },
+		},
+		{
+			name: "env of each type",
+			env: map[string]string{
+				"KANASTAR_MANAGER_RECONCILE_INTERVAL": "5s",
+				"KANASTAR_MANAGER_PREEMPTION":         "true",
+				"KANASTAR_MANAGER_WORKERS":            "w1:5556,w2:5556",
+				"KANASTAR_MANAGER_RAFT_BIND":          ":7000",
+				"KANASTAR_RETENTION_TASKS_MAX_COUNT":  "50",
+				"KANASTAR_CLIENT_TOKEN":               "secret",
+			},
+			edit: func(c *Config) {
+				c.Manager.ReconcileInterval = Duration(5 * time.Second)
+				c.Manager.Preemption = true
+				c.Manager.Workers = []string{"w1:5556", "w2:5556"}
+				c.Manager.Raft.Bind = ":7000"
+				c.Retention.Tasks.MaxCount = 50
+				c.Client.Token = "secret"
+			},
+		},
+		{
+			name: "invalid env duration",
+			env:  map[string]string{"KANASTAR_WORKER_RUN_INTERVAL": "soon"},
+			err:  "KANASTAR_WORKER_RUN_INTERVAL",
+		},
+		{
+			name: "invalid env int",
+			env:  map[string]string{"KANASTAR_WORKER_PORT": "http"},
+			err:  "KANASTAR_WORKER_PORT",
+		},
+		{
+			name: "unsupported env type",
+			env:  map[string]string{"KANASTAR_MANAGER_QUOTAS": "team"},
+			err:  "unsupported type",
+		},
+		{
+			name: "invalid file duration",
+			file: "worker:\n  run_interval: soon\n",
+			err:  "unable to parse",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := ""
+			if tt.file != "" {
+				path = filepath.Join(t.TempDir(), "kanastar.yaml")
+				err := os.WriteFile(path, []byte(tt.file), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			// keep a config file in the real home directory out of the test
+			t.Setenv("HOME", t.TempDir())
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+
+			c, err := Load(path)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("expected an error mentioning %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			want := Default()
+			tt.edit(&want)
+			if !reflect.DeepEqual(c, want) {
+				t.Errorf("got %+v, want %+v", c, want)
+			}
+		})
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+
+	_, err := Load("")
+	if err != nil {
+		t.Errorf("a missing default file should not be an error: %v", err)
+	}
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err == nil {
+		t.Error("expected an error for a missing file given explicitly")
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	c := Default()
+	c.Client.Token = "secret"
+	c.Manager.Auth = Auth{TokensFile: "tokens.yaml", SecretFile: "secret.key"}
+	c.TLS = TLS{CA: "ca.pem", Cert: "cert.pem", Key: "key.pem"}
+
+	r := c.Redacted()
+	if r.Client.Token != "REDACTED" {
+		t.Errorf("token %q was not redacted", r.Client.Token)
+	}
+	if c.Client.Token != "secret" {
+		t.Error("Redacted changed the original config")
+	}
+	if r.Manager.Auth != c.Manager.Auth || r.TLS != c.TLS {
+		t.Error("the paths of files holding secrets should be kept")
+	}
+
+	out, err := r.YAML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(out, "secret\n") {
+		t.Errorf("rendered config holds the token:\n%s", out)
+	}
+
+	if Default().Redacted().Client.Token != "" {
+		t.Error("an empty token should stay empty")
+	}
+}
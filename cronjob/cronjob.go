@@ -0,0 +1,260 @@
+package cronjob
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/robfig/cron/v3"
+	"github.com/surajsharma/kanastar/task"
+)
+
+const (
+	ConcurrencyAllow   = "allow"
+	ConcurrencyForbid  = "forbid"
+	ConcurrencyReplace = "replace"
+
+	MissedRunOnce = "once"
+	MissedRunSkip = "skip"
+
+	defaultSuccessfulHistoryLimit = 3
+	defaultFailedHistoryLimit     = 1
+
+	// MaxMissedCount is how many missed times Due steps through one by
+	// one, so a job that fires often is quick to evaluate after a long
+	// downtime. More missed times are not counted.
+	MaxMissedCount = 1000
+)
+
+var parser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+// CronJob creates a task from Template every time Schedule fires.
+//
+// ConcurrencyPolicy decides what happens when a run is due while an earlier
+// one is still active. MissedRuns decides what happens to runs that fell due
+// while the manager was down: "once" starts a single catch-up run if the
+// latest missed time is within StartingDeadline seconds (0 means no limit),
+// "skip" waits for the next scheduled time.
+type CronJob struct {
+	ID                     uuid.UUID
+	Name                   string
+	Schedule               string
+	TimeZone               string
+	ConcurrencyPolicy      string
+	MissedRuns             string
+	StartingDeadline       int
+	SuccessfulHistoryLimit int
+	FailedHistoryLimit     int
+	Suspend                bool
+	Template               task.Task
+	LastScheduleTime       time.Time
+	Active                 []Run
+	History                []Run
+	CreatedAt              time.Time
+}
+
+type Run struct {
+	TaskID        uuid.UUID
+	ScheduledTime time.Time
+	State         task.State
+	FinishTime    time.Time
+}
+
+func (c *CronJob) SetDefaults() {
+	if c.ConcurrencyPolicy == "" {
+		c.ConcurrencyPolicy = ConcurrencyAllow
+	}
+
+	if c.MissedRuns == "" {
+		c.MissedRuns = MissedRunOnce
+	}
+
+	if c.SuccessfulHistoryLimit == 0 {
+		c.SuccessfulHistoryLimit = defaultSuccessfulHistoryLimit
+	}
+
+	if c.FailedHistoryLimit == 0 {
+		c.FailedHistoryLimit = defaultFailedHistoryLimit
+	}
+}
+
+func (c *CronJob) Validate() error {
+	if c.Name == "" {
+		return errors.New("[cronjob] name is required")
+	}
+
+	if c.Template.Image == "" {
+		return errors.New("[cronjob] template image is required")
+	}
+
+	_, err := c.location()
+	if err != nil {
+		return err
+	}
+
+	_, err = parser.Parse(c.Schedule)
+	if err != nil {
+		return fmt.Errorf("[cronjob] invalid schedule %q: %v", c.Schedule, err)
+	}
+
+	switch c.ConcurrencyPolicy {
+	case ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		return fmt.Errorf("[cronjob] unknown concurrency policy %q", c.ConcurrencyPolicy)
+	}
+
+	switch c.MissedRuns {
+	case MissedRunOnce, MissedRunSkip:
+	default:
+		return fmt.Errorf("[cronjob] unknown missed run policy %q", c.MissedRuns)
+	}
+
+	if c.StartingDeadline < 0 || c.SuccessfulHistoryLimit < 0 || c.FailedHistoryLimit < 0 {
+		return errors.New("[cronjob] deadlines and history limits must not be negative")
+	}
+
+	return nil
+}
+
+func (c *CronJob) location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.UTC, nil
+	}
+
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("[cronjob] unknown time zone %q: %v", c.TimeZone, err)
+	}
+
+	return loc, nil
+}
+
+// Due returns the most recent time the schedule fired after the last run and
+// up to now, and how many such times were missed before it, up to
+// MaxMissedCount. With a StartingDeadline only the times within it are
+// looked at, the earlier ones could not be started anyway. A zero time means
+// nothing is due.
+func (c *CronJob) Due(now time.Time) (time.Time, int, error) {
+	loc, err := c.location()
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	sched, err := parser.Parse(c.Schedule)
+	if err != nil {
+		return time.Time{}, 0, err
+	}
+
+	last := c.LastScheduleTime
+	if last.IsZero() {
+		last = c.CreatedAt
+	}
+
+	start := last.In(loc)
+	if c.StartingDeadline > 0 {
+		horizon := now.Add(-time.Duration(c.StartingDeadline) * time.Second).In(loc)
+		if start.Before(horizon) {
+			start = horizon
+		}
+	}
+
+	var latest time.Time
+	missed := 0
+
+	// Next returns the zero time for a schedule that never fires
+	for next := sched.Next(start); !next.IsZero() && !next.After(now); next = sched.Next(next) {
+		if missed == MaxMissedCount {
+			return latestBefore(sched, latest, now), missed, nil
+		}
+		if !latest.IsZero() {
+			missed++
+		}
+		latest = next
+	}
+
+	return latest, missed, nil
+}
+
+// latestBefore returns the last time sched fires after start and up to now.
+// It looks back from now over ever longer spans rather than stepping through
+// every time since start.
+func latestBefore(sched cron.Schedule, start time.Time, now time.Time) time.Time {
+	for span := time.Minute; ; span *= 2 {
+		from := now.Add(-span).In(start.Location())
+		if !from.After(start) {
+			from = start
+		}
+
+		var latest time.Time
+		for next := sched.Next(from); !next.IsZero() && !next.After(now); next = sched.Next(next) {
+			latest = next
+		}
+		if !latest.IsZero() || from.Equal(start) {
+			return latest
+		}
+	}
+}
+
+// Next returns the next time the schedule fires after now.
+func (c *CronJob) Next(now time.Time) time.Time {
+	loc, err := c.location()
+	if err != nil {
+		return time.Time{}
+	}
+
+	sched, err := parser.Parse(c.Schedule)
+	if err != nil {
+		return time.Time{}
+	}
+
+	return sched.Next(now.In(loc))
+}
+
+func (c *CronJob) NewTask(scheduled time.Time) task.Task {
+	t := c.Template
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%d", c.Name, scheduled.Unix())
+	t.CronJob = c.Name
+	t.State = task.Pending
+	t.ContainerID = ""
+	t.HostPorts = nil
+	t.RestartCount = 0
+	t.StartTime = time.Time{}
+	t.FinishTime = time.Time{}
+	return t
+}
+
+// RecordFinished moves a finished run from Active into History and trims the
+// history to the configured limits.
+func (c *CronJob) RecordFinished(id uuid.UUID, state task.State, finished time.Time) {
+	for i, run := range c.Active {
+		if run.TaskID == id {
+			c.Active = append(c.Active[:i:i], c.Active[i+1:]...)
+			run.State = state
+			run.FinishTime = finished
+			c.History = append(c.History, run)
+			break
+		}
+	}
+
+	var kept []Run
+	succeeded, failed := 0, 0
+	for i := len(c.History) - 1; i >= 0; i-- {
+		r := c.History[i]
+		if r.State == task.Completed {
+			if succeeded >= c.SuccessfulHistoryLimit {
+				continue
+			}
+			succeeded++
+		} else {
+			if failed >= c.FailedHistoryLimit {
+				continue
+			}
+			failed++
+		}
+		kept = append([]Run{r}, kept...)
+	}
+
+	c.History = kept
+}
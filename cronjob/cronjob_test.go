@@ -0,0 +1,230 @@
+package cronjob
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/task"
+)
+
+func at(s string) time.Time {
+	t, err := time.Parse(time.RFC3339, s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() CronJob {
+		c := CronJob{Name: "backup", Schedule: "*/5 * * * *", Template: task.Task{Image: "busybox"}}
+		c.SetDefaults()
+		return c
+	}
+
+	tests := []struct {
+		name  string
+		edit  func(c *CronJob)
+		valid bool
+	}{
+		{"five fields", func(c *CronJob) {}, true},
+		{"descriptor", func(c *CronJob) { c.Schedule = "@hourly" }, true},
+		{"ranges and lists", func(c *CronJob) { c.Schedule = "0,30 9-17 * * mon-fri" }, true},
+		{"time zone", func(c *CronJob) { c.TimeZone = "Europe/Berlin" }, true},
+		{"too few fields", func(c *CronJob) { c.Schedule = "* * *" }, false},
+		{"seconds field", func(c *CronJob) { c.Schedule = "0 * * * * *" }, false},
+		{"minute out of range", func(c *CronJob) { c.Schedule = "61 * * * *" }, false},
+		{"empty schedule", func(c *CronJob) { c.Schedule = "" }, false},
+		{"unknown time zone", func(c *CronJob) { c.TimeZone = "Mars/Olympus" }, false},
+		{"no name", func(c *CronJob) { c.Name = "" }, false},
+		{"no image", func(c *CronJob) { c.Template.Image = "" }, false},
+		{"unknown concurrency policy", func(c *CronJob) { c.ConcurrencyPolicy = "queue" }, false},
+		{"unknown missed run policy", func(c *CronJob) { c.MissedRuns = "all" }, false},
+		{"negative deadline", func(c *CronJob) { c.StartingDeadline = -1 }, false},
+		{"negative history limit", func(c *CronJob) { c.FailedHistoryLimit = -1 }, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.edit(&c)
+			err := c.Validate()
+			if tt.valid && err != nil {
+				t.Fatalf("rejected: %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Fatal("accepted")
+			}
+		})
+	}
+}
+
+func TestDue(t *testing.T) {
+	tests := []struct {
+		name   string
+		job    CronJob
+		now    time.Time
+		due    time.Time
+		missed int
+	}{
+		{
+			name: "not yet due",
+			job:  CronJob{Schedule: "0 * * * *", LastScheduleTime: at("2024-03-04T10:00:00Z")},
+			now:  at("2024-03-04T10:59:59Z"),
+		},
+		{
+			name: "due on the minute",
+			job:  CronJob{Schedule: "0 * * * *", LastScheduleTime: at("2024-03-04T10:00:00Z")},
+			now:  at("2024-03-04T11:00:00Z"),
+			due:  at("2024-03-04T11:00:00Z"),
+		},
+		{
+			name:   "missed runs are counted",
+			job:    CronJob{Schedule: "0 * * * *", LastScheduleTime: at("2024-03-04T10:00:00Z")},
+			now:    at("2024-03-04T13:30:00Z"),
+			due:    at("2024-03-04T13:00:00Z"),
+			missed: 2,
+		},
+		{
+			name: "created but never run",
+			job:  CronJob{Schedule: "@daily", CreatedAt: at("2024-03-04T10:00:00Z")},
+			now:  at("2024-03-05T08:00:00Z"),
+			due:  at("2024-03-05T00:00:00Z"),
+		},
+		{
+			name: "time zone",
+			job:  CronJob{Schedule: "0 9 * * *", TimeZone: "America/New_York", LastScheduleTime: at("2024-01-01T00:00:00Z")},
+			now:  at("2024-01-01T14:30:00Z"),
+			due:  at("2024-01-01T14:00:00Z"),
+		},
+		{
+			name: "time zone in summer time",
+			job:  CronJob{Schedule: "0 9 * * *", TimeZone: "America/New_York", LastScheduleTime: at("2024-07-01T00:00:00Z")},
+			now:  at("2024-07-01T13:30:00Z"),
+			due:  at("2024-07-01T13:00:00Z"),
+		},
+		{
+			name:   "starting deadline bounds the runs looked at",
+			job:    CronJob{Schedule: "*/5 * * * *", StartingDeadline: 3600, LastScheduleTime: at("2024-02-26T12:00:00Z")},
+			now:    at("2024-03-04T12:02:00Z"),
+			due:    at("2024-03-04T12:00:00Z"),
+			missed: 11,
+		},
+		{
+			name: "nothing within the starting deadline",
+			job:  CronJob{Schedule: "0 0 * * *", StartingDeadline: 60, LastScheduleTime: at("2024-02-26T00:00:00Z")},
+			now:  at("2024-03-04T12:00:00Z"),
+		},
+		{
+			name:   "a week of every minute",
+			job:    CronJob{Schedule: "* * * * *", LastScheduleTime: at("2024-02-26T12:00:00Z")},
+			now:    at("2024-03-04T12:00:30Z"),
+			due:    at("2024-03-04T12:00:00Z"),
+			missed: MaxMissedCount,
+		},
+		{
+			name:   "weekday minutes over a weekend",
+			job:    CronJob{Schedule: "* * * * 1-5", LastScheduleTime: at("2024-02-26T00:00:00Z")},
+			now:    at("2024-03-02T12:00:00Z"),
+			due:    at("2024-03-01T23:59:00Z"),
+			missed: MaxMissedCount,
+		},
+		{
+			name: "never fires",
+			job:  CronJob{Schedule: "0 0 30 2 *", LastScheduleTime: at("2024-01-01T00:00:00Z")},
+			now:  at("2024-03-04T12:00:00Z"),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due, missed, err := tt.job.Due(tt.now)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !due.Equal(tt.due) {
+				t.Fatalf("due %v, want %v", due.UTC(), tt.due)
+			}
+			if missed != tt.missed {
+				t.Fatalf("missed %d, want %d", missed, tt.missed)
+			}
+		})
+	}
+}
+
+func TestDueInvalidSchedule(t *testing.T) {
+	for _, c := range []CronJob{{Schedule: "nope"}, {Schedule: "* * * * *", TimeZone: "Mars/Olympus"}} {
+		if _, _, err := c.Due(at("2024-03-04T12:00:00Z")); err == nil {
+			t.Fatalf("%+v: no error", c)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	tests := []struct {
+		schedule string
+		zone     string
+		now      time.Time
+		next     time.Time
+	}{
+		{"0 * * * *", "", at("2024-03-04T10:00:00Z"), at("2024-03-04T11:00:00Z")},
+		{"0 * * * *", "", at("2024-03-04T10:59:59Z"), at("2024-03-04T11:00:00Z")},
+		{"30 2 * * *", "Europe/Berlin", at("2024-03-04T10:00:00Z"), at("2024-03-05T01:30:00Z")},
+		{"@monthly", "", at("2024-12-15T00:00:00Z"), at("2025-01-01T00:00:00Z")},
+		{"not a schedule", "", at("2024-03-04T10:00:00Z"), time.Time{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.schedule, func(t *testing.T) {
+			c := CronJob{Schedule: tt.schedule, TimeZone: tt.zone}
+			if next := c.Next(tt.now); !next.Equal(tt.next) {
+				t.Fatalf("next %v, want %v", next.UTC(), tt.next)
+			}
+		})
+	}
+}
+
+func TestRecordFinished(t *testing.T) {
+	c := CronJob{SuccessfulHistoryLimit: 2, FailedHistoryLimit: 1}
+
+	start := at("2024-03-04T00:00:00Z")
+	var ids []uuid.UUID
+	for i := 0; i < 6; i++ {
+		id := uuid.New()
+		ids = append(ids, id)
+		c.Active = append(c.Active, Run{TaskID: id, ScheduledTime: start.Add(time.Duration(i) * time.Hour), State: task.Running})
+	}
+
+	states := []task.State{task.Completed, task.Failed, task.Completed, task.Failed, task.Completed, task.Completed}
+	// finish all but the last, out of order
+	for _, i := range []int{1, 0, 2, 4, 3} {
+		c.RecordFinished(ids[i], states[i], start.Add(time.Duration(i)*time.Hour+time.Minute))
+	}
+
+	if len(c.Active) != 1 || c.Active[0].TaskID != ids[5] {
+		t.Fatalf("active runs %+v, want only the unfinished one", c.Active)
+	}
+
+	// the most recently finished are kept, in the order they finished
+	want := []string{fmt.Sprint(ids[2], task.Completed), fmt.Sprint(ids[4], task.Completed), fmt.Sprint(ids[3], task.Failed)}
+	var got []string
+	for _, r := range c.History {
+		got = append(got, fmt.Sprint(r.TaskID, r.State))
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Fatalf("history %v, want %v", got, want)
+	}
+
+	// an unknown run only trims
+	c.FailedHistoryLimit = 0
+	c.SuccessfulHistoryLimit = 1
+	c.RecordFinished(uuid.New(), task.Completed, start)
+	if len(c.History) != 1 || c.History[0].TaskID != ids[4] {
+		t.Fatalf("history %+v, want the latest success", c.History)
+	}
+	if len(c.Active) != 1 {
+		t.Fatal("an unknown run changed the active runs")
+	}
+}
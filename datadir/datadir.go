@@ -0,0 +1,106 @@
+package datadir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ErrLocked is returned by Open when another process holds the directory.
+var ErrLocked = errors.New("[datadir] data directory is in use")
+
+// Dir is a data directory held by one process of a role, e.g. the manager
+// or a worker. Processes of different roles may share a directory; two of
+// the same role may not.
+type Dir struct {
+	Path string
+	role string
+	lock *os.File
+}
+
+// Open creates the directory if needed and takes its lock for role.
+func Open(path string, role string) (*Dir, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return nil, fmt.Errorf("[datadir] invalid data directory %s: %v", path, err)
+	}
+
+	err = os.MkdirAll(abs, 0700)
+	if err != nil {
+		return nil, fmt.Errorf("[datadir] unable to create data directory %s: %v", abs, err)
+	}
+
+	name := filepath.Join(abs, role+".lock")
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("[datadir] unable to open %s: %v", name, err)
+	}
+
+	err = lockFile(f)
+	if err != nil {
+		f.Close()
+		holder := readPid(name)
+		if holder != "" {
+			return nil, fmt.Errorf("%w: %s is held by another %s (pid %s)", ErrLocked, abs, role, holder)
+		}
+		return nil, fmt.Errorf("%w: %s is held by another %s: %v", ErrLocked, abs, role, err)
+	}
+
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+
+	return &Dir{Path: abs, role: role, lock: f}, nil
+}
+
+// File returns the path of name inside the directory.
+func (d *Dir) File(name string) string {
+	return filepath.Join(d.Path, name)
+}
+
+// Identity returns the name the role's process is known by, kept in the
+// directory across restarts. A non-empty name replaces the stored one; with
+// neither, generate makes one up and it is stored.
+func (d *Dir) Identity(name string, generate func() string) (string, error) {
+	file := d.File(d.role + ".id")
+
+	data, err := os.ReadFile(file)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return "", fmt.Errorf("[datadir] unable to read %s: %v", file, err)
+	}
+	stored := strings.TrimSpace(string(data))
+
+	switch {
+	case name == "" && stored != "":
+		return stored, nil
+	case name == "":
+		name = generate()
+	case name == stored:
+		return name, nil
+	}
+
+	err = os.WriteFile(file, []byte(name+"\n"), 0600)
+	if err != nil {
+		return "", fmt.Errorf("[datadir] unable to write %s: %v", file, err)
+	}
+	return name, nil
+}
+
+// Close releases the directory's lock.
+func (d *Dir) Close() error {
+	err := unlockFile(d.lock)
+	if cerr := d.lock.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func readPid(name string) string {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
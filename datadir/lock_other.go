@@ -0,0 +1,15 @@
+//go:build !unix
+
+package datadir
+
+import "os"
+
+// lockFile does not lock on platforms without flock; the lock file still
+// records the pid of the last process to open the directory.
+func lockFile(f *os.File) error {
+	return nil
+}
+
+func unlockFile(f *os.File) error {
+	return nil
+}
@@ -1,11 +1,21 @@
 package manager
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/surajsharma/kanastar/auth"
+	"github.com/surajsharma/kanastar/utils"
 )
 
 type ErrResponse struct {
@@ -18,21 +28,236 @@ type Api struct {
 	Port    int
 	Manager *Manager
 	Router  *chi.Mux
+	// TLS serves the API over TLS if set
+	TLS *tls.Config
+	// Auth requires every request to carry a token whose role allows it,
+	// if set
+	Auth *auth.Authenticator
+	// Audit records who changed what, the standard logger if not set
+	Audit  *log.Logger
+	mu     sync.Mutex
+	server *http.Server
+	closed bool
 }
 
 func (a *Api) initRouter() {
 	a.Router = chi.NewRouter()
+	a.Router.Use(a.authorize)
+	a.Router.Use(a.forwardToLeader)
+	a.Router.Use(a.audit)
 	a.Router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTaskHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
+			r.Get("/", a.InspectTaskHandler)
 			r.Delete("/", a.StopTaskHandler)
 		})
 	})
+
+	a.Router.Route("/services", func(r chi.Router) {
+		r.Post("/", a.CreateServiceHandler)
+		r.Get("/", a.GetServicesHandler)
+		r.Route("/{serviceName}", func(r chi.Router) {
+			r.Get("/", a.GetServiceHandler)
+			r.Put("/", a.UpdateServiceHandler)
+			r.Post("/scale", a.ScaleServiceHandler)
+			r.Get("/rollout", a.GetRolloutHandler)
+			r.Post("/rollback", a.RollbackServiceHandler)
+		})
+	})
+
+	a.Router.Route("/cronjobs", func(r chi.Router) {
+		r.Post("/", a.CreateCronJobHandler)
+		r.Get("/", a.GetCronJobsHandler)
+		r.Route("/{cronJobName}", func(r chi.Router) {
+			r.Get("/", a.GetCronJobHandler)
+		})
+	})
+
+	a.Router.Route("/workflows", func(r chi.Router) {
+		r.Post("/", a.CreateWorkflowHandler)
+		r.Get("/", a.GetWorkflowsHandler)
+		r.Route("/{workflowName}", func(r chi.Router) {
+			r.Get("/", a.GetWorkflowHandler)
+			r.Post("/runs", a.RunWorkflowHandler)
+			r.Get("/runs/{runID}", a.GetWorkflowRunHandler)
+		})
+	})
+
+	a.Router.Route("/nodes", func(r chi.Router) {
+		r.Get("/", a.GetNodesHandler)
+	})
+
+	a.Router.Route("/watch", func(r chi.Router) {
+		r.Get("/", a.WatchHandler)
+	})
+
+	a.Router.Route("/admin", func(r chi.Router) {
+		r.Get("/backup", a.BackupHandler)
+		r.Get("/export", a.ExportHandler)
+		r.Post("/import", a.ImportHandler)
+	})
+
+	a.Router.Get("/cluster", a.GetClusterHandler)
+	a.Router.Get("/conflicts", a.GetConflictsHandler)
+	a.Router.Get("/namespaces", a.GetNamespacesHandler)
+}
+
+// authorize rejects the requests without a valid token, and the ones the
+// token's role does not allow, as required by requiredRole.
+func (a *Api) authorize(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if a.Auth == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		id, err := a.Auth.Authenticate(auth.FromRequest(r))
+		if err != nil {
+			a.auditf("%s %s %s denied: %v", r.RemoteAddr, r.Method, r.URL.Path, err)
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, fmt.Sprintf("[manager][api] %v", err))
+			return
+		}
+
+		required := requiredRole(r)
+		if required == auth.Admin && len(id.Namespaces) > 0 {
+			a.auditf("%s (%s) %s %s denied: limited to namespaces", id.Name, id.Role, r.Method, r.URL.Path)
+			writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %s is limited to namespaces %s, %s %s needs all of them", id.Name, strings.Join(id.Namespaces, ", "), r.Method, r.URL.Path))
+			return
+		}
+		if !auth.Allows(id.Role, required) {
+			a.auditf("%s (%s) %s %s denied: needs %s", id.Name, id.Role, r.Method, r.URL.Path, required)
+			writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %s is %s, %s %s needs %s", id.Name, id.Role, r.Method, r.URL.Path, required))
+			return
+		}
+
+		next.ServeHTTP(w, r.WithContext(auth.WithIdentity(r.Context(), id)))
+	})
 }
 
-func (a *Api) Start() {
+// requiredRole is the role a request needs: reads need read-only, except for
+// the admin routes, which need admin for everything, and writes need submitter.
+func requiredRole(r *http.Request) string {
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/admin"):
+		return auth.Admin
+	case r.Method == http.MethodGet || r.Method == http.MethodHead:
+		return auth.ReadOnly
+	default:
+		return auth.Submitter
+	}
+}
+
+// audit records the requests that change anything, or read the admin
+// routes, with who made them and how they were answered. Requests forwarded
+// to the leader are recorded by the leader.
+func (a *Api) audit(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, ok := auth.FromContext(r.Context())
+		if !ok || requiredRole(r) == auth.ReadOnly {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		a.auditf("%s (%s) %s %s %d", id.Name, id.Role, r.Method, r.URL.Path, ww.Status())
+	})
+}
+
+func (a *Api) auditf(format string, args ...interface{}) {
+	l := a.Audit
+	if l == nil {
+		l = log.Default()
+	}
+	l.Printf("[manager][audit] "+format, args...)
+}
+
+// forwardedHeader marks a request one manager forwarded to another, so a
+// request is never forwarded twice while leadership changes hands.
+const forwardedHeader = "X-Kanastar-Forwarded"
+
+// forwardToLeader sends the requests only the leader can serve to it when
+// this manager is a follower: every write, and the reads of state only the
+// leader keeps current, like node stats and the watch streams.
+func (a *Api) forwardToLeader(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		c := a.Manager.Cluster
+		if c == nil || c.IsLeader() || !leaderOnly(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		leader := c.Leader()
+		if leader == "" || leader == c.ID || r.Header.Get(forwardedHeader) != "" {
+			writeError(w, http.StatusServiceUnavailable, "[manager][api] no leader to serve the request, try again")
+			return
+		}
+
+		target := &url.URL{Scheme: utils.Scheme, Host: leader}
+		proxy := httputil.NewSingleHostReverseProxy(target)
+		proxy.Transport = utils.HTTP.Transport
+		proxy.FlushInterval = -1
+		proxy.ErrorHandler = func(w http.ResponseWriter, r *http.Request, err error) {
+			writeError(w, http.StatusBadGateway, fmt.Sprintf("[manager][api] unable to forward request to leader %s: %v", leader, err))
+		}
+
+		r.Header.Set(forwardedHeader, c.ID)
+		proxy.ServeHTTP(w, r)
+	})
+}
+
+func leaderOnly(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return true
+	}
+	for _, prefix := range []string{"/nodes", "/watch", "/admin", "/conflicts"} {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Start serves the API until Shutdown is called.
+func (a *Api) Start() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
 	a.initRouter()
+	a.server = &http.Server{
+		Addr:      fmt.Sprintf("%s:%d", a.Address, a.Port),
+		Handler:   a.Router,
+		TLSConfig: a.TLS,
+	}
+	a.mu.Unlock()
+
 	log.Printf("[manager][api] started listening at %s:%d", a.Address, a.Port)
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	var err error
+	if a.TLS != nil {
+		err = a.server.ListenAndServeTLS("", "")
+	} else {
+		err = a.server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting requests and waits for the ones in progress until
+// ctx is done. Watch streams are ended first so they don't hold it up.
+func (a *Api) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+	if a.server == nil {
+		return nil
+	}
+	a.Manager.Watcher.Close()
+	return a.server.Shutdown(ctx)
 }
@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surajsharma/kanastar/auth"
+)
+
+func TestRequiredRole(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		role   string
+	}{
+		{http.MethodGet, "/tasks", auth.ReadOnly},
+		{http.MethodHead, "/nodes", auth.ReadOnly},
+		{http.MethodGet, "/watch", auth.ReadOnly},
+		{http.MethodPost, "/tasks", auth.Submitter},
+		{http.MethodDelete, "/tasks/1", auth.Submitter},
+		{http.MethodPut, "/services/web", auth.Submitter},
+		{http.MethodPost, "/workflows/etl/runs", auth.Submitter},
+		{http.MethodGet, "/admin/backup", auth.Admin},
+		{http.MethodGet, "/admin/export", auth.Admin},
+		{http.MethodPost, "/admin/import", auth.Admin},
+	}
+
+	for _, tt := range tests {
+		r := httptest.NewRequest(tt.method, tt.path, nil)
+		if got := requiredRole(r); got != tt.role {
+			t.Errorf("%s %s needs %q, want %q", tt.method, tt.path, got, tt.role)
+		}
+	}
+}
+
+// TestAuthorize sends requests with tokens of each role through the API and
+// checks which are let through.
+func TestAuthorize(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	secret := []byte("0123456789abcdef0123456789abcdef")
+	file := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(file, secret, 0600); err != nil {
+		t.Fatal(err)
+	}
+	authenticator, err := auth.Load("", file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := New(nil, "roundrobin", "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	a := &Api{Manager: m, Auth: authenticator, Audit: log.New(io.Discard, "", 0)}
+	a.initRouter()
+
+	token := func(role string, namespaces ...string) string {
+		tk, err := auth.Sign(secret, auth.Identity{Name: role, Role: role, Namespaces: namespaces}, time.Hour)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tk
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		method string
+		path   string
+		status int
+	}{
+		{"no token", "", http.MethodGet, "/tasks", http.StatusUnauthorized},
+		{"invalid token", "nope", http.MethodGet, "/tasks", http.StatusUnauthorized},
+		{"read-only reads", token(auth.ReadOnly), http.MethodGet, "/tasks", http.StatusOK},
+		{"read-only writes", token(auth.ReadOnly), http.MethodPost, "/workflows/etl/runs", http.StatusForbidden},
+		{"submitter writes", token(auth.Submitter), http.MethodPost, "/workflows/etl/runs", http.StatusNotFound},
+		{"submitter backs up", token(auth.Submitter), http.MethodGet, "/admin/export", http.StatusForbidden},
+		{"admin backs up", token(auth.Admin), http.MethodGet, "/admin/export", http.StatusOK},
+		{"namespaced admin backs up", token(auth.Admin, "team-a"), http.MethodGet, "/admin/export", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.token != "" {
+				r.Header.Set(auth.Header, "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+			a.Router.ServeHTTP(rec, r)
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
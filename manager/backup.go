@@ -0,0 +1,212 @@
+package manager
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/cronjob"
+	"github.com/surajsharma/kanastar/service"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/workflow"
+)
+
+// StateVersion is the version of the State format written by Export.
+const StateVersion = 1
+
+// State is a portable copy of everything the manager stores, independent of
+// the store backend.
+type State struct {
+	Version    int
+	ExportedAt time.Time
+	Tasks      []*task.Task
+	Events     []*task.TaskEvent
+	Services   []*service.Service
+	CronJobs   []*cronjob.CronJob
+	Workflows  []*workflow.Workflow
+}
+
+// StoreNames are the stores a backup holds, each as <name>.db.
+var StoreNames = []string{"tasks", "events", "services", "cronjobs", "workflows"}
+
+type namedStore struct {
+	name  string
+	store interface{}
+}
+
+func (m *Manager) stores() []namedStore {
+	return []namedStore{
+		{"tasks", m.TaskDb},
+		{"events", m.EventDb},
+		{"services", m.ServiceDb},
+		{"cronjobs", m.CronJobDb},
+		{"workflows", m.WorkflowDb},
+	}
+}
+
+// CanBackup reports why Backup would fail up front, nil if it would not.
+func (m *Manager) CanBackup() error {
+	for _, s := range m.stores() {
+		if _, ok := s.store.(store.Snapshotter); !ok {
+			return fmt.Errorf("%w: %s", store.ErrSnapshotUnsupported, s.name)
+		}
+	}
+	return nil
+}
+
+// Backup writes a zip archive holding a snapshot of each store, named
+// <store>.db, to w. It only works with the persistent stores; nothing is
+// written if any store cannot be snapshotted.
+//
+// The stores are separate databases, so their snapshots are begun while the
+// writers of specs and tasks are held off: the backup holds the specs and
+// tasks as of one point in time. Events are written without those locks and
+// may be a little ahead of the tasks.
+func (m *Manager) Backup(w io.Writer) error {
+	err := m.CanBackup()
+	if err != nil {
+		return err
+	}
+
+	snaps, err := m.beginSnapshots()
+	if err != nil {
+		return err
+	}
+	defer func() {
+		for _, snap := range snaps {
+			snap.Close()
+		}
+	}()
+
+	z := zip.NewWriter(w)
+	for i, s := range m.stores() {
+		f, err := z.CreateHeader(&zip.FileHeader{
+			Name:     s.name + ".db",
+			Method:   zip.Deflate,
+			Modified: time.Now().UTC(),
+		})
+		if err != nil {
+			return fmt.Errorf("[manager] error adding %s to backup: %v", s.name, err)
+		}
+
+		n, err := snaps[i].WriteTo(f)
+		if err != nil {
+			return fmt.Errorf("[manager] error snapshotting %s: %v", s.name, err)
+		}
+		log.Printf("[manager] backed up %s (%d bytes)\n", s.name, n)
+	}
+
+	return z.Close()
+}
+
+// beginSnapshots begins a snapshot of every store, in the order of stores.
+func (m *Manager) beginSnapshots() ([]store.Snapshot, error) {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+	m.taskMu.Lock()
+	defer m.taskMu.Unlock()
+
+	var snaps []store.Snapshot
+	for _, s := range m.stores() {
+		snap, err := store.BeginSnapshot(s.store)
+		if err != nil {
+			for _, snap := range snaps {
+				snap.Close()
+			}
+			return nil, fmt.Errorf("[manager] error snapshotting %s: %v", s.name, err)
+		}
+		snaps = append(snaps, snap)
+	}
+	return snaps, nil
+}
+
+// Export returns a copy of everything the manager stores.
+func (m *Manager) Export() (*State, error) {
+	var err error
+	s := State{Version: StateVersion, ExportedAt: time.Now().UTC()}
+
+	if s.Tasks, err = store.All(m.TaskDb); err != nil {
+		return nil, fmt.Errorf("[manager] error exporting tasks: %v", err)
+	}
+	if s.Events, err = store.All(m.EventDb); err != nil {
+		return nil, fmt.Errorf("[manager] error exporting events: %v", err)
+	}
+	if s.Services, err = store.All(m.ServiceDb); err != nil {
+		return nil, fmt.Errorf("[manager] error exporting services: %v", err)
+	}
+	if s.CronJobs, err = store.All(m.CronJobDb); err != nil {
+		return nil, fmt.Errorf("[manager] error exporting cron jobs: %v", err)
+	}
+	if s.Workflows, err = store.All(m.WorkflowDb); err != nil {
+		return nil, fmt.Errorf("[manager] error exporting workflows: %v", err)
+	}
+
+	return &s, nil
+}
+
+// Import stores everything in s, replacing records with the same key. Tasks
+// that were placed on a worker by the exporting manager are unknown to this
+// one, so they are put back to Pending and scheduled again; the copies still
+// running on workers are stopped as leftovers.
+func (m *Manager) Import(s *State) error {
+	if s.Version != StateVersion {
+		return fmt.Errorf("[manager] unsupported state version %d, want %d", s.Version, StateVersion)
+	}
+
+	m.mu.Lock()
+	assigned := make(map[uuid.UUID]bool, len(m.TaskWorkerMap))
+	for id := range m.TaskWorkerMap {
+		assigned[id] = true
+	}
+	m.mu.Unlock()
+
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	for _, sv := range s.Services {
+		if err := m.ServiceDb.Put(sv.Name, sv); err != nil {
+			return fmt.Errorf("[manager] error importing service %s: %v", sv.Name, err)
+		}
+	}
+	for _, c := range s.CronJobs {
+		if err := m.CronJobDb.Put(c.Name, c); err != nil {
+			return fmt.Errorf("[manager] error importing cron job %s: %v", c.Name, err)
+		}
+	}
+	for _, wf := range s.Workflows {
+		if err := m.WorkflowDb.Put(wf.Name, wf); err != nil {
+			return fmt.Errorf("[manager] error importing workflow %s: %v", wf.Name, err)
+		}
+	}
+
+	m.taskMu.Lock()
+	for _, t := range s.Tasks {
+		if (t.State == task.Scheduled || t.State == task.Running) && !assigned[t.ID] {
+			t.State = task.Pending
+			t.Worker = ""
+			t.ContainerID = ""
+			t.HostPorts = nil
+		}
+		if err := m.storeTask(t); err != nil {
+			m.taskMu.Unlock()
+			return fmt.Errorf("[manager] error importing task %v: %v", t.ID, err)
+		}
+	}
+	m.taskMu.Unlock()
+
+	for _, te := range s.Events {
+		if err := m.putEvent(te); err != nil {
+			return fmt.Errorf("[manager] error importing event %v: %v", te.ID, err)
+		}
+	}
+
+	log.Printf("[manager] imported %d tasks, %d events, %d services, %d cron jobs and %d workflows\n",
+		len(s.Tasks), len(s.Events), len(s.Services), len(s.CronJobs), len(s.Workflows))
+
+	m.Wake()
+	return nil
+}
@@ -0,0 +1,76 @@
+package manager
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// TestBackupRestore backs up a manager on the persistent stores, restores
+// the backup into another data directory and starts a manager from it.
+func TestBackupRestore(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	m, err := New(nil, "roundrobin", "persistent", t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id := uuid.New()
+	err = m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Scheduled, Timestamp: time.Now().UTC(), Task: task.Task{ID: id, Name: "backed-up"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	err = m.Backup(&buf)
+	m.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(z.File) != len(StoreNames) {
+		t.Fatalf("backup holds %d files, want %d", len(z.File), len(StoreNames))
+	}
+
+	dir := t.TempDir()
+	for _, f := range z.File {
+		r, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = store.RestoreBoltFile(filepath.Join(dir, f.Name), 0600, r)
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	restored, err := New(nil, "roundrobin", "persistent", dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	tk, err := restored.TaskDb.Get(id.String())
+	if err != nil {
+		t.Fatalf("the task is not in the restored stores: %v", err)
+	}
+	if tk.Name != "backed-up" || tk.State != task.Pending {
+		t.Fatalf("restored task is %q in state %v", tk.Name, tk.State)
+	}
+}
@@ -0,0 +1,94 @@
+package manager
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/cluster"
+	"github.com/surajsharma/kanastar/cronjob"
+	"github.com/surajsharma/kanastar/service"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/workflow"
+)
+
+// EnableCluster replicates the manager's stores through c. Call it before
+// c is started and before the API serves requests; from then on only the
+// leader runs Lead and the other members forward writes to it.
+func (m *Manager) EnableCluster(c *cluster.Cluster) {
+	m.TaskDb = cluster.Register(c, "tasks", m.TaskDb, func(t *task.Task) string { return t.ID.String() })
+	m.EventDb = cluster.Register(c, "events", m.EventDb, func(te *task.TaskEvent) string { return te.ID.String() })
+	m.ServiceDb = cluster.Register(c, "services", m.ServiceDb, func(s *service.Service) string { return s.Name })
+	m.CronJobDb = cluster.Register(c, "cronjobs", m.CronJobDb, func(cj *cronjob.CronJob) string { return cj.Name })
+	m.WorkflowDb = cluster.Register(c, "workflows", m.WorkflowDb, func(wf *workflow.Workflow) string { return wf.Name })
+	m.Cluster = c
+}
+
+// Lead runs the reconciler, the worker updates, health checks, node stats
+// and compaction until ctx is cancelled. It starts from what the stores
+// hold, brought in line with what the workers run, so a manager that
+// restarts or takes over as leader picks up the tasks already placed.
+func (m *Manager) Lead(ctx context.Context) {
+	m.resync()
+	m.stopping = make(chan struct{})
+	m.Pending.Reopen()
+
+	var wg sync.WaitGroup
+	for _, loop := range []func(context.Context){
+		m.ProcessTasks,
+		m.UpdateTasks,
+		m.DoHealthChecks,
+		m.UpdateNodeStats,
+		m.CompactStores,
+	} {
+		wg.Add(1)
+		go func(loop func(context.Context)) {
+			defer wg.Done()
+			loop(ctx)
+		}(loop)
+	}
+	wg.Wait()
+}
+
+// restoreAssignments rebuilds which task is placed on which worker, and
+// what that allocates on each node, from the worker recorded on the tasks.
+func (m *Manager) restoreAssignments() {
+	tasks := m.GetTasks()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.WorkerTaskMap = make(map[string][]uuid.UUID)
+	m.TaskWorkerMap = make(map[uuid.UUID]string)
+	m.WorkerFailures = make(map[string]int)
+	m.lastFree = make(map[string]capacity)
+	for _, w := range m.Workers {
+		m.WorkerTaskMap[w] = []uuid.UUID{}
+	}
+	for _, n := range m.WorkerNodes {
+		n.MemoryAllocated = 0
+		n.DiskAllocated = 0
+		n.TaskCount = 0
+	}
+
+	restored := 0
+	for _, t := range tasks {
+		if t.Worker == "" {
+			continue
+		}
+		m.WorkerTaskMap[t.Worker] = append(m.WorkerTaskMap[t.Worker], t.ID)
+		m.TaskWorkerMap[t.ID] = t.Worker
+		restored++
+
+		if n := m.getNode(t.Worker); n != nil && (t.State == task.Scheduled || t.State == task.Running) {
+			n.MemoryAllocated += t.Memory / 1000
+			n.DiskAllocated += t.Disk
+			n.TaskCount++
+		}
+	}
+
+	if restored > 0 {
+		log.Printf("[manager] restored the placement of %d tasks\n", restored)
+	}
+}
@@ -0,0 +1,241 @@
+package manager
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/hashicorp/raft"
+	"github.com/surajsharma/kanastar/cluster"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/utils"
+)
+
+// member is one manager of an in-process cluster, with its API served on
+// the address that is also its cluster ID.
+type member struct {
+	id        string
+	raftAddr  raft.ServerAddress
+	transport *raft.InmemTransport
+	manager   *Manager
+	cluster   *cluster.Cluster
+	server    *httptest.Server
+	cancel    context.CancelFunc
+	done      chan struct{}
+	stopped   bool
+}
+
+func (mb *member) stop() {
+	if mb.stopped {
+		return
+	}
+	mb.stopped = true
+	mb.cancel()
+	<-mb.done
+	mb.cluster.Shutdown()
+	mb.server.Close()
+	mb.manager.Close()
+}
+
+func startCluster(t *testing.T, size int, workers []string) []*member {
+	members := make([]*member, size)
+	peers := make(map[string]string)
+
+	for i := range members {
+		srv := httptest.NewUnstartedServer(nil)
+		addr, trans := raft.NewInmemTransport("")
+		members[i] = &member{id: srv.Listener.Addr().String(), raftAddr: addr, transport: trans, server: srv}
+		peers[members[i].id] = string(addr)
+	}
+	for _, a := range members {
+		for _, b := range members {
+			if a != b {
+				a.transport.Connect(b.raftAddr, b.transport)
+			}
+		}
+	}
+
+	for _, mb := range members {
+		m, err := New(workers, "roundrobin", "memory", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		m.ReconcileInterval = 10 * time.Millisecond
+		m.UpdateInterval = 10 * time.Millisecond
+		m.StatsInterval = 10 * time.Millisecond
+
+		c := cluster.New()
+		m.EnableCluster(c)
+
+		stable := raft.NewInmemStore()
+		err = c.Start(cluster.Config{
+			ID:        mb.id,
+			Peers:     peers,
+			Transport: mb.transport,
+			Logs:      stable,
+			Stable:    stable,
+			Snapshots: raft.NewInmemSnapshotStore(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		api := &Api{Manager: m}
+		api.initRouter()
+		mb.server.Config.Handler = api.Router
+		mb.server.Start()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		mb.manager, mb.cluster, mb.cancel, mb.done = m, c, cancel, make(chan struct{})
+		go func(mb *member) {
+			defer close(mb.done)
+			c.RunLeader(ctx, m.Lead)
+		}(mb)
+	}
+
+	t.Cleanup(func() {
+		for _, mb := range members {
+			mb.stop()
+		}
+	})
+	return members
+}
+
+// waitForLeader waits until every running member agrees on a leader, and
+// returns it.
+func waitForLeader(t *testing.T, members []*member) *member {
+	deadline := time.Now().Add(20 * time.Second)
+	for time.Now().Before(deadline) {
+		var leader *member
+		agreed := true
+		for _, mb := range members {
+			if mb.stopped {
+				continue
+			}
+			id := mb.cluster.Leader()
+			if id == "" || (leader != nil && leader.id != id) {
+				agreed = false
+				break
+			}
+			for _, l := range members {
+				if l.id == id && !l.stopped {
+					leader = l
+				}
+			}
+		}
+		if agreed && leader != nil && leader.cluster.IsLeader() {
+			return leader
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatal("the cluster did not elect a leader")
+	return nil
+}
+
+func follower(members []*member, leader *member) *member {
+	for _, mb := range members {
+		if mb != leader && !mb.stopped {
+			return mb
+		}
+	}
+	return nil
+}
+
+func submit(t *testing.T, mb *member) uuid.UUID {
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Scheduled,
+		Timestamp: time.Now().UTC(),
+		Task:      task.Task{ID: uuid.New(), Name: "clustered", Image: "busybox", Memory: 1000, Disk: 1},
+	}
+	data, err := json.Marshal(te)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := http.Post(mb.server.URL+"/tasks", "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		t.Fatalf("submitting to %s: %d %s", mb.id, resp.StatusCode, body)
+	}
+	return te.Task.ID
+}
+
+// waitForRunning waits until every running member's copy of the task shows
+// it Running, which only the leader's reconciler and updates can bring about.
+func waitForRunning(t *testing.T, members []*member, id uuid.UUID) {
+	deadline := time.Now().Add(20 * time.Second)
+	for time.Now().Before(deadline) {
+		running := true
+		for _, mb := range members {
+			if mb.stopped {
+				continue
+			}
+			tk, err := mb.manager.TaskDb.Get(id.String())
+			if err != nil || tk.State != task.Running {
+				running = false
+				break
+			}
+		}
+		if running {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("task %v did not reach Running on every member", id)
+}
+
+// TestClusterFailover runs three managers in one process, submits through a
+// follower, which forwards to the leader, then stops the leader and checks
+// the others elect a new one that carries on.
+func TestClusterFailover(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	attempts := utils.RetryAttempts
+	utils.RetryAttempts = 1
+	t.Cleanup(func() { utils.RetryAttempts = attempts })
+
+	members := startCluster(t, 3, []string{newFakeWorker(t)})
+
+	leader := waitForLeader(t, members)
+	first := submit(t, follower(members, leader))
+	waitForRunning(t, members, first)
+
+	// take the leader away
+	for _, mb := range members {
+		if mb != leader {
+			mb.transport.Disconnect(leader.raftAddr)
+		}
+	}
+	leader.transport.DisconnectAll()
+	leader.stop()
+
+	next := waitForLeader(t, members)
+	if next == leader {
+		t.Fatal("the stopped manager is still the leader")
+	}
+
+	second := submit(t, follower(members, next))
+	waitForRunning(t, members, second)
+
+	tk, err := next.manager.TaskDb.Get(first.String())
+	if err != nil {
+		t.Fatalf("the new leader lost task %v: %v", first, err)
+	}
+	if tk.State != task.Running {
+		t.Fatalf("task %v is %v on the new leader, want Running", first, tk.State)
+	}
+}
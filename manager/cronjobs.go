@@ -0,0 +1,180 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/cronjob"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// missedRunGrace is how late a run may be started and still count as on
+// time rather than missed; it covers the gap between reconcile passes.
+const missedRunGrace = time.Minute
+
+func (m *Manager) AddCronJob(c cronjob.CronJob) (*cronjob.CronJob, error) {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	c.SetDefaults()
+
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.CronJobDb.Get(c.Name)
+	if err == nil {
+		return nil, fmt.Errorf("[manager] cron job %s already exists", c.Name)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("[manager] error looking up cron job %s: %v", c.Name, err)
+	}
+
+	c.ID = uuid.New()
+	c.CreatedAt = time.Now().UTC()
+	c.LastScheduleTime = time.Time{}
+	c.Active = nil
+	c.History = nil
+
+	err = m.CronJobDb.Put(c.Name, &c)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] error storing cron job %s: %v", c.Name, err)
+	}
+
+	log.Printf("[manager] added cron job %s with schedule %q, next run at %v\n", c.Name, c.Schedule, c.Next(c.CreatedAt))
+	return &c, nil
+}
+
+func (m *Manager) GetCronJobs() []*cronjob.CronJob {
+	jobs, err := store.All(m.CronJobDb)
+	if err != nil {
+		log.Printf("[manager] error getting list of cron jobs: %v\n", err)
+		return nil
+	}
+
+	return jobs
+}
+
+func (m *Manager) GetCronJob(name string) (*cronjob.CronJob, error) {
+	result, err := m.CronJobDb.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// reconcileCronJobs records finished runs and starts a new run for every cron
+// job whose schedule has fired since its last run.
+func (m *Manager) reconcileCronJobs() {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	now := time.Now().UTC()
+
+	for _, c := range m.GetCronJobs() {
+		changed := m.settleCronRuns(c)
+
+		if !c.Suspend {
+			due, missed, err := c.Due(now)
+			if err != nil {
+				log.Printf("[manager] error evaluating schedule of cron job %s: %v\n", c.Name, err)
+			} else if !due.IsZero() {
+				c.LastScheduleTime = due
+				changed = true
+				m.startCronRun(c, due, missed, now)
+			}
+		}
+
+		if changed {
+			err := m.CronJobDb.Put(c.Name, c)
+			if err != nil {
+				log.Printf("[manager] error storing cron job %s: %v\n", c.Name, err)
+			}
+		}
+	}
+}
+
+func (m *Manager) settleCronRuns(c *cronjob.CronJob) bool {
+	changed := false
+
+	for _, run := range append([]cronjob.Run{}, c.Active...) {
+		t, err := m.TaskDb.Get(run.TaskID.String())
+		if err != nil {
+			log.Printf("[manager] run %v of cron job %s is gone\n", run.TaskID, c.Name)
+			c.RecordFinished(run.TaskID, task.Failed, time.Now().UTC())
+			changed = true
+			continue
+		}
+
+		finished := t.State == task.Completed || (t.State == task.Failed && t.RestartCount >= m.MaxRestarts)
+		if !finished {
+			continue
+		}
+
+		log.Printf("[manager] run %v of cron job %s finished in state %v\n", t.ID, c.Name, t.State)
+		c.RecordFinished(t.ID, t.State, t.FinishTime)
+		changed = true
+	}
+
+	return changed
+}
+
+func (m *Manager) startCronRun(c *cronjob.CronJob, due time.Time, missed int, now time.Time) {
+	switch {
+	case missed >= cronjob.MaxMissedCount:
+		log.Printf("[manager] cron job %s missed at least %d runs before %v\n", c.Name, missed, due)
+	case missed > 0:
+		log.Printf("[manager] cron job %s missed %d runs before %v\n", c.Name, missed, due)
+	}
+
+	late := now.Sub(due)
+	if late > missedRunGrace {
+		if c.MissedRuns == cronjob.MissedRunSkip {
+			log.Printf("[manager] skipping missed run of cron job %s due at %v\n", c.Name, due)
+			return
+		}
+
+		if c.StartingDeadline > 0 && late > time.Duration(c.StartingDeadline)*time.Second {
+			log.Printf("[manager] missed run of cron job %s due at %v is past its starting deadline\n", c.Name, due)
+			return
+		}
+	}
+
+	if len(c.Active) > 0 {
+		switch c.ConcurrencyPolicy {
+		case cronjob.ConcurrencyForbid:
+			log.Printf("[manager] skipping run of cron job %s, %d runs still active\n", c.Name, len(c.Active))
+			return
+		case cronjob.ConcurrencyReplace:
+			for _, run := range c.Active {
+				result, err := m.TaskDb.Get(run.TaskID.String())
+				if err != nil {
+					continue
+				}
+				log.Printf("[manager] replacing active run %v of cron job %s\n", run.TaskID, c.Name)
+				m.retireTask(result)
+			}
+		}
+	}
+
+	t := c.NewTask(due)
+	err := m.AddTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: now,
+		Task:      t,
+	})
+	if err != nil {
+		log.Printf("[manager] unable to start run of cron job %s: %v\n", c.Name, err)
+		return
+	}
+
+	c.Active = append(c.Active, cronjob.Run{TaskID: t.ID, ScheduledTime: due, State: task.Pending})
+	log.Printf("[manager] started run %v of cron job %s scheduled for %v\n", t.ID, c.Name, due)
+}
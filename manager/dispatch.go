@@ -0,0 +1,245 @@
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/node"
+	"github.com/surajsharma/kanastar/scheduler"
+	"github.com/surajsharma/kanastar/task"
+)
+
+const (
+	DefaultSchedulerWorkers = 4
+	dispatchQueueSize       = 100
+	// how many times a scheduling worker re-selects when another one took
+	// the room on its chosen node first
+	placementAttempts = 3
+)
+
+// Wake runs the reconciler now instead of waiting for its next tick.
+func (m *Manager) Wake() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// startPipeline starts the scheduling workers, which place pending tasks, and
+// one dispatcher per worker node, which sends placed tasks to it in order.
+// The returned group is done once all of them have stopped: the scheduling
+// workers when the pending queue is closed, the dispatchers when ctx is
+// cancelled, each after finishing the task in hand.
+func (m *Manager) startPipeline(ctx context.Context) *sync.WaitGroup {
+	var wg sync.WaitGroup
+
+	for _, n := range m.WorkerNodes {
+		queue := make(chan uuid.UUID, dispatchQueueSize)
+		m.dispatchers[n.Name] = queue
+
+		wg.Add(1)
+		go func(n *node.Node) {
+			defer wg.Done()
+			m.dispatchLoop(ctx, n, queue)
+		}(n)
+	}
+
+	workers := m.SchedulerWorkers
+	if workers < 1 {
+		workers = 1
+	}
+
+	log.Printf("[manager] starting %d scheduling workers\n", workers)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			m.scheduleLoop(ctx)
+		}()
+	}
+
+	return &wg
+}
+
+func (m *Manager) scheduleLoop(ctx context.Context) {
+	for {
+		id, ok := m.Pending.Next()
+		if !ok {
+			return
+		}
+		m.schedulePendingTask(ctx, id)
+		m.Pending.Done(id)
+	}
+}
+
+// schedulePendingTask places a task that still wants to run. If it cannot be
+// placed it stays Pending with the reason recorded and the reconciler queues
+// it again after a backoff, or straight away once capacity has been freed,
+// e.g. by the lower priority tasks it preempted when that is enabled.
+func (m *Manager) schedulePendingTask(ctx context.Context, id uuid.UUID) {
+	t, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return
+	}
+
+	if t.State != task.Pending || t.DesiredState != task.Running {
+		return
+	}
+
+	reason := m.placeTask(ctx, t)
+	if reason != "" && m.Preemption && m.preemptFor(t) {
+		// the room is there once the workers report the victims stopped,
+		// which queues this task again
+		reason = "waiting for preempted tasks to stop"
+	}
+
+	if reason != "" {
+		m.deferTask(t, reason)
+	}
+}
+
+// placeTask picks a worker for t, reserves room for it there and hands it to
+// that worker's dispatcher. It returns why it could not, or an empty string.
+func (m *Manager) placeTask(ctx context.Context, t *task.Task) string {
+	var reason string
+
+	for i := 0; i < placementAttempts; i++ {
+		w, err := m.SelectWorker(ctx, *t)
+		if err != nil {
+			log.Printf("[manager] error selecting worker for task %s : %v", t.ID, err)
+			var unschedulable *UnschedulableError
+			if errors.As(err, &unschedulable) {
+				return unschedulable.Reason
+			}
+			return "no worker could be selected"
+		}
+
+		reason = m.reserve(t, w.Name)
+		if reason == "" {
+			log.Printf("[manager] selected worker [%s] for task [%s]", w.Name, t.ID)
+			select {
+			case m.dispatchers[w.Name] <- t.ID:
+			case <-m.stopping:
+				// the dispatchers are gone, the task is sent after a restart
+			}
+			return ""
+		}
+	}
+
+	return reason
+}
+
+// reserve assigns t to the named worker if it still has room, which another
+// scheduling worker may have taken since the worker was selected.
+func (m *Manager) reserve(t *task.Task, name string) string {
+	m.mu.Lock()
+
+	n := m.getNode(name)
+	if n == nil {
+		m.mu.Unlock()
+		return fmt.Sprintf("worker %s is gone", name)
+	}
+
+	reason := scheduler.UnfitReason(*t, n, n.Memory-n.MemoryAllocated, n.Disk-n.DiskAllocated)
+	if reason != "" {
+		m.mu.Unlock()
+		return reason
+	}
+
+	// stored before the lock is released so updateAllocations never sees
+	// the assignment without the task being Scheduled
+	placed := false
+	stored, err := m.modifyTask(t.ID, func(current *task.Task) bool {
+		if current.State != task.Pending || current.DesiredState != task.Running {
+			return false
+		}
+		current.State = task.Scheduled
+		current.Worker = name
+		current.PendingReason = ""
+		current.ScheduleAttempts = 0
+		current.NextScheduleTime = time.Time{}
+		placed = true
+		return true
+	})
+	if err != nil || !placed {
+		m.mu.Unlock()
+		return "the task changed while it was being placed"
+	}
+	*t = *stored
+
+	m.WorkerTaskMap[name] = append(m.WorkerTaskMap[name], t.ID)
+	m.TaskWorkerMap[t.ID] = name
+	n.MemoryAllocated += t.Memory / 1000
+	n.DiskAllocated += t.Disk
+	n.TaskCount++
+	snapshot := *n
+	m.mu.Unlock()
+
+	m.Watcher.Publish(WatchNodes, "put", &snapshot)
+	return ""
+}
+
+// deferTask leaves t Pending with the reason it could not be placed and backs
+// off before it is tried again. A task that was placed but not accepted by
+// its worker is put back to Pending first; one that was stopped or finished
+// meanwhile is left alone.
+func (m *Manager) deferTask(t *task.Task, reason string) {
+	deferred := false
+	stored, err := m.modifyTask(t.ID, func(current *task.Task) bool {
+		if current.State != task.Pending && current.State != task.Scheduled {
+			return false
+		}
+		unassigned(current)
+		current.PendingReason = reason
+		current.ScheduleAttempts++
+		current.NextScheduleTime = time.Now().UTC().Add(scheduleBackoff(current.ScheduleAttempts))
+		deferred = true
+		return true
+	})
+	if err != nil || !deferred {
+		return
+	}
+
+	log.Printf("[manager] task %v still pending (%s), next attempt at %v\n", t.ID, reason, stored.NextScheduleTime.Format(time.TimeOnly))
+}
+
+// dispatchLoop sends the tasks placed on n to it one at a time. A task the
+// worker does not accept is taken off the worker and deferred.
+func (m *Manager) dispatchLoop(ctx context.Context, n *node.Node, queue <-chan uuid.UUID) {
+	for {
+		var id uuid.UUID
+		select {
+		case <-ctx.Done():
+			return
+		case id = <-queue:
+		}
+
+		t, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			continue
+		}
+
+		if t.State != task.Scheduled || m.assignedWorker(t.ID) != n.Name {
+			// moved or stopped while it waited in the queue
+			continue
+		}
+
+		if t.DesiredState != task.Running {
+			m.unassignTask(t)
+			m.completeTask(t.ID, task.Scheduled)
+			continue
+		}
+
+		err = m.sendTask(n, t)
+		if err != nil {
+			log.Printf("[manager] unable to start task %v on %v, will retry: %v\n", t.ID, n.Name, err)
+			m.unassignTask(t)
+			m.deferTask(t, fmt.Sprintf("worker %s did not accept the task", n.Name))
+		}
+	}
+}
@@ -2,14 +2,21 @@ package manager
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/cronjob"
+	"github.com/surajsharma/kanastar/service"
+	"github.com/surajsharma/kanastar/store"
 	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/workflow"
 )
 
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -34,7 +41,30 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.Manager.AddTask(te)
+	if forbidden(w, r, te.Task.NamespaceOrDefault()) {
+		return
+	}
+
+	// an event for a known task acts on the stored task, in its namespace
+	existing, err := a.Manager.TaskDb.Get(te.Task.ID.String())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("[manager][api] unable to get task %v: %v", te.Task.ID, err))
+		return
+	}
+	if existing != nil && forbidden(w, r, existing.NamespaceOrDefault()) {
+		return
+	}
+
+	err = a.Manager.AddTask(te)
+	if errors.Is(err, ErrQuotaExceeded) {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] unable to add task %v: %v", te.Task.ID, err))
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("[manager][api] unable to add task %v: %v", te.Task.ID, err))
+		return
+	}
+
 	log.Printf("[manager][api] added task: %v\n", te.Task.ID)
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(te.Task)
@@ -47,6 +77,7 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	if taskID == "" {
 		log.Printf("[manager][api] no taskID passed in request\n")
 		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	tID, _ := uuid.Parse(taskID)
@@ -54,8 +85,11 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	taskToStop, err := a.Manager.TaskDb.Get(tID.String())
 
 	if err != nil {
-		log.Printf("[manager][api] task ID %v not found", tID)
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get task %v: %v", tID, err))
+		return
+	}
+	if hidden(w, r, "task "+tID.String(), taskToStop.NamespaceOrDefault()) {
+		return
 	}
 
 	te := task.TaskEvent{
@@ -64,20 +98,771 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 		Timestamp: time.Now(),
 	}
 
-	taskCopy := *taskToStop.(*task.Task)
+	taskCopy := *taskToStop
 
 	taskCopy.State = task.Completed
 
 	te.Task = taskCopy
 
-	a.Manager.AddTask(te)
+	err = a.Manager.AddTask(te)
+	if err != nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("[manager][api] unable to stop task %v: %v", tID, err))
+		return
+	}
 
 	log.Printf("[manager][api] added task event %v to stop task %v \n", te.ID, taskCopy.ID)
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// GetTaskHandler lists tasks. The state, worker, namespace and label
+// (key=value, may be repeated) query parameters filter the list and offset
+// and limit page through it; the X-Total-Count header holds the number of
+// matching tasks. Tokens limited to some namespaces only list their tasks.
 func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := parseTaskFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	f.Namespaces, err = namespaceScope(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	page, err := a.Manager.ListTasks(f)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("[manager][api] error listing tasks: %v", err))
+		return
+	}
+
+	tasks := page.Items
+	if tasks == nil {
+		tasks = []*task.Task{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.Itoa(page.Total))
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(tasks)
+}
+
+func parseTaskFilter(r *http.Request) (TaskFilter, error) {
+	q := r.URL.Query()
+	f := TaskFilter{Worker: q.Get("worker")}
+
+	if name := q.Get("state"); name != "" {
+		state, err := task.ParseState(name)
+		if err != nil {
+			return f, err
+		}
+		f.State = &state
+	}
+
+	for _, l := range q["label"] {
+		k, v, ok := strings.Cut(l, "=")
+		if !ok || k == "" {
+			return f, fmt.Errorf("invalid label %q, want key=value", l)
+		}
+		if f.Labels == nil {
+			f.Labels = make(map[string]string)
+		}
+		f.Labels[k] = v
+	}
+
+	var err error
+	f.Offset, err = intParam(q.Get("offset"))
+	if err != nil {
+		return f, fmt.Errorf("invalid offset: %v", err)
+	}
+	f.Limit, err = intParam(q.Get("limit"))
+	if err != nil {
+		return f, fmt.Errorf("invalid limit: %v", err)
+	}
+
+	return f, nil
+}
+
+func intParam(s string) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	if n < 0 {
+		return 0, fmt.Errorf("%d is negative", n)
+	}
+	return n, nil
+}
+
+func (a *Api) InspectTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] invalid task ID %q", taskID))
+		return
+	}
+
+	detail, err := a.Manager.DescribeTask(tID)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get task %v: %v", tID, err))
+		return
+	}
+	if hidden(w, r, "task "+tID.String(), detail.Task.NamespaceOrDefault()) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(detail)
+}
+
+func (a *Api) CreateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	s := service.Service{}
+	err := d.Decode(&s)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] error unmarshalling body: %v", err))
+		return
+	}
+	if forbidden(w, r, s.Template.NamespaceOrDefault()) {
+		return
+	}
+
+	created, err := a.Manager.AddService(s)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] unable to add service: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (a *Api) GetServicesHandler(w http.ResponseWriter, r *http.Request) {
+	scope, err := namespaceScope(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	services := []*service.Service{}
+	for _, s := range a.Manager.GetServices() {
+		if inScope(scope, s.Template.NamespaceOrDefault()) {
+			services = append(services, s)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(services)
+}
+
+func (a *Api) GetServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "serviceName")
+
+	s, err := a.Manager.GetService(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get service %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "service "+name, s.Template.NamespaceOrDefault()) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) UpdateServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "serviceName")
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	spec := service.Service{}
+	err := d.Decode(&spec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] error unmarshalling body: %v", err))
+		return
+	}
+
+	if spec.Name == "" {
+		spec.Name = name
+	}
+
+	if spec.Name != name {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] service name %q does not match %q", spec.Name, name))
+		return
+	}
+
+	existing, err := a.Manager.GetService(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get service %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "service "+name, existing.Template.NamespaceOrDefault()) || forbidden(w, r, spec.Template.NamespaceOrDefault()) {
+		return
+	}
+
+	s, err := a.Manager.UpdateService(spec)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) GetRolloutHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "serviceName")
+
+	s, err := a.Manager.GetService(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get service %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "service "+name, s.Template.NamespaceOrDefault()) {
+		return
+	}
+
+	status, err := a.Manager.GetRolloutStatus(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get service %s: %v", name, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+func (a *Api) RollbackServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "serviceName")
+
+	req := service.RollbackRequest{}
+	if r.ContentLength != 0 {
+		d := json.NewDecoder(r.Body)
+		d.DisallowUnknownFields()
+
+		err := d.Decode(&req)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] error unmarshalling body: %v", err))
+			return
+		}
+	}
+
+	existing, err := a.Manager.GetService(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get service %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "service "+name, existing.Template.NamespaceOrDefault()) {
+		return
+	}
+
+	s, err := a.Manager.RollbackService(name, req.Revision)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) ScaleServiceHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "serviceName")
+
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	req := service.ScaleRequest{}
+	err := d.Decode(&req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] error unmarshalling body: %v", err))
+		return
+	}
+
+	existing, err := a.Manager.GetService(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get service %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "service "+name, existing.Template.NamespaceOrDefault()) {
+		return
+	}
+
+	s, err := a.Manager.ScaleService(name, req.Replicas)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (a *Api) CreateCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	c := cronjob.CronJob{}
+	err := d.Decode(&c)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] error unmarshalling body: %v", err))
+		return
+	}
+	if forbidden(w, r, c.Template.NamespaceOrDefault()) {
+		return
+	}
+
+	created, err := a.Manager.AddCronJob(c)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] unable to add cron job: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (a *Api) GetCronJobsHandler(w http.ResponseWriter, r *http.Request) {
+	scope, err := namespaceScope(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	cronJobs := []*cronjob.CronJob{}
+	for _, c := range a.Manager.GetCronJobs() {
+		if inScope(scope, c.Template.NamespaceOrDefault()) {
+			cronJobs = append(cronJobs, c)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(cronJobs)
+}
+
+func (a *Api) GetCronJobHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "cronJobName")
+
+	c, err := a.Manager.GetCronJob(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get cron job %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "cron job "+name, c.Template.NamespaceOrDefault()) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(c)
+}
+
+func (a *Api) CreateWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	wf := workflow.Workflow{}
+	err := d.Decode(&wf)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] error unmarshalling body: %v", err))
+		return
+	}
+	if forbidden(w, r, workflowNamespaces(&wf)...) {
+		return
+	}
+
+	created, err := a.Manager.AddWorkflow(wf)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] unable to add workflow: %v", err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+func (a *Api) GetWorkflowsHandler(w http.ResponseWriter, r *http.Request) {
+	scope, err := namespaceScope(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	workflows := []*workflow.Workflow{}
+	for _, wf := range a.Manager.GetWorkflows() {
+		if inScope(scope, workflowNamespaces(wf)...) {
+			workflows = append(workflows, wf)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(workflows)
+}
+
+func (a *Api) GetWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "workflowName")
+
+	wf, err := a.Manager.GetWorkflow(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get workflow %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "workflow "+name, workflowNamespaces(wf)...) {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(wf)
+}
+
+func (a *Api) RunWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "workflowName")
+
+	wf, err := a.Manager.GetWorkflow(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get workflow %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "workflow "+name, workflowNamespaces(wf)...) {
+		return
+	}
+
+	run, err := a.Manager.RunWorkflow(name)
+	if err != nil {
+		status := lookupStatus(err)
+		switch {
+		case errors.Is(err, ErrWorkflowRunning):
+			status = http.StatusConflict
+		case errors.Is(err, ErrInvalidWorkflow):
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, fmt.Sprintf("[manager][api] unable to run workflow %s: %v", name, err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(run)
+}
+
+// GetWorkflowRunHandler returns one run of a workflow; the run ID "latest"
+// selects the most recent run.
+func (a *Api) GetWorkflowRunHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "workflowName")
+	runID := chi.URLParam(r, "runID")
+
+	wf, err := a.Manager.GetWorkflow(name)
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[manager][api] unable to get workflow %s: %v", name, err))
+		return
+	}
+	if hidden(w, r, "workflow "+name, workflowNamespaces(wf)...) {
+		return
+	}
+
+	var run *workflow.Run
+	if runID == "latest" {
+		run, err = wf.LatestRun()
+	} else {
+		var id uuid.UUID
+		id, err = uuid.Parse(runID)
+		if err == nil {
+			run, err = wf.GetRun(id)
+		}
+	}
+
+	if err != nil {
+		writeError(w, http.StatusNotFound, fmt.Sprintf("[manager][api] run %s of workflow %s not found", runID, name))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(run)
+}
+
+func (a *Api) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(a.Manager.GetTasks())
+	json.NewEncoder(w).Encode(a.Manager.GetNodes())
+}
+
+// WatchHandler streams changes of the requested kind as server-sent events.
+// Each event id is a cursor; clients resume by passing it back as ?cursor= or
+// in the Last-Event-ID header. Without a cursor the current tasks or nodes are
+// sent first so the client starts from a complete view.
+func (a *Api) WatchHandler(w http.ResponseWriter, r *http.Request) {
+	kind := r.URL.Query().Get("kind")
+	if kind == "" {
+		kind = WatchTasks
+	}
+
+	if !ValidWatchKind(kind) {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] unknown watch kind %q", kind))
+		return
+	}
+
+	c := r.URL.Query().Get("cursor")
+	if c == "" {
+		c = r.Header.Get("Last-Event-ID")
+	}
+
+	var cursor uint64
+	if c != "" {
+		var err error
+		cursor, err = strconv.ParseUint(c, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] invalid cursor %q", c))
+			return
+		}
+	}
+
+	scope, err := namespaceScope(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, "[manager][api] streaming is not supported")
+		return
+	}
+
+	head := a.Manager.Watcher.Cursor()
+	backlog, events, cancel, err := a.Manager.Watcher.Subscribe(kind, cursor)
+	if err != nil {
+		writeError(w, http.StatusGone, err.Error())
+		return
+	}
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+
+	if cursor == 0 {
+		switch kind {
+		case WatchTasks:
+			for _, t := range a.Manager.GetTasks() {
+				if inScope(scope, t.NamespaceOrDefault()) {
+					writeSnapshot(w, head, kind, t)
+				}
+			}
+		case WatchNodes:
+			for _, n := range a.Manager.GetNodes() {
+				writeSnapshot(w, head, kind, n)
+			}
+		}
+	}
+
+	for _, ev := range backlog {
+		if ev.inScope(scope) {
+			writeWatchEvent(w, ev)
+		}
+	}
+	flusher.Flush()
+
+	log.Printf("[manager][api] watcher connected for %s from cursor %d", kind, cursor)
+
+	keepalive := time.NewTicker(15 * time.Second)
+	defer keepalive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			log.Printf("[manager][api] watcher for %s disconnected", kind)
+			return
+		case <-keepalive.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+			flusher.Flush()
+		case ev, ok := <-events:
+			if !ok {
+				return
+			}
+			if !ev.inScope(scope) {
+				continue
+			}
+			writeWatchEvent(w, ev)
+			flusher.Flush()
+		}
+	}
+}
+
+func writeSnapshot(w http.ResponseWriter, cursor uint64, kind string, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		log.Printf("[manager][api] unable to marshal %s snapshot: %v", kind, err)
+		return
+	}
+	writeWatchEvent(w, WatchEvent{Cursor: cursor, Kind: kind, Type: "put", Timestamp: time.Now().UTC(), Object: data})
+}
+
+func writeWatchEvent(w http.ResponseWriter, ev WatchEvent) {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		log.Printf("[manager][api] unable to marshal watch event %d: %v", ev.Cursor, err)
+		return
+	}
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.Cursor, ev.Kind, data)
+}
+
+// BackupHandler streams a zip archive with a consistent snapshot of each of
+// the manager's stores.
+func (a *Api) BackupHandler(w http.ResponseWriter, r *http.Request) {
+	err := a.Manager.CanBackup()
+	if err != nil {
+		writeError(w, http.StatusConflict, fmt.Sprintf("[manager][api] unable to back up, use export instead: %v", err))
+		return
+	}
+
+	name := fmt.Sprintf("kanastar-backup-%s.zip", time.Now().UTC().Format("20060102-150405"))
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	w.WriteHeader(http.StatusOK)
+
+	err = a.Manager.Backup(w)
+	if err != nil {
+		// the status is already sent, the client sees a truncated archive
+		log.Printf("[manager][api] error writing backup: %v\n", err)
+	}
+}
+
+func (a *Api) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	state, err := a.Manager.Export()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(state)
+}
+
+func (a *Api) ImportHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	state := State{}
+	err := d.Decode(&state)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] error unmarshalling body: %v", err))
+		return
+	}
+
+	err = a.Manager.Import(&state)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[manager][api] unable to import state: %v", err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetNamespacesHandler lists the namespaces with their quota and what their
+// unfinished tasks use of it.
+func (a *Api) GetNamespacesHandler(w http.ResponseWriter, r *http.Request) {
+	scope, err := namespaceScope(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	all, err := a.Manager.Namespaces()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	namespaces := []Namespace{}
+	for _, ns := range all {
+		if inScope(scope, ns.Name) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(namespaces)
+}
+
+// GetConflictsHandler lists the disagreements between the stored tasks and
+// the workers found when the manager last resynced with them.
+func (a *Api) GetConflictsHandler(w http.ResponseWriter, r *http.Request) {
+	scope, err := namespaceScope(r)
+	if err != nil {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %v", err))
+		return
+	}
+
+	conflicts := []Conflict{}
+	for _, c := range a.Manager.Conflicts() {
+		if inScope(scope, c.Namespace) {
+			conflicts = append(conflicts, c)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(conflicts)
+}
+
+// GetClusterHandler describes the managers' Raft group as this manager sees
+// it, whether or not it is the leader.
+func (a *Api) GetClusterHandler(w http.ResponseWriter, r *http.Request) {
+	c := a.Manager.Cluster
+	if c == nil {
+		writeError(w, http.StatusNotFound, "[manager][api] manager is not part of a cluster")
+		return
+	}
+
+	status, err := c.Status()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(status)
+}
+
+// lookupStatus is the status to answer a failed lookup with: not found if the
+// key does not exist, an internal error if the store failed.
+func lookupStatus(err error) int {
+	if errors.Is(err, store.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	log.Print(msg)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: status, Message: msg})
 }
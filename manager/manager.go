@@ -1,39 +1,97 @@
 package manager
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/go-connections/nat"
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/cluster"
+	"github.com/surajsharma/kanastar/cronjob"
 	"github.com/surajsharma/kanastar/node"
 	"github.com/surajsharma/kanastar/scheduler"
+	"github.com/surajsharma/kanastar/service"
+	"github.com/surajsharma/kanastar/stats"
 	"github.com/surajsharma/kanastar/store"
 	"github.com/surajsharma/kanastar/task"
 	"github.com/surajsharma/kanastar/utils"
 	"github.com/surajsharma/kanastar/worker"
+	"github.com/surajsharma/kanastar/workflow"
 )
 
+const recentEventsLimit = 10
+
+type TaskDetail struct {
+	Task      *task.Task
+	Worker    string
+	Events    []*task.TaskEvent
+	Container *task.ContainerSummary
+}
+
 type Manager struct {
-	Pending       queue.Queue
-	TaskDb        store.Store
-	EventDb       store.Store
-	Workers       []string
-	WorkerTaskMap map[string][]uuid.UUID
-	TaskWorkerMap map[uuid.UUID]string
-	LastWorker    int
-	WorkerNodes   []*node.Node
-	Scheduler     scheduler.Scheduler
+	TaskDb         store.Store[task.Task]
+	EventDb        store.Store[task.TaskEvent]
+	ServiceDb      store.Store[service.Service]
+	CronJobDb      store.Store[cronjob.CronJob]
+	WorkflowDb     store.Store[workflow.Workflow]
+	Workers        []string
+	WorkerTaskMap  map[string][]uuid.UUID
+	TaskWorkerMap  map[uuid.UUID]string
+	WorkerFailures map[string]int
+	LastWorker     int
+	WorkerNodes    []*node.Node
+	Scheduler      scheduler.Scheduler
+	Watcher        *Broadcaster
+	Pending        *PendingQueue
+	Preemption     bool
+	// number of goroutines placing pending tasks
+	SchedulerWorkers    int
+	ReconcileInterval   time.Duration
+	UpdateInterval      time.Duration
+	HealthCheckInterval time.Duration
+	StatsInterval       time.Duration
+	MaxRestarts         int
+	MaxWorkerFailures   int
+	// how long and how many finished tasks and events are kept
+	TaskRetention   store.Retention
+	EventRetention  store.Retention
+	CompactInterval time.Duration
+	// Quotas caps what the unfinished tasks of each namespace may ask for,
+	// namespaces without one are not limited
+	Quotas map[string]Quota
+	// Cluster replicates the stores between managers, nil for a single
+	// manager
+	Cluster *cluster.Cluster
+
+	// mu guards WorkerTaskMap, TaskWorkerMap, WorkerFailures and the
+	// allocation and stats fields of WorkerNodes
+	mu sync.Mutex
+	// taskMu serializes read-modify-write of task records between the API
+	// and the worker updates, specMu does the same for services, cron jobs
+	// and workflows between the API and the reconciler. Where several are
+	// held, specMu comes first, then mu, then taskMu
+	taskMu      sync.Mutex
+	specMu      sync.Mutex
+	lastFree    map[string]capacity
+	conflicts   []Conflict
+	dispatchers map[string]chan uuid.UUID
+	wake        chan struct{}
+	stopping    chan struct{}
 }
 
-func New(workers []string, schedulerType string, dbType string) *Manager {
+// New creates a manager for the given workers. Its stores are of type dbType
+// and keep their files in dataDir.
+func New(workers []string, schedulerType string, dbType string, dataDir string) (*Manager, error) {
 
 	workerTaskMap := make(map[string][]uuid.UUID)
 	taskWorkerMap := make(map[uuid.UUID]string)
@@ -43,8 +101,8 @@ func New(workers []string, schedulerType string, dbType string) *Manager {
 	for worker := range workers {
 		workerTaskMap[workers[worker]] = []uuid.UUID{}
 
-		nAPI := fmt.Sprintf("http://%v", workers[worker])
-		n := node.NewNode(workers[worker], nAPI, "worker")
+		nAPI := fmt.Sprintf("%s://%v", utils.Scheme, workers[worker])
+		n := node.NewNode("worker", nAPI, workers[worker])
 		nodes = append(nodes, n)
 	}
 
@@ -60,51 +118,123 @@ func New(workers []string, schedulerType string, dbType string) *Manager {
 	}
 
 	m := Manager{
-		Pending:       *queue.New(),
-		Workers:       workers,
-		WorkerTaskMap: workerTaskMap,
-		TaskWorkerMap: taskWorkerMap,
-		WorkerNodes:   nodes,
-		Scheduler:     s,
+		Workers:             workers,
+		WorkerTaskMap:       workerTaskMap,
+		TaskWorkerMap:       taskWorkerMap,
+		WorkerFailures:      make(map[string]int),
+		WorkerNodes:         nodes,
+		Scheduler:           s,
+		Watcher:             NewBroadcaster(1000),
+		Pending:             NewPendingQueue(),
+		SchedulerWorkers:    DefaultSchedulerWorkers,
+		ReconcileInterval:   10 * time.Second,
+		UpdateInterval:      10 * time.Second,
+		HealthCheckInterval: 60 * time.Second,
+		StatsInterval:       15 * time.Second,
+		MaxRestarts:         3,
+		MaxWorkerFailures:   3,
+		CompactInterval:     5 * time.Minute,
+		lastFree:            make(map[string]capacity),
+		dispatchers:         make(map[string]chan uuid.UUID),
+		wake:                make(chan struct{}, 1),
+		stopping:            make(chan struct{}),
+	}
+
+	err := m.openStores(dbType, dataDir)
+	if err != nil {
+		return nil, err
 	}
 
-	var ts store.Store
-	var es store.Store
-	var errts, erres error
+	return &m, nil
+}
+
+// openStores opens the stores of the given type, keeping their files in
+// dataDir. On error the stores opened so far are closed again.
+func (m *Manager) openStores(dbType string, dataDir string) error {
+	file := func(name string) string { return filepath.Join(dataDir, name) }
 
 	switch dbType {
 	case "memory":
-		ts = store.NewInMemoryTaskStore()
-		es = store.NewInMemoryTaskEventStore()
+		m.TaskDb = store.NewMemoryStore[task.Task]("tasks")
+		m.EventDb = store.NewMemoryStore[task.TaskEvent]("events")
+		m.ServiceDb = store.NewMemoryStore[service.Service]("services")
+		m.CronJobDb = store.NewMemoryStore[cronjob.CronJob]("cronjobs")
+		m.WorkflowDb = store.NewMemoryStore[workflow.Workflow]("workflows")
 	case "persistent":
-		ts, errts = store.NewTaskStore("tasks.db", 0600, "tasks")
-		es, erres = store.NewEventStore("events.db", 0600, "events")
+		var err error
+		if m.TaskDb, err = openBolt[task.Task](file, "tasks"); err != nil {
+			return err
+		}
+		if m.EventDb, err = openBolt[task.TaskEvent](file, "events"); err != nil {
+			m.Close()
+			return err
+		}
+		if m.ServiceDb, err = openBolt[service.Service](file, "services"); err != nil {
+			m.Close()
+			return err
+		}
+		if m.CronJobDb, err = openBolt[cronjob.CronJob](file, "cronjobs"); err != nil {
+			m.Close()
+			return err
+		}
+		if m.WorkflowDb, err = openBolt[workflow.Workflow](file, "workflows"); err != nil {
+			m.Close()
+			return err
+		}
+	case "sqlite":
+		db, err := store.OpenSQLite(file(SQLiteFile), sqliteMigrations)
+		if err != nil {
+			return fmt.Errorf("[manager] unable to open %s: %v", file(SQLiteFile), err)
+		}
+		m.TaskDb = store.NewSQLiteStore(db, "tasks", taskColumns...)
+		m.EventDb = store.NewSQLiteStore(db, "events", eventColumns...)
+		m.ServiceDb = store.NewSQLiteStore[service.Service](db, "services")
+		m.CronJobDb = store.NewSQLiteStore[cronjob.CronJob](db, "cronjobs")
+		m.WorkflowDb = store.NewSQLiteStore[workflow.Workflow](db, "workflows")
+	default:
+		return fmt.Errorf("[manager] unknown store type %q, want memory, persistent or sqlite", dbType)
 	}
 
-	if errts != nil {
-		log.Fatalf("[manager] unable to create task store: \n%v", errts)
-	}
+	return nil
+}
 
-	if erres != nil {
-		log.Fatalf("[manager] unable to create task event store: \n%v", erres)
+// openBolt opens the bolt store <name>.db, or returns nil and the error.
+func openBolt[T any](file func(string) string, name string) (store.Store[T], error) {
+	s, err := store.NewBoltStore[T](file(name+".db"), 0600, name)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] unable to create %s store: %v", name, err)
 	}
-
-	m.TaskDb = ts
-	m.EventDb = es
-
-	return &m
+	return s, nil
 }
 
-func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
-	candidates := m.Scheduler.SelectCandidateNodes(t, m.WorkerNodes)
+// SelectWorker picks a worker for t. It works on a snapshot of the nodes, so
+// the returned node is a copy; the caller has to reserve room on the real one.
+func (m *Manager) SelectWorker(ctx context.Context, t task.Task) (*node.Node, error) {
+	nodes := m.GetNodes()
+	if len(nodes) == 0 {
+		return nil, &UnschedulableError{TaskID: t.ID, Reason: "no workers"}
+	}
+
+	var candidates []*node.Node
+	reason := "no matching workers"
+	for _, n := range m.Scheduler.SelectCandidateNodes(t, nodes) {
+		r := scheduler.UnfitReason(t, n, n.Memory-n.MemoryAllocated, n.Disk-n.DiskAllocated)
+		if r != "" {
+			reason = r
+			continue
+		}
+		candidates = append(candidates, n)
+	}
 
 	if candidates == nil {
-		msg := fmt.Sprintf("[manager] no available candidates match for task %v\n", t.ID)
-		err := errors.New(msg)
-		return nil, err
+		if reason == "no matching workers" && t.Disk > 0 {
+			// the scheduler's own candidate filter only looks at disk
+			reason = scheduler.ReasonInsufficientDisk
+		}
+		return nil, &UnschedulableError{TaskID: t.ID, Reason: reason}
 	}
 
-	scores := m.Scheduler.Score(t, candidates)
+	scores := m.Scheduler.Score(ctx, t, candidates)
 
 	if scores == nil {
 		return nil, fmt.Errorf("[manager] no scores returned to task %v", t)
@@ -114,285 +244,553 @@ func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
 	return selectedNode, nil
 }
 
-func (m *Manager) ProcessTasks() {
+// ProcessTasks runs the reconciler and the scheduling pipeline until ctx is
+// cancelled, then waits for the tasks being placed or dispatched to finish.
+func (m *Manager) ProcessTasks(ctx context.Context) {
+	pipeline := m.startPipeline(ctx)
+	defer pipeline.Wait()
+
 	for {
-		log.Println("[manager] processing any tasks in the queue")
-		m.SendWork()
-		utils.Sleep("manager", 10)
+		log.Println("[manager] reconciling desired and actual task state")
+		m.reconcile()
+
+		select {
+		case <-ctx.Done():
+			log.Println("[manager] stopping reconciler, draining scheduling pipeline")
+			close(m.stopping)
+			m.Pending.Close()
+			return
+		case <-m.wake:
+		case <-time.After(m.ReconcileInterval):
+		}
 	}
 }
 
-func (m *Manager) UpdateTasks() {
+// Close closes the manager's stores. Call it once the loops have returned.
+func (m *Manager) Close() {
+	closeStore("tasks", m.TaskDb)
+	closeStore("events", m.EventDb)
+	closeStore("services", m.ServiceDb)
+	closeStore("cronjobs", m.CronJobDb)
+	closeStore("workflows", m.WorkflowDb)
+}
+
+func (m *Manager) UpdateTasks(ctx context.Context) {
 	for {
 		log.Println("[manager] checking for task updates from worker")
 		m.updateTasks()
 		log.Println("[manager] task updates completed")
-		utils.Sleep("manager", 10)
+		if !utils.SleepContext(ctx, "manager", m.UpdateInterval) {
+			return
+		}
 	}
 }
 
 func (m *Manager) updateTasks() {
+	finished := false
+	defer func() {
+		if finished {
+			m.Wake()
+		}
+	}()
+
 	for _, worker := range m.Workers {
 
 		log.Printf("[manager] checking worker %v for task updates\n", worker)
 
-		url := fmt.Sprintf("http://%s/tasks", worker)
-
-		resp, err := http.Get(url)
-
-		if err != nil {
-			log.Printf("[manager] error connecting to %v:%v, retrying in 5 seconds", worker, err)
+		tasks, err := fetchWorkerTasks(worker)
+		if errors.Is(err, errWorkerUnreachable) {
+			log.Printf("[manager] %v, retrying in 5 seconds", err)
+			m.workerUnreachable(worker)
 			continue
 		}
 
-		if resp.StatusCode != http.StatusOK {
-			log.Printf("[manager] error sending request to worker url: %v\n", err)
-			continue
-		}
-
-		d := json.NewDecoder(resp.Body)
-		var tasks []*task.Task
-		err = d.Decode(&tasks)
+		m.mu.Lock()
+		m.WorkerFailures[worker] = 0
+		m.mu.Unlock()
 
 		if err != nil {
-			log.Printf("[manager] error unmarshalling tasks: %s\n", err.Error())
+			log.Printf("[manager] %v\n", err)
 		}
 
 		for _, t := range tasks {
 			log.Printf("[manager] attempting to update task %v\n", t.ID)
-
-			result, err := m.TaskDb.Get(t.ID.String())
-			if err != nil {
-				log.Printf("[manager] could not get task %s with error:\n\t %s\n", t.ID.String(), err)
-				continue
+			done, settled := m.updateTask(worker, t)
+			if done {
+				// capacity was freed or a restart is due, don't wait for the tick
+				finished = true
 			}
-
-			taskPersisted, ok := result.(*task.Task)
-			if !ok {
-				log.Printf("[manager] cannot convert result %v to task.Task type\n", result)
-				continue
-			}
-
-			if taskPersisted.State != t.State {
-				taskPersisted.State = t.State
+			if settled {
+				if n := m.getNode(worker); n != nil {
+					m.acknowledgeTask(n, t.ID.String())
+				}
 			}
-
-			taskPersisted.StartTime = t.StartTime
-			taskPersisted.FinishTime = t.FinishTime
-			taskPersisted.ContainerID = t.ContainerID
-			taskPersisted.HostPorts = t.HostPorts
-
-			m.TaskDb.Put(taskPersisted.ID.String(), taskPersisted)
 		}
 
 	}
 }
 
-func (m *Manager) SendWork() {
-	if m.Pending.Len() > 0 {
+var errWorkerUnreachable = errors.New("[manager] worker unreachable")
 
-		e := m.Pending.Dequeue()
-		te := e.(task.TaskEvent)
+// fetchWorkerTasks returns the tasks worker has a record of. The error wraps
+// errWorkerUnreachable if the worker did not answer.
+func fetchWorkerTasks(worker string) ([]*task.Task, error) {
+	url := fmt.Sprintf("%s://%s/tasks", utils.Scheme, worker)
 
-		err := m.EventDb.Put(te.ID.String(), &te)
-		if err != nil {
-			log.Printf("[manager]error attempting to store task event %s: %s\n", te.ID.String(), err)
-		}
+	resp, err := utils.HTTP.Get(url)
+	if err != nil {
+		return nil, fmt.Errorf("%w: error connecting to %v: %v", errWorkerUnreachable, worker, err)
+	}
+	defer resp.Body.Close()
 
-		log.Printf("[manager] pulled %v off pending queue\n", te)
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: request to %v failed: %v", errWorkerUnreachable, url, resp.Status)
+	}
 
-		t := te.Task
-		w, err := m.SelectWorker(t)
-		if err != nil {
-			log.Printf("[manager] error selecting worker for task %s : %v", t.ID, err)
-			return
+	var tasks []*task.Task
+	err = json.NewDecoder(resp.Body).Decode(&tasks)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] error unmarshalling tasks of %v: %v", worker, err)
+	}
+	return tasks, nil
+}
+
+// updateTask copies what worker reports about t onto the stored task. It
+// reports whether the task has just finished, and whether the worker's record
+// of it is no longer needed because the manager is done with the task.
+func (m *Manager) updateTask(worker string, t *task.Task) (bool, bool) {
+	assigned := m.assignedWorker(t.ID)
+	if assigned == "" && active(t) && m.adoptTask(worker, t) {
+		return false, false
+	}
+	if assigned != worker {
+		// the task was moved off this worker, e.g. after it was lost,
+		// so anything it still runs for the task is a leftover
+		if t.State == task.Scheduled || t.State == task.Running {
+			log.Printf("[manager] task %v is assigned to %q, stopping leftover copy on %v\n", t.ID, assigned, worker)
+			if n := m.getNode(worker); n != nil {
+				m.stopTask(n, t.ID.String())
+			}
+			return false, false
 		}
+		return false, t.State == task.Completed || t.State == task.Failed
+	}
 
-		log.Printf("[manager] selected worker [%s] for task [%s]", w.Name, t.ID)
+	if (t.State == task.Completed || t.State == task.Failed) && m.requeuePreempted(t.ID) {
+		return true, false
+	}
 
-		_, ok := m.TaskWorkerMap[te.Task.ID]
+	m.taskMu.Lock()
+	defer m.taskMu.Unlock()
 
-		if ok {
+	taskPersisted, err := m.TaskDb.Get(t.ID.String())
+	if err != nil {
+		log.Printf("[manager] could not get task %s with error:\n\t %s\n", t.ID.String(), err)
+		return false, false
+	}
 
-			result, err := m.TaskDb.Get(te.Task.ID.String())
+	finished := false
+	if taskPersisted.State != t.State {
+		finished = t.State == task.Completed || t.State == task.Failed
+		taskPersisted.State = t.State
+	}
 
-			if err != nil {
-				log.Printf("[manager] unable to schedule task %s", err)
-				return
-			}
+	taskPersisted.StartTime = t.StartTime
+	taskPersisted.FinishTime = t.FinishTime
+	taskPersisted.ContainerID = t.ContainerID
+	taskPersisted.HostPorts = t.HostPorts
 
-			persistedTask, ok := result.(*task.Task)
+	err = m.storeTask(taskPersisted)
+	if err != nil {
+		log.Printf("[manager] error storing task %v: %v\n", t.ID, err)
+		return finished, false
+	}
+	return finished, m.settled(taskPersisted)
+}
 
-			if !ok {
-				log.Printf("[manager] unable to convert task to *task.Task type\n")
-				return
-			}
+// AddTask records the intent carried by a task event. A new task is stored
+// as Pending with a desired state of Running; an event for an existing task
+// only updates its desired state. The reconciler converges the rest.
+func (m *Manager) AddTask(te task.TaskEvent) error {
+	m.taskMu.Lock()
+	defer m.taskMu.Unlock()
 
-			if te.State == task.Completed && task.ValidStateTransitions(persistedTask.State, te.State) {
-				m.stopTask(w, te.Task.ID.String())
-				return
-			}
+	desired := task.Running
+	if te.State == task.Completed {
+		desired = task.Completed
+	}
 
-			log.Printf("[manager] invalid request: existing task %s is in state %v and cannot transition to the completed state", persistedTask.ID.String(), persistedTask.State)
-			return
+	existing, err := m.TaskDb.Get(te.Task.ID.String())
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("[manager] error looking up task %v: %v", te.Task.ID, err)
+	}
 
+	if existing == nil {
+		if desired == task.Completed {
+			return fmt.Errorf("[manager] cannot stop unknown task %v", te.Task.ID)
 		}
 
-		m.WorkerTaskMap[w.Name] = append(m.WorkerTaskMap[w.Name], te.Task.ID)
-		m.TaskWorkerMap[t.ID] = w.Name
+		if !task.ValidPriorityClass(te.Task.PriorityClass) {
+			return fmt.Errorf("[manager] unknown priority class %q", te.Task.PriorityClass)
+		}
 
-		t.State = task.Scheduled
-		m.TaskDb.Put(t.ID.String(), &t)
+		if !task.ValidNamespace(te.Task.Namespace) {
+			return fmt.Errorf("[manager] invalid namespace %q", te.Task.Namespace)
+		}
+
+		t := te.Task
+		t.State = task.Pending
+		t.DesiredState = desired
+		t.SubmittedAt = time.Now().UTC()
+		t.Namespace = t.NamespaceOrDefault()
 
-		data, err := json.Marshal(te)
+		err = m.checkQuota(&t)
 		if err != nil {
-			log.Printf("[manager] unable to marshal task object: %v\n", t)
+			return err
 		}
 
-		url := fmt.Sprintf("%s/tasks", w.Api)
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+		err = m.storeTask(&t)
 		if err != nil {
-			log.Printf("[manager] error connecting to %v: %v\n", w, err)
-			m.Pending.Enqueue(te)
-			return
+			return fmt.Errorf("[manager] error storing task %v: %v", t.ID, err)
 		}
 
-		d := json.NewDecoder(resp.Body)
-		if resp.StatusCode != http.StatusCreated {
-			e := worker.ErrResponse{}
-			err := d.Decode(&e)
-			if err != nil {
-				fmt.Printf("[manager] error decoding response: %s\n", err.Error())
-				return
-			}
-			log.Printf("[manager] response error (%d): %s\n", e.HTTPStatusCode, e.Message)
-			return
+		m.Pending.Push(&t)
+	} else {
+		t := existing
+
+		if te.Task.Namespace != "" && te.Task.Namespace != t.NamespaceOrDefault() {
+			return fmt.Errorf("[manager] task %v belongs to namespace %s, it cannot move to %s", t.ID, t.NamespaceOrDefault(), te.Task.Namespace)
 		}
 
-		t = task.Task{}
-		err = d.Decode(&t)
-		if err != nil {
-			fmt.Printf("[manager] error decoding response: %s\n", err.Error())
-			return
+		if t.DesiredState != desired && !task.ValidDesiredTransition(t.DesiredState, desired) {
+			return fmt.Errorf("[manager] task %v cannot go from desired state %v to %v", t.ID, t.DesiredState, desired)
 		}
 
-		w.TaskCount++
-		log.Printf("[manager] received response from worker: %#v\n", t)
+		t.DesiredState = desired
 
-	} else {
-		log.Println("[manager] no work in the queue")
+		err = m.storeTask(t)
+		if err != nil {
+			return fmt.Errorf("[manager] error storing task %v: %v", t.ID, err)
+		}
 	}
-}
 
-func (m *Manager) AddTask(te task.TaskEvent) {
-	m.Pending.Enqueue(te)
+	err = m.putEvent(&te)
+	if err != nil {
+		log.Printf("[manager] error attempting to store task event %s: %s\n", te.ID.String(), err)
+	}
+
+	m.Wake()
+	return nil
 }
 
 func (m *Manager) GetTasks() []*task.Task {
-	taskList, err := m.TaskDb.List()
+	tasks, err := store.All(m.TaskDb)
 
 	if err != nil {
 		log.Printf("[manager] error getting list of tasks: %v\n", err)
 		return nil
 	}
 
-	return taskList.([]*task.Task)
+	return tasks
 
 }
 
-func (m *Manager) DoHealthChecks() {
-	for {
-		log.Printf("[manager] performing task health check..")
-		m.doHealthChecks()
-		log.Printf("[manager] task health checks completed")
-		utils.Sleep("manager", 60)
+// TaskFilter narrows ListTasks down. Zero fields match every task.
+type TaskFilter struct {
+	State  *task.State
+	Worker string
+	Labels map[string]string
+	// Namespaces keeps the tasks of any of these namespaces
+	Namespaces []string
+	Offset     int
+	Limit      int
+}
+
+func (f TaskFilter) match(t *task.Task) bool {
+	if f.State != nil && t.State != *f.State {
+		return false
+	}
+	if len(f.Namespaces) > 0 && !slices.Contains(f.Namespaces, t.NamespaceOrDefault()) {
+		return false
+	}
+	if f.Worker != "" && t.Worker != f.Worker {
+		return false
+	}
+	for k, v := range f.Labels {
+		if t.Labels[k] != v {
+			return false
+		}
 	}
+	return true
 }
 
-func (m *Manager) doHealthChecks() {
-	for _, t := range m.GetTasks() {
-		if t.State == task.Running && t.RestartCount < 3 {
-			err := m.checkHealthTask(*t)
+// ListTasks returns one page of the tasks matching f.
+func (m *Manager) ListTasks(f TaskFilter) (store.Page[task.Task], error) {
+	where := make(map[string]interface{})
+	if f.State != nil {
+		where["state"] = int(*f.State)
+	}
+	if f.Worker != "" {
+		where["worker"] = f.Worker
+	}
+	if len(f.Namespaces) == 1 {
+		where["namespace"] = f.Namespaces[0]
+	}
 
-			if err != nil {
-				if t.RestartCount < 3 {
-					m.restartTask(t)
-				}
-			} else if t.State == task.Failed && t.RestartCount < 3 {
-				m.restartTask(t)
-			}
-		}
+	return m.TaskDb.List(store.Query[task.Task]{
+		Match:  f.match,
+		Offset: f.Offset,
+		Limit:  f.Limit,
+		Where:  where,
+	})
+}
+
+func closeStore[T any](name string, s store.Store[T]) {
+	if s == nil {
+		return
+	}
+	err := s.Close()
+	if err != nil {
+		log.Printf("[manager] error closing %s store: %v\n", name, err)
 	}
 }
 
-func (m *Manager) restartTask(t *task.Task) {
-	//get the worker where task was runnng
+// DescribeTask gathers everything the manager knows about a task: the stored
+// record, the worker it is assigned to, its most recent events and, if the
+// worker can be reached, a summary of the container backing it.
+func (m *Manager) DescribeTask(id uuid.UUID) (*TaskDetail, error) {
+	result, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
 
-	w := m.TaskWorkerMap[t.ID]
+	detail := TaskDetail{
+		Task:   result,
+		Worker: m.assignedWorker(id),
+	}
 
-	t.State = task.Scheduled
+	events, err := m.EventDb.List(store.Query[task.TaskEvent]{
+		Match: func(te *task.TaskEvent) bool { return te.Task.ID == id },
+		Where: map[string]interface{}{"task_id": id.String()},
+	})
+	if err != nil {
+		log.Printf("[manager] error getting list of events: %v\n", err)
+	} else {
+		detail.Events = events.Items
+	}
 
-	t.RestartCount++
+	sort.Slice(detail.Events, func(i, j int) bool {
+		return detail.Events[i].Timestamp.After(detail.Events[j].Timestamp)
+	})
 
-	//we need to overwrite the existing task to ensure it has current state
-	m.TaskDb.Put(t.ID.String(), t)
+	if len(detail.Events) > recentEventsLimit {
+		detail.Events = detail.Events[:recentEventsLimit]
+	}
 
-	te := task.TaskEvent{
-		ID:        uuid.New(),
-		State:     task.Running,
-		Timestamp: time.Now(),
-		Task:      *t,
+	n := m.getNode(detail.Worker)
+	if n == nil {
+		return &detail, nil
 	}
 
-	data, err := json.Marshal(te)
+	url := fmt.Sprintf("%s/tasks/%s", n.Api, id)
+	resp, err := utils.HTTP.Get(url)
+	if err != nil {
+		log.Printf("[manager] error connecting to %v: %v\n", n.Name, err)
+		return &detail, nil
+	}
+	defer resp.Body.Close()
 
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("[manager] worker %v could not describe task %v: %v\n", n.Name, id, resp.StatusCode)
+		return &detail, nil
+	}
+
+	wd := worker.TaskDetail{}
+	err = json.NewDecoder(resp.Body).Decode(&wd)
 	if err != nil {
-		log.Printf("Unable to marshal task object: %v\n", t)
-		return
+		log.Printf("[manager] error decoding response: %s\n", err.Error())
+		return &detail, nil
+	}
+
+	detail.Container = wd.Container
+	return &detail, nil
+}
+
+func (m *Manager) getNode(name string) *node.Node {
+	for _, n := range m.WorkerNodes {
+		if n.Name == name {
+			return n
+		}
 	}
+	return nil
+}
 
-	url := fmt.Sprintf("http://%s/tasks", w)
+// modifyTask applies change to the stored copy of task id under m.taskMu
+// and stores the result, so only the fields change sets are written and
+// whatever the workers or the API updated since the caller read the task is
+// kept. change returns false to leave the task untouched, e.g. because it
+// has moved on meanwhile. The task as stored afterwards is returned.
+func (m *Manager) modifyTask(id uuid.UUID, change func(t *task.Task) bool) (*task.Task, error) {
+	m.taskMu.Lock()
+	defer m.taskMu.Unlock()
 
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	t, err := m.TaskDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
 
+	if !change(t) {
+		return t, nil
+	}
+
+	err = m.storeTask(t)
 	if err != nil {
-		log.Printf("[manager] error connecting to %v: %v\n", w, err)
-		m.Pending.Enqueue(t)
-		return
+		log.Printf("[manager] error storing task %v: %v\n", id, err)
+		return nil, err
+	}
+	return t, nil
+}
+
+// storeTask stores t for callers already holding m.taskMu.
+func (m *Manager) storeTask(t *task.Task) error {
+	err := m.TaskDb.Put(t.ID.String(), t)
+	if err != nil {
+		return err
 	}
+	m.Watcher.Publish(WatchTasks, "put", t)
+	return nil
+}
 
-	d := json.NewDecoder(resp.Body)
+func (m *Manager) putEvent(te *task.TaskEvent) error {
+	err := m.EventDb.Put(te.ID.String(), te)
+	if err != nil {
+		return err
+	}
+	m.Watcher.Publish(WatchEvents, "put", te)
+	return nil
+}
 
-	if resp.StatusCode != http.StatusCreated {
-		e := worker.ErrResponse{}
+// GetNodes returns a copy of the worker nodes taken under the manager's lock.
+func (m *Manager) GetNodes() []*node.Node {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 
-		err := d.Decode(&e)
+	nodes := make([]*node.Node, 0, len(m.WorkerNodes))
+	for _, n := range m.WorkerNodes {
+		c := *n
+		nodes = append(nodes, &c)
+	}
+	return nodes
+}
 
-		if err != nil {
-			fmt.Printf("[manager] error decoding response: %s\n", err.Error())
+func (m *Manager) UpdateNodeStats(ctx context.Context) {
+	for {
+		log.Println("[manager] collecting stats for nodes")
+		m.updateNodeStats(ctx)
+		if !utils.SleepContext(ctx, "manager", m.StatsInterval) {
 			return
 		}
+	}
+}
 
-		log.Printf("[manager] response err (%d): %s\n", e.HTTPStatusCode, e.Message)
-		return
+func (m *Manager) updateNodeStats(ctx context.Context) {
+	for _, n := range m.WorkerNodes {
+		log.Printf("[manager] collecting stats for node %v", n.Name)
+
+		// fetch into a copy so the scheduling workers never see a half
+		// updated node
+		c := node.Node{Name: n.Name, Api: n.Api}
+		_, err := c.GetStats(ctx)
+		if err != nil {
+			log.Printf("[manager] error updating node stats: %v", err)
+			continue
+		}
+
+		m.reportOrphans(n, c.Stats.Orphans)
+
+		m.mu.Lock()
+		n.Memory = c.Memory
+		n.Disk = c.Disk
+		n.Stats = c.Stats
+		n.TaskCount = c.Stats.TaskCount
+		snapshot := *n
+		m.mu.Unlock()
+
+		m.Watcher.Publish(WatchNodes, "put", &snapshot)
 	}
+}
 
-	newTask := task.Task{}
+// reportOrphans logs the orphaned containers n reports that it did not
+// report last time. An orphan of a task the manager has on n means the worker
+// lost its record of the task, and the task runs in a container nothing
+// manages any more.
+func (m *Manager) reportOrphans(n *node.Node, orphans []stats.Orphan) {
+	seen := make(map[string]bool, len(n.Stats.Orphans))
+	for _, o := range n.Stats.Orphans {
+		seen[o.ContainerID] = true
+	}
 
-	err = d.Decode(&newTask)
+	for _, o := range orphans {
+		if seen[o.ContainerID] {
+			continue
+		}
+		id, err := uuid.Parse(o.TaskID)
+		if err == nil && m.assignedWorker(id) == n.Name {
+			log.Printf("[manager] worker %v lost its record of task %v, its container %v is orphaned (%s)\n", n.Name, id, o.ContainerID, o.Action)
+			continue
+		}
+		log.Printf("[manager] worker %v reports orphaned container %v of task %q: %s (%s)\n", n.Name, o.ContainerID, o.TaskID, o.Reason, o.Action)
+	}
+}
 
-	if err != nil {
-		fmt.Printf("[manager] error decoding response: %s\n", err.Error())
-		return
+func (m *Manager) DoHealthChecks(ctx context.Context) {
+	for {
+		log.Printf("[manager] performing task health check..")
+		m.doHealthChecks()
+		log.Printf("[manager] task health checks completed")
+		if !utils.SleepContext(ctx, "manager", m.HealthCheckInterval) {
+			return
+		}
+	}
+}
+
+func (m *Manager) doHealthChecks() {
+	for _, t := range m.GetTasks() {
+		if t.State == task.Running && t.DesiredState == task.Running {
+			err := m.checkHealthTask(*t)
+
+			if err != nil {
+				// the container is up but not serving; treat it as failed
+				// and let the reconcile loop, the only one that restarts
+				// tasks, decide whether to restart it
+				m.markUnhealthy(t)
+				m.Wake()
+			}
+		}
 	}
+}
+
+// markUnhealthy marks t Failed, unless it changed since the health check
+// read it, e.g. because it was restarted or stopped meanwhile.
+func (m *Manager) markUnhealthy(t *task.Task) {
+	m.taskMu.Lock()
+	defer m.taskMu.Unlock()
 
-	log.Printf("%#v\n", t)
+	current, err := m.TaskDb.Get(t.ID.String())
+	if err != nil || current.State != task.Running || current.ContainerID != t.ContainerID {
+		return
+	}
 
+	current.State = task.Failed
+	err = m.storeTask(current)
+	if err != nil {
+		log.Printf("[manager] error storing task %v: %v\n", t.ID, err)
+	}
 }
 
 func (m *Manager) stopTask(worker *node.Node, taskID string) {
 
-	client := &http.Client{}
+	client := utils.HTTP
 
 	url := fmt.Sprintf("%s/tasks/%s", worker.Api, taskID)
 
@@ -422,7 +820,7 @@ func (m *Manager) stopTask(worker *node.Node, taskID string) {
 func (m *Manager) checkHealthTask(t task.Task) error {
 	log.Printf("[manager] calling health check for task %s: %s\n", t.ID, t.HealthCheck)
 
-	w := m.TaskWorkerMap[t.ID]
+	w := m.assignedWorker(t.ID)
 
 	worker := strings.Split(w, ":")
 
@@ -433,6 +831,7 @@ func (m *Manager) checkHealthTask(t task.Task) error {
 		return nil
 	}
 
+	// the task's own endpoint, not a Kanastar API
 	url := fmt.Sprintf("http://%s:%s%s", worker[0], *hostPort, t.HealthCheck)
 	log.Printf("[manager] calling health check for task %s: %s\n", t.ID, url)
 
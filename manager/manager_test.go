@@ -0,0 +1,235 @@
+package manager
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/c9s/goprocinfo/linux"
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/stats"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// fakeWorker answers the worker API the manager uses, without docker. A
+// started task is reported Running at once and a stopped one Completed.
+type fakeWorker struct {
+	mu    sync.Mutex
+	tasks map[uuid.UUID]task.Task
+}
+
+// newFakeWorker starts a fake worker that already has a record of tasks.
+func newFakeWorker(t *testing.T, tasks ...task.Task) string {
+	w := &fakeWorker{tasks: make(map[uuid.UUID]task.Task)}
+	for _, tk := range tasks {
+		w.tasks[tk.ID] = tk
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /tasks", w.start)
+	mux.HandleFunc("GET /tasks", w.list)
+	mux.HandleFunc("DELETE /tasks/{id}", w.stop)
+	mux.HandleFunc("GET /stats", w.stats)
+
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://")
+}
+
+func (w *fakeWorker) start(rw http.ResponseWriter, r *http.Request) {
+	te := task.TaskEvent{}
+	if err := json.NewDecoder(r.Body).Decode(&te); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t := te.Task
+	t.State = task.Running
+	t.ContainerID = "c-" + t.ID.String()
+	t.StartTime = time.Now().UTC()
+
+	w.mu.Lock()
+	w.tasks[t.ID] = t
+	w.mu.Unlock()
+
+	rw.WriteHeader(http.StatusCreated)
+	json.NewEncoder(rw).Encode(t)
+}
+
+func (w *fakeWorker) list(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	tasks := make([]task.Task, 0, len(w.tasks))
+	for _, t := range w.tasks {
+		tasks = append(tasks, t)
+	}
+	w.mu.Unlock()
+
+	json.NewEncoder(rw).Encode(tasks)
+}
+
+func (w *fakeWorker) stop(rw http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.mu.Lock()
+	t, ok := w.tasks[id]
+	if ok {
+		t.State = task.Completed
+		t.FinishTime = time.Now().UTC()
+		w.tasks[id] = t
+	}
+	w.mu.Unlock()
+
+	if !ok {
+		http.Error(rw, "no such task", http.StatusNotFound)
+		return
+	}
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (w *fakeWorker) stats(rw http.ResponseWriter, r *http.Request) {
+	w.mu.Lock()
+	count := len(w.tasks)
+	w.mu.Unlock()
+
+	json.NewEncoder(rw).Encode(stats.Stats{
+		MemStats:  &linux.MemInfo{MemTotal: 1 << 30, MemAvailable: 1 << 30},
+		DiskStats: &linux.Disk{All: 1 << 40, Free: 1 << 40},
+		CpuStats:  &linux.CPUStat{},
+		LoadStats: &linux.LoadAvg{},
+		TaskCount: count,
+	})
+}
+
+// TestConcurrentSubmitAndStop submits and stops tasks from many goroutines
+// while the manager dispatches them and takes in the worker updates. Run it
+// with -race.
+func TestConcurrentSubmitAndStop(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	workers := []string{newFakeWorker(t), newFakeWorker(t)}
+	m, err := New(workers, "roundrobin", "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	pipeline := m.startPipeline(ctx)
+
+	var loops sync.WaitGroup
+	every := func(f func()) {
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			for {
+				f()
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(10 * time.Millisecond):
+				}
+			}
+		}()
+	}
+	every(m.reconcile)
+	every(m.updateTasks)
+	every(func() { m.updateNodeStats(ctx) })
+	defer func() {
+		cancel()
+		loops.Wait()
+		close(m.stopping)
+		m.Pending.Close()
+		pipeline.Wait()
+		m.Close()
+	}()
+
+	const submitters = 8
+	const perSubmitter = 20
+
+	var wg sync.WaitGroup
+	var idsMu sync.Mutex
+	stopped := make(map[uuid.UUID]bool)
+
+	for i := 0; i < submitters; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perSubmitter; j++ {
+				tk := task.Task{ID: uuid.New(), Name: "stress", Image: "busybox", Memory: 1000, Disk: 1}
+				err := m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Scheduled, Timestamp: time.Now().UTC(), Task: tk})
+				if err != nil {
+					t.Errorf("submitting task %v: %v", tk.ID, err)
+					return
+				}
+
+				idsMu.Lock()
+				stopped[tk.ID] = j%2 == 0
+				idsMu.Unlock()
+
+				if j%2 != 0 {
+					continue
+				}
+				err = m.AddTask(task.TaskEvent{ID: uuid.New(), State: task.Completed, Timestamp: time.Now().UTC(), Task: task.Task{ID: tk.ID}})
+				if err != nil {
+					t.Errorf("stopping task %v: %v", tk.ID, err)
+					return
+				}
+			}
+		}()
+	}
+
+	// readers alongside the writers
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				m.GetTasks()
+				m.GetNodes()
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	wg.Wait()
+	if t.Failed() {
+		return
+	}
+
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		pending := 0
+		for _, tk := range m.GetTasks() {
+			want := task.Running
+			if stopped[tk.ID] {
+				want = task.Completed
+			}
+			if tk.State != want {
+				pending++
+			}
+		}
+		if pending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d of %d tasks did not reach their desired state", pending, len(stopped))
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if n := len(m.GetTasks()); n != submitters*perSubmitter {
+		t.Fatalf("manager has %d tasks, want %d", n, submitters*perSubmitter)
+	}
+}
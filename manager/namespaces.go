@@ -0,0 +1,245 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/surajsharma/kanastar/auth"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/workflow"
+)
+
+var ErrQuotaExceeded = errors.New("[manager] namespace quota exceeded")
+
+// Quota caps what the unfinished tasks of a namespace may ask for in total:
+// memory and disk in bytes, like the tasks' own Memory and Disk, CPUs, and
+// the number of tasks. Zero means no limit.
+type Quota struct {
+	Memory int64
+	Disk   int64
+	Cpu    float64
+	Tasks  int
+}
+
+// Usage is what the unfinished tasks of a namespace ask for in total.
+type Usage struct {
+	Memory int64
+	Disk   int64
+	Cpu    float64
+	Tasks  int
+}
+
+func (u *Usage) add(t *task.Task) {
+	u.Memory += t.Memory
+	u.Disk += t.Disk
+	u.Cpu += t.Cpu
+	u.Tasks++
+}
+
+// exceeds returns what u goes over q on, if anything.
+func (u Usage) exceeds(q Quota) string {
+	switch {
+	case q.Memory > 0 && u.Memory > q.Memory:
+		return fmt.Sprintf("memory %d of %d", u.Memory, q.Memory)
+	case q.Disk > 0 && u.Disk > q.Disk:
+		return fmt.Sprintf("disk %d of %d", u.Disk, q.Disk)
+	case q.Cpu > 0 && u.Cpu > q.Cpu:
+		return fmt.Sprintf("cpu %g of %g", u.Cpu, q.Cpu)
+	case q.Tasks > 0 && u.Tasks > q.Tasks:
+		return fmt.Sprintf("tasks %d of %d", u.Tasks, q.Tasks)
+	}
+	return ""
+}
+
+// Namespace is a namespace with its quota and what it uses of it.
+type Namespace struct {
+	Name  string
+	Quota *Quota `json:",omitempty"`
+	Usage Usage
+}
+
+// counts reports whether t counts against the quota of its namespace: it
+// is wanted running and has not finished yet.
+func counts(t *task.Task) bool {
+	return t.DesiredState == task.Running && (t.State == task.Pending || active(t))
+}
+
+// usage adds up the tasks of namespace that count against its quota.
+func (m *Manager) usage(namespace string) (Usage, error) {
+	page, err := m.TaskDb.List(store.Query[task.Task]{
+		Match: func(t *task.Task) bool { return t.NamespaceOrDefault() == namespace && counts(t) },
+		Where: map[string]interface{}{"namespace": namespace},
+	})
+	if err != nil {
+		return Usage{}, fmt.Errorf("[manager] unable to list tasks of namespace %s: %v", namespace, err)
+	}
+
+	var u Usage
+	for _, t := range page.Items {
+		u.add(t)
+	}
+	return u, nil
+}
+
+// checkQuota returns ErrQuotaExceeded if adding t would take its namespace
+// over its quota. It is called with taskMu held, so the tasks it counts do
+// not change before t is stored.
+func (m *Manager) checkQuota(t *task.Task) error {
+	q, ok := m.Quotas[t.NamespaceOrDefault()]
+	if !ok {
+		return nil
+	}
+
+	u, err := m.usage(t.NamespaceOrDefault())
+	if err != nil {
+		return err
+	}
+	u.add(t)
+
+	if over := u.exceeds(q); over != "" {
+		return fmt.Errorf("%w: %s would use %s", ErrQuotaExceeded, t.NamespaceOrDefault(), over)
+	}
+	return nil
+}
+
+// Namespaces returns the namespaces that have a quota or tasks, with what
+// their unfinished tasks use.
+func (m *Manager) Namespaces() ([]Namespace, error) {
+	usage := make(map[string]*Usage)
+	for name := range m.Quotas {
+		usage[name] = &Usage{}
+	}
+
+	tasks, err := store.All(m.TaskDb)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] unable to list tasks: %v", err)
+	}
+	for _, t := range tasks {
+		u, ok := usage[t.NamespaceOrDefault()]
+		if !ok {
+			u = &Usage{}
+			usage[t.NamespaceOrDefault()] = u
+		}
+		if counts(t) {
+			u.add(t)
+		}
+	}
+
+	namespaces := make([]Namespace, 0, len(usage))
+	for name, u := range usage {
+		ns := Namespace{Name: name, Usage: *u}
+		if q, ok := m.Quotas[name]; ok {
+			ns.Quota = &q
+		}
+		namespaces = append(namespaces, ns)
+	}
+	sort.Slice(namespaces, func(i, j int) bool { return namespaces[i].Name < namespaces[j].Name })
+	return namespaces, nil
+}
+
+// namespaceScope returns the namespaces r may see, nil for all of them: the
+// one named by the namespace query parameter, if it is given, within the
+// ones the request's token is limited to.
+func namespaceScope(r *http.Request) ([]string, error) {
+	requested := r.URL.Query().Get("namespace")
+	id, ok := auth.FromContext(r.Context())
+
+	switch {
+	case requested != "" && ok && !id.InNamespace(requested):
+		return nil, fmt.Errorf("%s may not see namespace %s", id.Name, requested)
+	case requested != "":
+		return []string{requested}, nil
+	case ok && len(id.Namespaces) > 0:
+		return id.Namespaces, nil
+	}
+	return nil, nil
+}
+
+// inScope reports whether every one of namespaces is in scope, as returned
+// by namespaceScope.
+func inScope(scope []string, namespaces ...string) bool {
+	if scope == nil {
+		return true
+	}
+	for _, ns := range namespaces {
+		if !slices.Contains(scope, ns) {
+			return false
+		}
+	}
+	return true
+}
+
+// mayUse reports whether the token of r may see and change the tasks of
+// every one of namespaces.
+func mayUse(r *http.Request, namespaces ...string) bool {
+	id, ok := auth.FromContext(r.Context())
+	if !ok {
+		return true
+	}
+	for _, ns := range namespaces {
+		if !id.InNamespace(ns) {
+			return false
+		}
+	}
+	return true
+}
+
+// inScope reports whether the task or task event ev is about is in scope.
+// Node changes are in every scope.
+func (ev WatchEvent) inScope(scope []string) bool {
+	if scope == nil || ev.Kind == WatchNodes {
+		return true
+	}
+
+	var obj struct {
+		Namespace string
+		Task      *task.Task
+	}
+	err := json.Unmarshal(ev.Object, &obj)
+	if err != nil {
+		return false
+	}
+	if obj.Task != nil {
+		return inScope(scope, obj.Task.NamespaceOrDefault())
+	}
+	t := task.Task{Namespace: obj.Namespace}
+	return inScope(scope, t.NamespaceOrDefault())
+}
+
+// forbidden answers 403 if the token of r may not use every one of
+// namespaces, and reports whether it did.
+func forbidden(w http.ResponseWriter, r *http.Request, namespaces ...string) bool {
+	if mayUse(r, namespaces...) {
+		return false
+	}
+	id, _ := auth.FromContext(r.Context())
+	writeError(w, http.StatusForbidden, fmt.Sprintf("[manager][api] %s may not use namespace %s", id.Name, strings.Join(namespaces, ", ")))
+	return true
+}
+
+// hidden answers 404 for what belongs to namespaces the token of r may not
+// use, as if it did not exist, and reports whether it did.
+func hidden(w http.ResponseWriter, r *http.Request, what string, namespaces ...string) bool {
+	if mayUse(r, namespaces...) {
+		return false
+	}
+	writeError(w, http.StatusNotFound, fmt.Sprintf("[manager][api] %s not found", what))
+	return true
+}
+
+// workflowNamespaces returns the namespaces the steps of wf run their tasks in.
+func workflowNamespaces(wf *workflow.Workflow) []string {
+	var namespaces []string
+	for _, s := range wf.Steps {
+		if ns := s.Task.NamespaceOrDefault(); !slices.Contains(namespaces, ns) {
+			namespaces = append(namespaces, ns)
+		}
+	}
+	return namespaces
+}
@@ -0,0 +1,166 @@
+package manager
+
+import (
+	"container/heap"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/task"
+)
+
+type pendingItem struct {
+	id        uuid.UUID
+	priority  int
+	submitted time.Time
+	seq       uint64
+}
+
+type pendingHeap []pendingItem
+
+func (h pendingHeap) Len() int { return len(h) }
+
+func (h pendingHeap) Less(i, j int) bool {
+	if h[i].priority != h[j].priority {
+		return h[i].priority > h[j].priority
+	}
+	if !h[i].submitted.Equal(h[j].submitted) {
+		return h[i].submitted.Before(h[j].submitted)
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h pendingHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *pendingHeap) Push(x any) { *h = append(*h, x.(pendingItem)) }
+
+func (h *pendingHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
+
+// PendingQueue holds the tasks waiting to be placed on a worker, highest
+// priority first and in submission order within a priority. A task is only
+// queued once however many times it is pushed, and pushes are ignored while
+// a task taken with Next is still being placed.
+type PendingQueue struct {
+	mu     sync.Mutex
+	ready  *sync.Cond
+	items  pendingHeap
+	queued map[uuid.UUID]bool
+	seq    uint64
+	closed bool
+}
+
+func NewPendingQueue() *PendingQueue {
+	q := PendingQueue{
+		queued: make(map[uuid.UUID]bool),
+	}
+	q.ready = sync.NewCond(&q.mu)
+	return &q
+}
+
+func (q *PendingQueue) Push(t *task.Task) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.queued[t.ID] {
+		return false
+	}
+
+	q.seq++
+	heap.Push(&q.items, pendingItem{
+		id:        t.ID,
+		priority:  t.Priority(),
+		submitted: t.SubmittedAt,
+		seq:       q.seq,
+	})
+	q.queued[t.ID] = true
+	q.ready.Signal()
+	return true
+}
+
+// Next blocks until a task is queued and returns it. The task counts as
+// queued until Done is called for it. Once the queue is closed Next returns
+// false.
+func (q *PendingQueue) Next() (uuid.UUID, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for len(q.items) == 0 && !q.closed {
+		q.ready.Wait()
+	}
+
+	if q.closed {
+		return uuid.Nil, false
+	}
+
+	item := heap.Pop(&q.items).(pendingItem)
+	return item.id, true
+}
+
+// Close wakes up everything waiting in Next. Tasks still queued are left for
+// the reconciler to queue again after a restart.
+func (q *PendingQueue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.closed = true
+	q.ready.Broadcast()
+}
+
+// Reopen empties a closed queue so it can be used again, as it is by a
+// manager that becomes the leader again. The reconciler queues the pending
+// tasks anew.
+func (q *PendingQueue) Reopen() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.items = nil
+	q.queued = make(map[uuid.UUID]bool)
+	q.closed = false
+}
+
+func (q *PendingQueue) Done(id uuid.UUID) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	delete(q.queued, id)
+}
+
+func (q *PendingQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+const (
+	scheduleBackoffBase = 10 * time.Second
+	scheduleBackoffMax  = 5 * time.Minute
+)
+
+// UnschedulableError is returned when no worker can take a task right now.
+type UnschedulableError struct {
+	TaskID uuid.UUID
+	Reason string
+}
+
+func (e *UnschedulableError) Error() string {
+	return fmt.Sprintf("[manager] task %v is unschedulable: %s", e.TaskID, e.Reason)
+}
+
+// scheduleBackoff is how long to wait before trying to place a task again
+// after the given number of failed attempts, unless capacity frees up first.
+func scheduleBackoff(attempts int) time.Duration {
+	d := scheduleBackoffBase
+	for i := 1; i < attempts; i++ {
+		d *= 2
+		if d >= scheduleBackoffMax {
+			return scheduleBackoffMax
+		}
+	}
+	return d
+}
@@ -0,0 +1,167 @@
+package manager
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/task"
+)
+
+func TestPendingQueueOrder(t *testing.T) {
+	base := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+
+	type pushed struct {
+		name      string
+		class     string
+		submitted time.Time
+	}
+
+	tests := []struct {
+		name  string
+		push  []pushed
+		order []string
+	}{
+		{
+			name:  "submission order",
+			push:  []pushed{{"b", "", at(2)}, {"a", "", at(1)}, {"c", "", at(3)}},
+			order: []string{"a", "b", "c"},
+		},
+		{
+			name:  "priority first",
+			push:  []pushed{{"low", "low", at(1)}, {"normal", "", at(2)}, {"critical", "critical", at(4)}, {"high", "high", at(3)}},
+			order: []string{"critical", "high", "normal", "low"},
+		},
+		{
+			name:  "submission order within a priority",
+			push:  []pushed{{"high-late", "high", at(5)}, {"low", "low", at(0)}, {"high-early", "high", at(1)}},
+			order: []string{"high-early", "high-late", "low"},
+		},
+		{
+			name:  "push order for the same time",
+			push:  []pushed{{"first", "", at(1)}, {"second", "", at(1)}, {"third", "", at(1)}},
+			order: []string{"first", "second", "third"},
+		},
+		{
+			name:  "unknown class is normal",
+			push:  []pushed{{"low", "low", at(0)}, {"unknown", "urgent", at(2)}, {"normal", "normal", at(1)}},
+			order: []string{"normal", "unknown", "low"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := NewPendingQueue()
+			names := make(map[uuid.UUID]string)
+			for _, p := range tt.push {
+				tk := task.Task{ID: uuid.New(), PriorityClass: p.class, SubmittedAt: p.submitted}
+				names[tk.ID] = p.name
+				if !q.Push(&tk) {
+					t.Fatalf("push of %s was ignored", p.name)
+				}
+			}
+
+			if q.Len() != len(tt.order) {
+				t.Fatalf("%d queued, want %d", q.Len(), len(tt.order))
+			}
+			for _, want := range tt.order {
+				id, ok := q.Next()
+				if !ok {
+					t.Fatal("queue closed")
+				}
+				if names[id] != want {
+					t.Fatalf("next %s, want %s", names[id], want)
+				}
+			}
+		})
+	}
+}
+
+func TestPendingQueueDuplicates(t *testing.T) {
+	q := NewPendingQueue()
+	tk := task.Task{ID: uuid.New()}
+
+	if !q.Push(&tk) {
+		t.Fatal("first push was ignored")
+	}
+	if q.Push(&tk) {
+		t.Error("a queued task was queued again")
+	}
+
+	id, _ := q.Next()
+	if id != tk.ID {
+		t.Fatalf("next %v, want %v", id, tk.ID)
+	}
+	if q.Push(&tk) {
+		t.Error("a task being placed was queued again")
+	}
+
+	q.Done(tk.ID)
+	if !q.Push(&tk) {
+		t.Error("push after Done was ignored")
+	}
+	if q.Len() != 1 {
+		t.Errorf("%d queued, want 1", q.Len())
+	}
+}
+
+func TestPendingQueueClose(t *testing.T) {
+	q := NewPendingQueue()
+
+	next := make(chan bool)
+	go func() {
+		_, ok := q.Next()
+		next <- ok
+	}()
+
+	q.Close()
+	select {
+	case ok := <-next:
+		if ok {
+			t.Error("Next returned a task from an empty closed queue")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close did not wake up Next")
+	}
+
+	tk := task.Task{ID: uuid.New()}
+	q.Push(&tk)
+	if _, ok := q.Next(); ok {
+		t.Error("Next returned a task from a closed queue")
+	}
+
+	q.Reopen()
+	if q.Len() != 0 {
+		t.Errorf("%d queued after Reopen, want 0", q.Len())
+	}
+	if !q.Push(&tk) {
+		t.Fatal("push after Reopen was ignored")
+	}
+	id, ok := q.Next()
+	if !ok || id != tk.ID {
+		t.Errorf("next %v (%v), want %v", id, ok, tk.ID)
+	}
+}
+
+func TestScheduleBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{0, 10 * time.Second},
+		{1, 10 * time.Second},
+		{2, 20 * time.Second},
+		{3, 40 * time.Second},
+		{5, 160 * time.Second},
+		{6, 5 * time.Minute},
+		{100, 5 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		got := scheduleBackoff(tt.attempts)
+		if got != tt.want {
+			t.Errorf("scheduleBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
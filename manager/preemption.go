@@ -0,0 +1,140 @@
+package manager
+
+import (
+	"log"
+	"sort"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/node"
+	"github.com/surajsharma/kanastar/scheduler"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// preemptFor tries to make room for t by stopping tasks of lower priority.
+// It picks the node that needs the fewest, lowest priority victims and stops
+// them. The victims keep their capacity until their worker reports them
+// stopped, when requeuePreempted puts them back to Pending. It reports whether
+// room is being made.
+func (m *Manager) preemptFor(t *task.Task) bool {
+	var target *node.Node
+	var victims []*task.Task
+
+	m.mu.Lock()
+	for _, n := range m.WorkerNodes {
+		chosen, ok := m.preemptionVictims(t, n)
+		if !ok {
+			continue
+		}
+
+		if target == nil || len(chosen) < len(victims) {
+			target = n
+			victims = chosen
+		}
+	}
+
+	if target == nil {
+		m.mu.Unlock()
+		return false
+	}
+
+	// marked under m.mu so another scheduling worker does not pick the
+	// same victims
+	var stopping []*task.Task
+	for _, v := range victims {
+		preempted := false
+		m.modifyTask(v.ID, func(current *task.Task) bool {
+			if current.Preempted || (current.State != task.Scheduled && current.State != task.Running) {
+				return false
+			}
+			current.Preempted = true
+			preempted = true
+			return true
+		})
+		if preempted {
+			log.Printf("[manager] preempting task %v (priority %d) on %v for task %v (priority %d)\n", v.ID, v.Priority(), target.Name, t.ID, t.Priority())
+			stopping = append(stopping, v)
+		}
+	}
+	m.mu.Unlock()
+
+	for _, v := range stopping {
+		m.stopTask(target, v.ID.String())
+	}
+
+	return true
+}
+
+// requeuePreempted puts a preempted task back to Pending once its worker
+// reports it stopped, giving back its capacity. It reports whether the task
+// was a preempted one.
+func (m *Manager) requeuePreempted(id uuid.UUID) bool {
+	v, err := m.TaskDb.Get(id.String())
+	if err != nil || !v.Preempted {
+		return false
+	}
+
+	m.unassignTask(v)
+	stored, err := m.modifyTask(id, func(current *task.Task) bool {
+		if !current.Preempted {
+			return false
+		}
+		unassigned(current)
+		return true
+	})
+	if err == nil && stored.State == task.Pending {
+		log.Printf("[manager] preempted task %v stopped, queueing it again\n", id)
+		m.Pending.Push(stored)
+	}
+	return true
+}
+
+// preemptionVictims returns the lower priority tasks on n that would have to
+// stop for t to fit, lowest priority and most recently started first. The
+// caller holds m.mu.
+func (m *Manager) preemptionVictims(t *task.Task, n *node.Node) ([]*task.Task, bool) {
+	var candidates []*task.Task
+
+	memFree := n.Memory - n.MemoryAllocated
+	diskFree := n.Disk - n.DiskAllocated
+
+	for _, id := range m.WorkerTaskMap[n.Name] {
+		v, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			continue
+		}
+
+		if v.State != task.Scheduled && v.State != task.Running {
+			continue
+		}
+
+		if v.Preempted {
+			// already stopping, its room is on the way
+			memFree += v.Memory / 1000
+			diskFree += v.Disk
+			continue
+		}
+
+		if v.Priority() < t.Priority() {
+			candidates = append(candidates, v)
+		}
+	}
+
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].Priority() != candidates[j].Priority() {
+			return candidates[i].Priority() < candidates[j].Priority()
+		}
+		return candidates[i].StartTime.After(candidates[j].StartTime)
+	})
+
+	var chosen []*task.Task
+	for _, v := range candidates {
+		if scheduler.FitsIn(*t, n, memFree, diskFree) {
+			break
+		}
+		chosen = append(chosen, v)
+		memFree += v.Memory / 1000
+		diskFree += v.Disk
+	}
+
+	return chosen, scheduler.FitsIn(*t, n, memFree, diskFree)
+}
@@ -0,0 +1,93 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// TestPreemptedTaskKeepsCapacityUntilStopped checks a victim is only queued
+// again, and its room given back, once its worker reports it stopped.
+func TestPreemptedTaskKeepsCapacityUntilStopped(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	worker := newFakeWorker(t)
+	m, err := New([]string{worker}, "roundrobin", "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	n := m.WorkerNodes[0]
+	n.Memory = 20
+	n.Disk = 100
+
+	place := func(class string, memory int64) *task.Task {
+		tk := &task.Task{ID: uuid.New(), Name: class, PriorityClass: class, Memory: memory, Disk: 1,
+			State: task.Running, DesiredState: task.Running, Worker: n.Name}
+		m.TaskDb.Put(tk.ID.String(), tk)
+		m.WorkerTaskMap[n.Name] = append(m.WorkerTaskMap[n.Name], tk.ID)
+		m.TaskWorkerMap[tk.ID] = n.Name
+		n.MemoryAllocated += memory / 1000
+		n.DiskAllocated += 1
+		return tk
+	}
+	first := place("low", 8000)
+	second := place("low", 8000)
+
+	high := &task.Task{ID: uuid.New(), PriorityClass: "high", Memory: 5000, Disk: 1, State: task.Pending, DesiredState: task.Running}
+	if !m.preemptFor(high) {
+		t.Fatal("no room is being made for the high priority task")
+	}
+
+	var victim, spared *task.Task
+	for _, tk := range []*task.Task{first, second} {
+		stored, _ := m.TaskDb.Get(tk.ID.String())
+		if stored.Preempted {
+			if victim != nil {
+				t.Fatal("both tasks were preempted when one makes room")
+			}
+			victim = stored
+		} else {
+			spared = stored
+		}
+	}
+	if victim == nil {
+		t.Fatal("no task was preempted")
+	}
+	if victim.State != task.Running || m.assignedWorker(victim.ID) != n.Name || n.MemoryAllocated != 16 {
+		t.Fatalf("the victim gave up its room before it stopped: %v on %q, %d allocated", victim.State, m.assignedWorker(victim.ID), n.MemoryAllocated)
+	}
+	if m.Pending.Len() != 0 {
+		t.Fatal("the victim was queued before it stopped")
+	}
+
+	// a second attempt counts on the room already being made
+	if !m.preemptFor(high) {
+		t.Fatal("the room being made was not counted")
+	}
+	if stored, _ := m.TaskDb.Get(spared.ID.String()); stored.Preempted {
+		t.Fatal("a second victim was preempted for the same task")
+	}
+
+	done, settled := m.updateTask(n.Name, &task.Task{ID: victim.ID, State: task.Completed})
+	if !done || settled {
+		t.Fatalf("updateTask returned %v, %v for a stopped victim", done, settled)
+	}
+
+	stored, _ := m.TaskDb.Get(victim.ID.String())
+	if stored.State != task.Pending || stored.Preempted || stored.Worker != "" {
+		t.Fatalf("the stopped victim is %v on %q, preempted %v", stored.State, stored.Worker, stored.Preempted)
+	}
+	if m.assignedWorker(victim.ID) != "" || n.MemoryAllocated != 8 {
+		t.Fatalf("the stopped victim still holds room: %q, %d allocated", m.assignedWorker(victim.ID), n.MemoryAllocated)
+	}
+	if m.Pending.Len() != 1 {
+		t.Fatalf("%d tasks queued, want the victim", m.Pending.Len())
+	}
+}
@@ -0,0 +1,304 @@
+package manager
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/node"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/utils"
+	"github.com/surajsharma/kanastar/worker"
+)
+
+type capacity struct {
+	memory int64
+	disk   int64
+}
+
+// reconcile compares the desired state of every task with the state last
+// observed on the workers and issues the starts and stops needed to converge.
+// Placing Pending tasks is left to the scheduling workers; reconcile only
+// queues the ones that are due for another attempt.
+func (m *Manager) reconcile() {
+	freed := m.updateAllocations()
+
+	m.reconcileServices()
+	m.reconcileCronJobs()
+	m.reconcileWorkflows()
+
+	for _, t := range m.GetTasks() {
+		if freed && t.State == task.Pending && t.DesiredState == task.Running {
+			// capacity came back, don't wait out the backoff
+			m.Pending.Push(t)
+		}
+		m.reconcileTask(t)
+	}
+}
+
+func (m *Manager) reconcileTask(t *task.Task) {
+	switch t.DesiredState {
+	case task.Running:
+		switch t.State {
+		case task.Pending:
+			if !time.Now().UTC().Before(t.NextScheduleTime) {
+				m.Pending.Push(t)
+			}
+		case task.Scheduled, task.Running:
+			if t.Preempted {
+				// the stop may not have reached the worker
+				if w := m.getNode(m.assignedWorker(t.ID)); w != nil {
+					m.stopTask(w, t.ID.String())
+				}
+			}
+		case task.Failed:
+			// workflow steps are retried with fresh tasks by the workflow itself
+			if t.Workflow == "" && t.RestartCount < m.MaxRestarts {
+				m.restartTask(t)
+			}
+		}
+	case task.Completed:
+		switch t.State {
+		case task.Pending:
+			// never placed on a worker, nothing to stop
+			m.completeTask(t.ID, task.Pending)
+		case task.Scheduled, task.Running:
+			w := m.getNode(m.assignedWorker(t.ID))
+			if w == nil {
+				log.Printf("[manager] task %v has no worker to stop it on, marking completed\n", t.ID)
+				m.completeTask(t.ID, task.Scheduled, task.Running)
+				return
+			}
+			m.stopTask(w, t.ID.String())
+		}
+	}
+}
+
+// updateAllocations recomputes how much memory and disk is promised to the
+// tasks placed on each node, and reports whether any node has more room than
+// it had the last time round.
+func (m *Manager) updateAllocations() bool {
+	tasks := m.GetTasks()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	mem := make(map[string]int64)
+	disk := make(map[string]int64)
+
+	for _, t := range tasks {
+		if t.State != task.Scheduled && t.State != task.Running {
+			continue
+		}
+		name := m.TaskWorkerMap[t.ID]
+		mem[name] += t.Memory / 1000
+		disk[name] += t.Disk
+	}
+
+	freed := false
+	for _, n := range m.WorkerNodes {
+		n.MemoryAllocated = mem[n.Name]
+		n.DiskAllocated = disk[n.Name]
+
+		free := capacity{memory: n.Memory - n.MemoryAllocated, disk: n.Disk - n.DiskAllocated}
+		last, seen := m.lastFree[n.Name]
+		if seen && (free.memory > last.memory || free.disk > last.disk) {
+			freed = true
+		}
+		m.lastFree[n.Name] = free
+	}
+
+	return freed
+}
+
+func (m *Manager) restartTask(t *task.Task) {
+	w := m.getNode(m.assignedWorker(t.ID))
+	if w == nil {
+		log.Printf("[manager] task %v has no worker, rescheduling\n", t.ID)
+		m.unassignTask(t)
+		stored, err := m.modifyTask(t.ID, func(current *task.Task) bool {
+			if current.State != task.Failed {
+				return false
+			}
+			unassigned(current)
+			return true
+		})
+		if err == nil && stored.State == task.Pending {
+			m.Pending.Push(stored)
+		}
+		return
+	}
+
+	// marked Scheduled before it is sent, so a Running reported by the
+	// worker for the new container is not overwritten afterwards
+	restarted := false
+	stored, err := m.modifyTask(t.ID, func(current *task.Task) bool {
+		if current.State != task.Failed || current.DesiredState != task.Running {
+			return false
+		}
+		current.State = task.Scheduled
+		current.RestartCount++
+		restarted = true
+		return true
+	})
+	if err != nil || !restarted {
+		return
+	}
+
+	err = m.sendTask(w, stored)
+	if err != nil {
+		// the attempt counts, so a worker that keeps refusing the task
+		// does not get it sent again on every pass
+		log.Printf("[manager] unable to restart task %v on %v: %v\n", t.ID, w.Name, err)
+		m.modifyTask(t.ID, func(current *task.Task) bool {
+			if current.State != task.Scheduled {
+				return false
+			}
+			current.State = task.Failed
+			return true
+		})
+		return
+	}
+
+	log.Printf("[manager] restarted task %v on %v (restart %d)\n", t.ID, w.Name, stored.RestartCount)
+}
+
+// completeTask marks a task that never ran, or whose worker is gone,
+// Completed, provided it is still in one of the given states.
+func (m *Manager) completeTask(id uuid.UUID, states ...task.State) {
+	m.modifyTask(id, func(current *task.Task) bool {
+		if !slices.Contains(states, current.State) {
+			return false
+		}
+		unassigned(current)
+		current.State = task.Completed
+		current.FinishTime = time.Now().UTC()
+		return true
+	})
+}
+
+// unassignTask detaches a task from its worker and puts it back to Pending so
+// it can be placed again.
+func (m *Manager) unassignTask(t *task.Task) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.detachTask(t)
+}
+
+// detachTask is unassignTask for callers already holding m.mu. It also gives
+// back whatever the task had allocated on its worker.
+func (m *Manager) detachTask(t *task.Task) {
+	name := m.TaskWorkerMap[t.ID]
+	delete(m.TaskWorkerMap, t.ID)
+
+	ids := m.WorkerTaskMap[name]
+	for i, id := range ids {
+		if id == t.ID {
+			m.WorkerTaskMap[name] = append(ids[:i:i], ids[i+1:]...)
+			break
+		}
+	}
+
+	if n := m.getNode(name); n != nil && (t.State == task.Scheduled || t.State == task.Running) {
+		n.MemoryAllocated -= t.Memory / 1000
+		n.DiskAllocated -= t.Disk
+		if n.TaskCount > 0 {
+			n.TaskCount--
+		}
+	}
+
+	unassigned(t)
+}
+
+// unassigned clears what tied t to a worker and puts it back to Pending.
+func unassigned(t *task.Task) {
+	t.State = task.Pending
+	t.Worker = ""
+	t.ContainerID = ""
+	t.HostPorts = nil
+	t.Preempted = false
+}
+
+// assignedWorker returns the name of the worker a task is placed on, if any.
+func (m *Manager) assignedWorker(id uuid.UUID) string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.TaskWorkerMap[id]
+}
+
+func (m *Manager) workerUnreachable(name string) {
+	m.mu.Lock()
+	m.WorkerFailures[name]++
+	failures := m.WorkerFailures[name]
+	ids := append([]uuid.UUID{}, m.WorkerTaskMap[name]...)
+	m.mu.Unlock()
+
+	if failures != m.MaxWorkerFailures {
+		return
+	}
+
+	log.Printf("[manager] worker %v has been unreachable %d times, rescheduling its tasks\n", name, m.MaxWorkerFailures)
+
+	for _, id := range ids {
+		t, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			continue
+		}
+
+		if t.State != task.Scheduled && t.State != task.Running {
+			continue
+		}
+
+		m.unassignTask(t)
+		m.modifyTask(t.ID, func(current *task.Task) bool {
+			if current.State != task.Scheduled && current.State != task.Running {
+				return false
+			}
+			unassigned(current)
+			return true
+		})
+	}
+}
+
+func (m *Manager) sendTask(w *node.Node, t *task.Task) error {
+	te := task.TaskEvent{
+		ID:        uuid.New(),
+		State:     t.State,
+		Timestamp: time.Now().UTC(),
+		Task:      *t,
+	}
+
+	err := m.putEvent(&te)
+	if err != nil {
+		log.Printf("[manager] error attempting to store task event %s: %s\n", te.ID.String(), err)
+	}
+
+	data, err := json.Marshal(te)
+	if err != nil {
+		return fmt.Errorf("[manager] unable to marshal task object: %v", err)
+	}
+
+	url := fmt.Sprintf("%s/tasks", w.Api)
+	resp, err := utils.HTTP.Post(url, "application/json", bytes.NewBuffer(data))
+	if err != nil {
+		return fmt.Errorf("[manager] error connecting to %v: %v", w.Name, err)
+	}
+	defer resp.Body.Close()
+
+	d := json.NewDecoder(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		e := worker.ErrResponse{}
+		err := d.Decode(&e)
+		if err != nil {
+			return fmt.Errorf("[manager] error decoding response: %v", err)
+		}
+		return fmt.Errorf("[manager] response error (%d): %s", e.HTTPStatusCode, e.Message)
+	}
+
+	return nil
+}
@@ -0,0 +1,219 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// Conflict is a disagreement between the stored tasks and what the workers
+// reported when the manager resynced with them, and how it was resolved.
+type Conflict struct {
+	TaskID     uuid.UUID
+	Namespace  string
+	Workers    []string
+	Reason     string
+	DetectedAt time.Time
+}
+
+// workerCopy is a worker's record of a task.
+type workerCopy struct {
+	worker string
+	task   *task.Task
+}
+
+func active(t *task.Task) bool {
+	return t.State == task.Scheduled || t.State == task.Running
+}
+
+// resync rebuilds the stored tasks from the workers' own records, so a
+// manager that lost its state, or starts leading with a stale copy of it,
+// picks up the tasks the workers run instead of treating them as leftovers.
+// Tasks a worker runs are recorded as placed on it, unknown ones included.
+// Where the workers and the stored tasks disagree the workers win, and the
+// disagreement is recorded as a conflict: a task running on several workers
+// stays on one and the others' copies are stopped as leftovers, and a task
+// placed on a worker that does not know it is scheduled again. Which task is
+// placed on which worker, and what that allocates, is rebuilt from the stored
+// tasks afterwards, so it follows the tasks resync recovered or moved.
+func (m *Manager) resync() {
+	defer m.restoreAssignments()
+
+	copies := make(map[uuid.UUID][]workerCopy)
+	answered := make(map[string]bool)
+	for _, w := range m.Workers {
+		tasks, err := fetchWorkerTasks(w)
+		if err != nil {
+			log.Printf("[manager] unable to resync with worker %v: %v\n", w, err)
+			continue
+		}
+		answered[w] = true
+		for _, t := range tasks {
+			copies[t.ID] = append(copies[t.ID], workerCopy{worker: w, task: t})
+		}
+	}
+
+	if len(answered) == 0 {
+		return
+	}
+
+	conflicts, recovered := m.reconcileCopies(copies, answered)
+
+	// m.mu comes before taskMu, so the conflicts are kept once the tasks are
+	// stored and taskMu is released
+	m.mu.Lock()
+	m.conflicts = conflicts
+	m.mu.Unlock()
+
+	log.Printf("[manager] resynced with %d of %d workers: %d tasks seen, %d recovered, %d conflicts\n",
+		len(answered), len(m.Workers), len(copies), recovered, len(conflicts))
+}
+
+// reconcileCopies stores the tasks as the workers that answered report them,
+// and returns the conflicts it found and how many tasks it recovered.
+func (m *Manager) reconcileCopies(copies map[uuid.UUID][]workerCopy, answered map[string]bool) ([]Conflict, int) {
+	m.taskMu.Lock()
+	defer m.taskMu.Unlock()
+
+	var conflicts []Conflict
+	flag := func(t *task.Task, workers []string, format string, args ...interface{}) {
+		c := Conflict{TaskID: t.ID, Namespace: t.NamespaceOrDefault(), Workers: workers, Reason: fmt.Sprintf(format, args...), DetectedAt: time.Now().UTC()}
+		log.Printf("[manager] conflict on task %v: %s\n", t.ID, c.Reason)
+		conflicts = append(conflicts, c)
+	}
+
+	recovered := 0
+	for id, cs := range copies {
+		stored, err := m.TaskDb.Get(id.String())
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			log.Printf("[manager] unable to get task %v: %v\n", id, err)
+			continue
+		}
+
+		owner, running := pickOwner(stored, cs)
+		known := owner.task
+		if stored != nil {
+			known = stored
+		}
+		if len(running) > 1 {
+			flag(known, running, "running on %s, keeping it on %s", strings.Join(running, ", "), owner.worker)
+		}
+
+		switch {
+		case stored == nil && !active(owner.task):
+			// finished and forgotten, the regular updates acknowledge it
+			continue
+		case stored == nil:
+			recovered++
+		case stored.Worker == owner.worker && active(stored) == active(owner.task):
+			// in line, the regular updates take it from here
+			continue
+		case stored.Worker != owner.worker && stored.Worker != "" && active(owner.task):
+			flag(known, []string{stored.Worker, owner.worker}, "placed on %s, but %s runs it", stored.Worker, owner.worker)
+		case stored.Worker != owner.worker && !active(owner.task):
+			// only finished copies elsewhere, the stored record is newer
+			continue
+		case !active(stored) && stored.State != task.Pending:
+			flag(known, []string{owner.worker}, "recorded as %v, but %s reports it %v", stored.State, owner.worker, owner.task.State)
+		}
+
+		t := owner.task
+		if stored != nil {
+			t = stored
+			t.State = owner.task.State
+			t.ContainerID = owner.task.ContainerID
+			t.HostPorts = owner.task.HostPorts
+			t.StartTime = owner.task.StartTime
+			t.FinishTime = owner.task.FinishTime
+			t.PendingReason = ""
+		}
+		t.Worker = owner.worker
+
+		err = m.storeTask(t)
+		if err != nil {
+			log.Printf("[manager] unable to store resynced task %v: %v\n", id, err)
+		}
+	}
+
+	for _, t := range m.GetTasks() {
+		if !active(t) || !answered[t.Worker] || len(copies[t.ID]) > 0 {
+			continue
+		}
+		flag(t, []string{t.Worker}, "placed on %s, which has no record of it, scheduling it again", t.Worker)
+		t.State = task.Pending
+		t.Worker = ""
+		t.ContainerID = ""
+		t.HostPorts = nil
+		err := m.storeTask(t)
+		if err != nil {
+			log.Printf("[manager] unable to store resynced task %v: %v\n", t.ID, err)
+		}
+	}
+
+	return conflicts, recovered
+}
+
+// adoptTask records a running task the manager has no record of as placed on
+// the worker that reported it, as resync does for the workers that could not be
+// reached when the manager started. It reports whether it did.
+func (m *Manager) adoptTask(worker string, t *task.Task) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.taskMu.Lock()
+	defer m.taskMu.Unlock()
+
+	_, err := m.TaskDb.Get(t.ID.String())
+	if !errors.Is(err, store.ErrNotFound) {
+		return false
+	}
+
+	t.Worker = worker
+	err = m.storeTask(t)
+	if err != nil {
+		log.Printf("[manager] unable to store task %v reported by %v: %v\n", t.ID, worker, err)
+		return false
+	}
+
+	m.WorkerTaskMap[worker] = append(m.WorkerTaskMap[worker], t.ID)
+	m.TaskWorkerMap[t.ID] = worker
+	if n := m.getNode(worker); n != nil && active(t) {
+		n.MemoryAllocated += t.Memory / 1000
+		n.DiskAllocated += t.Disk
+		n.TaskCount++
+	}
+
+	log.Printf("[manager] recovered task %v from worker %v\n", t.ID, worker)
+	return true
+}
+
+// pickOwner returns the copy of a task that wins, and the workers that run
+// it. A running copy wins over a finished one, and the worker the task is
+// stored as placed on over the others.
+func pickOwner(stored *task.Task, cs []workerCopy) (workerCopy, []string) {
+	var running []string
+	owner := cs[0]
+	for _, c := range cs {
+		if !active(c.task) {
+			continue
+		}
+		running = append(running, c.worker)
+		if !active(owner.task) || (stored != nil && c.worker == stored.Worker) {
+			owner = c
+		}
+	}
+	return owner, running
+}
+
+// Conflicts returns the conflicts found the last time the manager resynced
+// with the workers.
+func (m *Manager) Conflicts() []Conflict {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Conflict{}, m.conflicts...)
+}
@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/task"
+)
+
+func TestPickOwner(t *testing.T) {
+	running := func(w string) workerCopy { return workerCopy{worker: w, task: &task.Task{State: task.Running}} }
+	done := func(w string) workerCopy { return workerCopy{worker: w, task: &task.Task{State: task.Completed}} }
+	on := func(w string) *task.Task { return &task.Task{State: task.Running, Worker: w} }
+
+	tests := []struct {
+		name    string
+		stored  *task.Task
+		copies  []workerCopy
+		owner   string
+		running []string
+	}{
+		{"one running copy", nil, []workerCopy{running("w1")}, "w1", []string{"w1"}},
+		{"running wins over finished", nil, []workerCopy{done("w1"), running("w2")}, "w2", []string{"w2"}},
+		{"only finished copies", on("w2"), []workerCopy{done("w1"), done("w2")}, "w1", nil},
+		{"first running copy of an unknown task", nil, []workerCopy{running("w1"), running("w2")}, "w1", []string{"w1", "w2"}},
+		{"stored worker wins", on("w2"), []workerCopy{running("w1"), running("w2"), running("w3")}, "w2", []string{"w1", "w2", "w3"}},
+		{"stored worker only has a finished copy", on("w2"), []workerCopy{done("w2"), running("w3")}, "w3", []string{"w3"}},
+		{"stored worker did not report", on("w9"), []workerCopy{running("w1"), running("w2")}, "w1", []string{"w1", "w2"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			owner, running := pickOwner(tt.stored, tt.copies)
+			if owner.worker != tt.owner {
+				t.Fatalf("owner %s, want %s", owner.worker, tt.owner)
+			}
+			if fmt.Sprint(running) != fmt.Sprint(tt.running) {
+				t.Fatalf("running on %v, want %v", running, tt.running)
+			}
+		})
+	}
+}
+
+// TestResync runs resync against workers reporting each kind of conflict and
+// checks the stored task, its placement and the conflict recorded.
+func TestResync(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	const (
+		w1 = iota
+		w2
+		none = -1
+	)
+
+	tests := []struct {
+		name string
+		// the stored task, if any, and the worker it is placed on
+		stored     *task.State
+		storedOn   int
+		reported   [2]*task.State
+		wantState  task.State
+		wantWorker int
+		wantStored bool
+		wantReason string
+	}{
+		{name: "in line", stored: state(task.Running), storedOn: w1,
+			reported:  [2]*task.State{state(task.Running), nil},
+			wantState: task.Running, wantWorker: w1, wantStored: true},
+		{name: "recovered from a worker", storedOn: none,
+			reported:  [2]*task.State{nil, state(task.Running)},
+			wantState: task.Running, wantWorker: w2, wantStored: true},
+		{name: "finished and forgotten", storedOn: none,
+			reported:   [2]*task.State{state(task.Completed), nil},
+			wantWorker: none},
+		{name: "running on both workers", stored: state(task.Running), storedOn: w2,
+			reported:  [2]*task.State{state(task.Running), state(task.Running)},
+			wantState: task.Running, wantWorker: w2, wantStored: true, wantReason: "running on"},
+		{name: "moved to another worker", stored: state(task.Running), storedOn: w1,
+			reported:  [2]*task.State{nil, state(task.Running)},
+			wantState: task.Running, wantWorker: w2, wantStored: true, wantReason: "but"},
+		{name: "finished copy elsewhere", stored: state(task.Running), storedOn: w1,
+			reported:  [2]*task.State{state(task.Running), state(task.Completed)},
+			wantState: task.Running, wantWorker: w1, wantStored: true},
+		{name: "recorded as finished but running", stored: state(task.Completed), storedOn: w1,
+			reported:  [2]*task.State{state(task.Running), nil},
+			wantState: task.Running, wantWorker: w1, wantStored: true, wantReason: "recorded as"},
+		{name: "lost by its worker", stored: state(task.Running), storedOn: w1,
+			reported:  [2]*task.State{nil, nil},
+			wantState: task.Pending, wantWorker: none, wantStored: true, wantReason: "no record"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id := uuid.New()
+			var workers []string
+			for _, s := range tt.reported {
+				if s == nil {
+					workers = append(workers, newFakeWorker(t))
+					continue
+				}
+				workers = append(workers, newFakeWorker(t, task.Task{ID: id, Memory: 2000, Disk: 3, State: *s}))
+			}
+			name := func(i int) string {
+				if i == none {
+					return ""
+				}
+				return workers[i]
+			}
+
+			m, err := New(workers, "roundrobin", "memory", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			if tt.stored != nil {
+				m.TaskDb.Put(id.String(), &task.Task{ID: id, Memory: 2000, Disk: 3, State: *tt.stored, DesiredState: task.Running, Worker: name(tt.storedOn)})
+			}
+			m.restoreAssignments()
+
+			m.resync()
+
+			stored, err := m.TaskDb.Get(id.String())
+			if !tt.wantStored {
+				if err == nil {
+					t.Fatalf("task stored as %v", stored.State)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if stored.State != tt.wantState || stored.Worker != name(tt.wantWorker) {
+					t.Fatalf("task stored as %v on %q, want %v on %q", stored.State, stored.Worker, tt.wantState, name(tt.wantWorker))
+				}
+			}
+
+			// the placement follows the stored task
+			if got := m.assignedWorker(id); got != name(tt.wantWorker) {
+				t.Fatalf("task assigned to %q, want %q", got, name(tt.wantWorker))
+			}
+			for i, n := range m.WorkerNodes {
+				placed := slices.Contains(m.WorkerTaskMap[n.Name], id)
+				want := i == tt.wantWorker
+				if placed != want {
+					t.Fatalf("task placed on %s: %v, want %v", n.Name, placed, want)
+				}
+				var mem int64
+				if want && active(stored) {
+					mem = 2
+				}
+				if n.MemoryAllocated != mem {
+					t.Fatalf("%s has %d allocated, want %d", n.Name, n.MemoryAllocated, mem)
+				}
+			}
+
+			conflicts := m.Conflicts()
+			if tt.wantReason == "" {
+				if len(conflicts) != 0 {
+					t.Fatalf("unexpected conflicts %+v", conflicts)
+				}
+				return
+			}
+			if len(conflicts) != 1 || conflicts[0].TaskID != id || !strings.Contains(conflicts[0].Reason, tt.wantReason) {
+				t.Fatalf("conflicts %+v, want one on %v about %q", conflicts, id, tt.wantReason)
+			}
+		})
+	}
+}
+
+func state(s task.State) *task.State {
+	return &s
+}
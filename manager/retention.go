@@ -0,0 +1,144 @@
+package manager
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/surajsharma/kanastar/node"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/utils"
+	"github.com/surajsharma/kanastar/workflow"
+)
+
+// CompactStores deletes finished tasks and old events that fell out of the
+// manager's retention policies, every CompactInterval until ctx is cancelled.
+func (m *Manager) CompactStores(ctx context.Context) {
+	tasks := store.Compactor[task.Task]{
+		Name:      "tasks",
+		Store:     m.TaskDb,
+		Retention: m.TaskRetention,
+		Key:       func(t *task.Task) string { return t.ID.String() },
+		Finished:  m.taskFinished,
+		Lock:      &m.taskMu,
+		Removed:   m.forgetTasks,
+	}
+
+	events := store.Compactor[task.TaskEvent]{
+		Name:      "events",
+		Store:     m.EventDb,
+		Retention: m.EventRetention,
+		Key:       func(te *task.TaskEvent) string { return te.ID.String() },
+		Finished:  func(te *task.TaskEvent) (time.Time, bool) { return te.Timestamp, true },
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		tasks.Run(ctx, m.CompactInterval)
+	}()
+	go func() {
+		defer wg.Done()
+		events.Run(ctx, m.CompactInterval)
+	}()
+	wg.Wait()
+}
+
+// settled reports whether the manager is done with t: it reached a terminal
+// state and nothing will restart it.
+func (m *Manager) settled(t *task.Task) bool {
+	switch t.State {
+	case task.Completed:
+		return true
+	case task.Failed:
+		return t.DesiredState != task.Running || t.Workflow != "" || t.RestartCount >= m.MaxRestarts
+	}
+	return false
+}
+
+func (m *Manager) taskFinished(t *task.Task) (time.Time, bool) {
+	if !m.settled(t) || m.taskInUse(t) {
+		return time.Time{}, false
+	}
+
+	switch {
+	case !t.FinishTime.IsZero():
+		return t.FinishTime, true
+	case !t.StartTime.IsZero():
+		return t.StartTime, true
+	}
+	return t.SubmittedAt, true
+}
+
+// taskInUse reports whether a cron job or workflow run still has to look at
+// t to notice that it finished.
+func (m *Manager) taskInUse(t *task.Task) bool {
+	if t.CronJob != "" {
+		c, err := m.CronJobDb.Get(t.CronJob)
+		if err == nil {
+			for _, run := range c.Active {
+				if run.TaskID == t.ID {
+					return true
+				}
+			}
+		}
+	}
+
+	if t.Workflow != "" {
+		wf, err := m.WorkflowDb.Get(t.Workflow)
+		if err == nil {
+			for _, r := range wf.Runs {
+				if r.State != workflow.RunRunning {
+					continue
+				}
+				for _, sr := range r.Steps {
+					if sr.TaskID == t.ID && sr.State == workflow.StepRunning {
+						return true
+					}
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+// forgetTasks drops compacted tasks from the worker maps.
+func (m *Manager) forgetTasks(tasks []*task.Task) {
+	for _, t := range tasks {
+		m.Watcher.Publish(WatchTasks, "delete", t)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, t := range tasks {
+		m.detachTask(t)
+	}
+}
+
+// acknowledgeTask tells the worker that the manager recorded the terminal
+// state of a task, so the worker can drop its own record of it.
+func (m *Manager) acknowledgeTask(w *node.Node, taskID string) {
+	url := fmt.Sprintf("%s/tasks/%s/record", w.Api, taskID)
+	req, err := http.NewRequest(http.MethodDelete, url, nil)
+	if err != nil {
+		log.Printf("[manager] error creating request to acknowledge task %v: %v\n", taskID, err)
+		return
+	}
+
+	resp, err := utils.HTTP.Do(req)
+	if err != nil {
+		log.Printf("[manager] error connecting to %v: %v\n", w.Name, err)
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
+		log.Printf("[manager] worker %v did not drop record of task %v (%d)\n", w.Name, taskID, resp.StatusCode)
+	}
+}
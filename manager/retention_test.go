@@ -0,0 +1,171 @@
+package manager
+
+import (
+	"context"
+	"io"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/cronjob"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/workflow"
+)
+
+func TestTaskFinished(t *testing.T) {
+	finish := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	cron := func(active bool) func(m *Manager, t *task.Task) {
+		return func(m *Manager, t *task.Task) {
+			t.CronJob = "nightly"
+			c := cronjob.CronJob{Name: "nightly"}
+			run := cronjob.Run{TaskID: t.ID}
+			if active {
+				c.Active = append(c.Active, run)
+			} else {
+				c.History = append(c.History, run)
+			}
+			m.CronJobDb.Put(c.Name, &c)
+		}
+	}
+	flow := func(runState, stepState string) func(m *Manager, t *task.Task) {
+		return func(m *Manager, t *task.Task) {
+			t.Workflow = "build"
+			wf := workflow.Workflow{Name: "build", Runs: []*workflow.Run{{
+				State: runState,
+				Steps: []workflow.StepRun{{Name: "compile", State: stepState, TaskID: t.ID}},
+			}}}
+			m.WorkflowDb.Put(wf.Name, &wf)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		task     task.Task
+		setup    func(m *Manager, t *task.Task)
+		finished bool
+	}{
+		{"completed", task.Task{State: task.Completed, DesiredState: task.Completed}, nil, true},
+		{"running", task.Task{State: task.Running, DesiredState: task.Running}, nil, false},
+		{"pending", task.Task{State: task.Pending, DesiredState: task.Running}, nil, false},
+		{"failed with restarts left", task.Task{State: task.Failed, DesiredState: task.Running, RestartCount: 1}, nil, false},
+		{"failed out of restarts", task.Task{State: task.Failed, DesiredState: task.Running, RestartCount: 3}, nil, true},
+		{"failed after being stopped", task.Task{State: task.Failed, DesiredState: task.Completed}, nil, true},
+		{"failed workflow step", task.Task{State: task.Failed, DesiredState: task.Running}, flow(workflow.RunFailed, workflow.StepFailed), true},
+		{"active cron job run", task.Task{State: task.Completed, DesiredState: task.Completed}, cron(true), false},
+		{"recorded cron job run", task.Task{State: task.Completed, DesiredState: task.Completed}, cron(false), true},
+		{"running workflow step", task.Task{State: task.Completed, DesiredState: task.Completed}, flow(workflow.RunRunning, workflow.StepRunning), false},
+		{"settled workflow step", task.Task{State: task.Completed, DesiredState: task.Completed}, flow(workflow.RunRunning, workflow.StepSucceeded), true},
+		{"finished workflow run", task.Task{State: task.Completed, DesiredState: task.Completed}, flow(workflow.RunSucceeded, workflow.StepRunning), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := New([]string{"localhost:1"}, "roundrobin", "memory", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tk := tt.task
+			tk.ID = uuid.New()
+			tk.FinishTime = finish
+			if tt.setup != nil {
+				tt.setup(m, &tk)
+			}
+
+			at, finished := m.taskFinished(&tk)
+			if finished != tt.finished {
+				t.Fatalf("finished %v, want %v", finished, tt.finished)
+			}
+			if finished && !at.Equal(finish) {
+				t.Errorf("finished at %v, want %v", at, finish)
+			}
+		})
+	}
+}
+
+func TestTaskFinishedTime(t *testing.T) {
+	submitted := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+	started := submitted.Add(time.Minute)
+	finished := started.Add(time.Minute)
+
+	tests := []struct {
+		name  string
+		start time.Time
+		end   time.Time
+		at    time.Time
+	}{
+		{"finish time", started, finished, finished},
+		{"only started", started, time.Time{}, started},
+		{"never started", time.Time{}, time.Time{}, submitted},
+	}
+
+	m, err := New([]string{"localhost:1"}, "roundrobin", "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tk := task.Task{ID: uuid.New(), State: task.Completed, SubmittedAt: submitted, StartTime: tt.start, FinishTime: tt.end}
+			at, ok := m.taskFinished(&tk)
+			if !ok || !at.Equal(tt.at) {
+				t.Errorf("finished at %v (%v), want %v", at, ok, tt.at)
+			}
+		})
+	}
+}
+
+// TestCompactStores runs one round of compaction and checks that only the
+// tasks the manager is done with are deleted and forgotten.
+func TestCompactStores(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	m, err := New([]string{"localhost:1"}, "roundrobin", "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.TaskRetention = store.Retention{TTL: time.Hour}
+	m.EventRetention = store.Retention{}
+
+	old := time.Now().UTC().Add(-2 * time.Hour)
+	tasks := map[string]*task.Task{
+		"old completed":  {State: task.Completed, DesiredState: task.Completed, FinishTime: old},
+		"new completed":  {State: task.Completed, DesiredState: task.Completed, FinishTime: time.Now().UTC()},
+		"old restarting": {State: task.Failed, DesiredState: task.Running, FinishTime: old},
+		"old cron run":   {State: task.Completed, DesiredState: task.Completed, FinishTime: old, CronJob: "nightly"},
+	}
+	for name, tk := range tasks {
+		tk.ID = uuid.New()
+		tk.Name = name
+		tk.Worker = "localhost:1"
+		m.TaskDb.Put(tk.ID.String(), tk)
+		m.WorkerTaskMap[tk.Worker] = append(m.WorkerTaskMap[tk.Worker], tk.ID)
+		m.TaskWorkerMap[tk.ID] = tk.Worker
+	}
+	m.CronJobDb.Put("nightly", &cronjob.CronJob{
+		Name:   "nightly",
+		Active: []cronjob.Run{{TaskID: tasks["old cron run"].ID}},
+	})
+
+	// a cancelled context makes each compactor stop after its first round
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m.CompactStores(ctx)
+
+	for name, tk := range tasks {
+		_, err := m.TaskDb.Get(tk.ID.String())
+		_, placed := m.TaskWorkerMap[tk.ID]
+		kept := name != "old completed"
+		if (err == nil) != kept || placed != kept {
+			t.Errorf("%s: stored %v, placed %v, want %v", name, err == nil, placed, kept)
+		}
+	}
+	if n := len(m.WorkerTaskMap["localhost:1"]); n != len(tasks)-1 {
+		t.Errorf("%d tasks left on the worker, want %d", n, len(tasks)-1)
+	}
+}
@@ -0,0 +1,468 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/service"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+)
+
+func (m *Manager) AddService(s service.Service) (*service.Service, error) {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	s.SetDefaults()
+
+	err := s.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.ServiceDb.Get(s.Name)
+	if err == nil {
+		return nil, fmt.Errorf("[manager] service %s already exists", s.Name)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("[manager] error looking up service %s: %v", s.Name, err)
+	}
+
+	s.ID = uuid.New()
+	s.CreatedAt = time.Now().UTC()
+	s.UpdatedAt = s.CreatedAt
+	s.History = nil
+	s.AddRevision()
+	s.SetRollout(service.RolloutComplete, "service created")
+
+	err = m.ServiceDb.Put(s.Name, &s)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] error storing service %s: %v", s.Name, err)
+	}
+
+	log.Printf("[manager] added service %s with %d replicas\n", s.Name, s.Replicas)
+	return &s, nil
+}
+
+// UpdateService applies a new specification to an existing service. A changed
+// template becomes a new revision and starts a rolling update.
+func (m *Manager) UpdateService(spec service.Service) (*service.Service, error) {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	spec.SetDefaults()
+
+	err := spec.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	s, err := m.GetService(spec.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	s.Replicas = spec.Replicas
+	s.UpdateConfig = spec.UpdateConfig
+	s.UpdatedAt = time.Now().UTC()
+
+	if !reflect.DeepEqual(s.Template, spec.Template) {
+		s.Template = spec.Template
+		s.AddRevision()
+		m.startRollout(s, fmt.Sprintf("rolling out revision %d", s.Revision))
+		log.Printf("[manager] service %s updated to revision %d\n", s.Name, s.Revision)
+	}
+
+	err = m.ServiceDb.Put(s.Name, s)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] error storing service %s: %v", s.Name, err)
+	}
+
+	return s, nil
+}
+
+// RollbackService rolls a service back to an earlier revision, or to the one
+// before the current revision when revision is zero.
+func (m *Manager) RollbackService(name string, revision int) (*service.Service, error) {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	s, err := m.GetService(name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.rollback(s, revision, "rollback requested")
+	if err != nil {
+		return nil, err
+	}
+
+	err = m.ServiceDb.Put(s.Name, s)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] error storing service %s: %v", s.Name, err)
+	}
+
+	return s, nil
+}
+
+func (m *Manager) rollback(s *service.Service, revision int, reason string) error {
+	var rev *service.Revision
+	var err error
+
+	if revision == 0 {
+		rev, err = s.PreviousRevision()
+	} else {
+		rev, err = s.GetRevision(revision)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[manager] rolling back service %s from revision %d to %d: %s\n", s.Name, s.Revision, rev.Number, reason)
+
+	from := s.Revision
+	s.Template = rev.Template
+	s.Revision = rev.Number
+	s.UpdatedAt = time.Now().UTC()
+	m.startRollout(s, fmt.Sprintf("rolling back from revision %d to %d: %s", from, rev.Number, reason))
+
+	return nil
+}
+
+// startRollout starts rolling s out to its current revision. The restarts
+// its replicas of that revision already have are recorded, so that only the
+// ones that follow count as the rollout failing.
+func (m *Manager) startRollout(s *service.Service, msg string) {
+	s.SetRollout(service.RolloutProgressing, msg)
+
+	for _, t := range m.ServiceTasks(s.Name) {
+		if t.Revision != s.Revision || t.RestartCount == 0 {
+			continue
+		}
+		if s.Rollout.Restarts == nil {
+			s.Rollout.Restarts = make(map[string]int)
+		}
+		s.Rollout.Restarts[t.ID.String()] = t.RestartCount
+	}
+}
+
+func (m *Manager) GetServices() []*service.Service {
+	services, err := store.All(m.ServiceDb)
+	if err != nil {
+		log.Printf("[manager] error getting list of services: %v\n", err)
+		return nil
+	}
+
+	return services
+}
+
+func (m *Manager) GetService(name string) (*service.Service, error) {
+	result, err := m.ServiceDb.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (m *Manager) ScaleService(name string, replicas int) (*service.Service, error) {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	s, err := m.GetService(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if replicas < 0 {
+		return nil, fmt.Errorf("[manager] replicas must not be negative, got %d", replicas)
+	}
+
+	log.Printf("[manager] scaling service %s from %d to %d replicas\n", name, s.Replicas, replicas)
+
+	s.Replicas = replicas
+	s.UpdatedAt = time.Now().UTC()
+
+	err = m.ServiceDb.Put(s.Name, s)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] error storing service %s: %v", s.Name, err)
+	}
+
+	return s, nil
+}
+
+func (m *Manager) GetRolloutStatus(name string) (*service.RolloutStatus, error) {
+	s, err := m.GetService(name)
+	if err != nil {
+		return nil, err
+	}
+
+	status := service.RolloutStatus{
+		Service:     s.Name,
+		Revision:    s.Revision,
+		State:       s.Rollout.State,
+		Message:     s.Rollout.Message,
+		Replicas:    s.Replicas,
+		History:     s.History,
+		LastUpdated: s.Rollout.UpdatedAt,
+	}
+
+	for _, t := range m.ServiceTasks(s.Name) {
+		if t.Revision != s.Revision {
+			status.Outdated++
+			continue
+		}
+		status.Updated++
+		if replicaHealthy(s, t) {
+			status.Available++
+		}
+	}
+
+	return &status, nil
+}
+
+// ServiceTasks returns the tasks that belong to a service and are still
+// meant to be running.
+func (m *Manager) ServiceTasks(name string) []*task.Task {
+	var tasks []*task.Task
+	for _, t := range m.GetTasks() {
+		if t.Service == name && t.DesiredState == task.Running {
+			tasks = append(tasks, t)
+		}
+	}
+	return tasks
+}
+
+// reconcileServices makes sure every service has the requested number of live
+// replicas of its current revision. Replicas that exhausted their restarts or
+// exited are retired and replaced; tasks on lost workers are rescheduled by
+// the task reconciler and still count. A paused rollout keeps its replicas
+// at the revisions they run.
+func (m *Manager) reconcileServices() {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	for _, s := range m.GetServices() {
+		before := s.Rollout
+
+		switch s.Rollout.State {
+		case service.RolloutProgressing:
+			m.progressRollout(s)
+		default:
+			m.maintainReplicas(s)
+		}
+
+		if !reflect.DeepEqual(s.Rollout, before) {
+			err := m.ServiceDb.Put(s.Name, s)
+			if err != nil {
+				log.Printf("[manager] error storing service %s: %v\n", s.Name, err)
+			}
+		}
+	}
+}
+
+func (m *Manager) maintainReplicas(s *service.Service) {
+	var active []*task.Task
+	var replace []int
+
+	for _, t := range m.ServiceTasks(s.Name) {
+		if m.replicaDead(t) {
+			log.Printf("[manager] replacing failed replica %v of service %s\n", t.ID, s.Name)
+			m.retireTask(t)
+			if s.Rollout.State == service.RolloutPaused {
+				replace = append(replace, t.Revision)
+			}
+			continue
+		}
+		active = append(active, t)
+	}
+
+	switch {
+	case len(active) < s.Replicas:
+		missing := s.Replicas - len(active)
+		// while paused, a replica is replaced by one of its own revision
+		for _, rev := range replace {
+			if missing == 0 {
+				break
+			}
+			t, err := s.RevisionTask(rev)
+			if err != nil {
+				t = s.NewTask()
+			}
+			m.addReplica(s, t)
+			missing--
+		}
+		m.addReplicas(s, missing)
+	case len(active) > s.Replicas:
+		// remove outdated replicas, unless the rollout is paused, and those
+		// furthest from running first
+		sort.SliceStable(active, func(i, j int) bool {
+			return removalRank(s, active[i]) < removalRank(s, active[j])
+		})
+
+		for _, t := range active[:len(active)-s.Replicas] {
+			log.Printf("[manager] removing replica %v from service %s\n", t.ID, s.Name)
+			m.retireTask(t)
+		}
+	}
+}
+
+// progressRollout moves a service one step closer to running only replicas
+// of its current revision. New replicas are added up to Replicas+MaxSurge and
+// old ones removed while at least Replicas-MaxUnavailable stay available, so
+// each batch waits for the previous one to become healthy.
+func (m *Manager) progressRollout(s *service.Service) {
+	var current, old []*task.Task
+	healthy, oldRunning := 0, 0
+
+	for _, t := range m.ServiceTasks(s.Name) {
+		if t.Revision != s.Revision {
+			if m.replicaDead(t) {
+				m.retireTask(t)
+				continue
+			}
+			old = append(old, t)
+			if t.State == task.Running {
+				oldRunning++
+			}
+			continue
+		}
+
+		if t.State == task.Failed || t.State == task.Completed || t.RestartCount > s.Rollout.Restarts[t.ID.String()] {
+			m.rolloutFailed(s, t)
+			return
+		}
+
+		current = append(current, t)
+		if replicaHealthy(s, t) {
+			healthy++
+		}
+	}
+
+	if len(old) == 0 && len(current) >= s.Replicas && healthy >= s.Replicas {
+		log.Printf("[manager] rollout of service %s to revision %d complete\n", s.Name, s.Revision)
+		s.SetRollout(service.RolloutComplete, fmt.Sprintf("revision %d rolled out", s.Revision))
+		m.maintainReplicas(s)
+		return
+	}
+
+	maxTotal := s.Replicas + s.UpdateConfig.MaxSurge
+	minAvailable := s.Replicas - s.UpdateConfig.MaxUnavailable
+
+	create := s.Replicas - len(current)
+	if room := maxTotal - len(current) - len(old); create > room {
+		create = room
+	}
+	if create > 0 {
+		m.addReplicas(s, create)
+	}
+
+	// old replicas that are not running cost no availability
+	sort.SliceStable(old, func(i, j int) bool {
+		return removalRank(s, old[i]) < removalRank(s, old[j])
+	})
+
+	available := healthy + oldRunning
+	for _, t := range old {
+		if t.State == task.Running {
+			if available-1 < minAvailable {
+				break
+			}
+			available--
+		}
+		log.Printf("[manager] removing replica %v of revision %d from service %s\n", t.ID, t.Revision, s.Name)
+		m.retireTask(t)
+	}
+}
+
+func (m *Manager) rolloutFailed(s *service.Service, t *task.Task) {
+	reason := fmt.Sprintf("replica %v of revision %d failed", t.ID, s.Revision)
+
+	if s.UpdateConfig.FailureAction == service.FailureActionRollback {
+		err := m.rollback(s, 0, reason)
+		if err == nil {
+			return
+		}
+		log.Printf("[manager] unable to roll back service %s: %v\n", s.Name, err)
+	}
+
+	log.Printf("[manager] pausing rollout of service %s: %s\n", s.Name, reason)
+	s.SetRollout(service.RolloutPaused, reason)
+}
+
+func (m *Manager) addReplicas(s *service.Service, count int) {
+	for i := 0; i < count; i++ {
+		m.addReplica(s, s.NewTask())
+	}
+}
+
+func (m *Manager) addReplica(s *service.Service, t task.Task) {
+	err := m.AddTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now().UTC(),
+		Task:      t,
+	})
+	if err != nil {
+		log.Printf("[manager] unable to add replica for service %s: %v\n", s.Name, err)
+		return
+	}
+	log.Printf("[manager] added replica %v (revision %d) to service %s\n", t.ID, t.Revision, s.Name)
+}
+
+func (m *Manager) replicaDead(t *task.Task) bool {
+	switch t.State {
+	case task.Completed:
+		return true
+	case task.Failed:
+		return t.RestartCount >= m.MaxRestarts
+	}
+	return false
+}
+
+// replicaHealthy reports whether a replica has been running, and so passing
+// health checks, for at least the service's monitor period.
+func replicaHealthy(s *service.Service, t *task.Task) bool {
+	if t.State != task.Running || t.StartTime.IsZero() {
+		return false
+	}
+
+	monitor := time.Duration(s.UpdateConfig.Monitor) * time.Second
+	return time.Since(t.StartTime) >= monitor
+}
+
+func removalRank(s *service.Service, t *task.Task) int {
+	rank := 0
+	// a paused rollout favours neither revision
+	if t.Revision == s.Revision && s.Rollout.State != service.RolloutPaused {
+		rank = 4
+	}
+
+	switch t.State {
+	case task.Failed:
+		return rank
+	case task.Pending:
+		return rank + 1
+	case task.Scheduled:
+		return rank + 2
+	}
+	return rank + 3
+}
+
+func (m *Manager) retireTask(t *task.Task) {
+	err := m.AddTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Completed,
+		Timestamp: time.Now().UTC(),
+		Task:      *t,
+	})
+	if err != nil {
+		log.Printf("[manager] unable to stop task %v: %v\n", t.ID, err)
+	}
+}
@@ -0,0 +1,80 @@
+package manager
+
+import (
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// SQLiteFile is the database the manager keeps its stores in with
+// --dbType sqlite.
+const SQLiteFile = "kanastar.sqlite"
+
+// sqliteMigrations is the manager's schema. Only ever append to it; a
+// migration that shipped must not change.
+var sqliteMigrations = []store.Migration{
+	{
+		Version:     1,
+		Description: "create tasks, events, services, cron jobs and workflows",
+		SQL: `
+CREATE TABLE tasks (
+	key TEXT PRIMARY KEY,
+	data TEXT NOT NULL,
+	state INTEGER NOT NULL,
+	desired_state INTEGER NOT NULL,
+	worker TEXT,
+	submitted_at INTEGER,
+	start_time INTEGER,
+	finish_time INTEGER
+);
+CREATE INDEX tasks_state ON tasks (state);
+CREATE INDEX tasks_worker ON tasks (worker);
+CREATE INDEX tasks_submitted_at ON tasks (submitted_at);
+CREATE INDEX tasks_finish_time ON tasks (finish_time);
+
+CREATE TABLE events (
+	key TEXT PRIMARY KEY,
+	data TEXT NOT NULL,
+	task_id TEXT NOT NULL,
+	state INTEGER NOT NULL,
+	timestamp INTEGER
+);
+CREATE INDEX events_task_id ON events (task_id);
+CREATE INDEX events_timestamp ON events (timestamp);
+
+CREATE TABLE services (key TEXT PRIMARY KEY, data TEXT NOT NULL);
+CREATE TABLE cronjobs (key TEXT PRIMARY KEY, data TEXT NOT NULL);
+CREATE TABLE workflows (key TEXT PRIMARY KEY, data TEXT NOT NULL);
+`,
+	},
+	{
+		Version:     2,
+		Description: "add the namespace of tasks",
+		SQL: `
+ALTER TABLE tasks ADD COLUMN namespace TEXT NOT NULL DEFAULT 'default';
+CREATE INDEX tasks_namespace ON tasks (namespace);
+`,
+	},
+}
+
+var taskColumns = []store.Column[task.Task]{
+	{Name: "state", Value: func(t *task.Task) interface{} { return int(t.State) }},
+	{Name: "desired_state", Value: func(t *task.Task) interface{} { return int(t.DesiredState) }},
+	{Name: "worker", Value: func(t *task.Task) interface{} { return nullString(t.Worker) }},
+	{Name: "submitted_at", Value: func(t *task.Task) interface{} { return store.UnixMilli(t.SubmittedAt) }},
+	{Name: "start_time", Value: func(t *task.Task) interface{} { return store.UnixMilli(t.StartTime) }},
+	{Name: "finish_time", Value: func(t *task.Task) interface{} { return store.UnixMilli(t.FinishTime) }},
+	{Name: "namespace", Value: func(t *task.Task) interface{} { return t.NamespaceOrDefault() }},
+}
+
+var eventColumns = []store.Column[task.TaskEvent]{
+	{Name: "task_id", Value: func(te *task.TaskEvent) interface{} { return te.Task.ID.String() }},
+	{Name: "state", Value: func(te *task.TaskEvent) interface{} { return int(te.State) }},
+	{Name: "timestamp", Value: func(te *task.TaskEvent) interface{} { return store.UnixMilli(te.Timestamp) }},
+}
+
+func nullString(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
@@ -0,0 +1,67 @@
+package manager
+
+import (
+	"database/sql"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// TestSQLiteUpgradeFromVersion1 opens a database written before tasks had a
+// namespace and checks its tasks land in the default one.
+func TestSQLiteUpgradeFromVersion1(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	file := filepath.Join(t.TempDir(), SQLiteFile)
+
+	old, err := sql.Open("sqlite3", "file:"+file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = store.Migrate(old, sqliteMigrations[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	_, err = old.Exec(`INSERT INTO tasks (key, data, state, desired_state) VALUES (?, ?, ?, ?)`,
+		id.String(), `{"ID":"`+id.String()+`","Name":"old"}`, int(task.Running), int(task.Running))
+	if err != nil {
+		t.Fatal(err)
+	}
+	old.Close()
+
+	db, err := store.OpenSQLite(file, sqliteMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tasks := store.NewSQLiteStore(db, "tasks", taskColumns...)
+	defer tasks.Close()
+
+	page, err := tasks.List(store.Query[task.Task]{Where: map[string]interface{}{"namespace": task.DefaultNamespace}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 1 || page.Items[0].ID != id {
+		t.Fatalf("the upgraded task is not in the default namespace: %+v", page)
+	}
+
+	// new tasks fill the added column
+	err = tasks.Put(uuid.New().String(), &task.Task{Name: "new", Namespace: "team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n, err := tasks.List(store.Query[task.Task]{Where: map[string]interface{}{"namespace": "team-a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n.Total != 1 {
+		t.Fatalf("%d tasks in team-a, want 1", n.Total)
+	}
+}
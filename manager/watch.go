@@ -0,0 +1,158 @@
+package manager
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	WatchTasks  = "tasks"
+	WatchNodes  = "nodes"
+	WatchEvents = "events"
+)
+
+var ErrCursorExpired = errors.New("[manager] watch cursor is older than the retained history")
+
+type WatchEvent struct {
+	Cursor    uint64
+	Kind      string
+	Type      string
+	Timestamp time.Time
+	Object    json.RawMessage
+}
+
+type subscriber struct {
+	kind string
+	ch   chan WatchEvent
+}
+
+// Broadcaster fans out task, node and event changes to watchers and keeps a
+// bounded history so a client can resume from the last cursor it saw.
+type Broadcaster struct {
+	mu          sync.Mutex
+	cursor      uint64
+	history     []WatchEvent
+	size        int
+	subscribers map[*subscriber]struct{}
+	closed      bool
+}
+
+func NewBroadcaster(size int) *Broadcaster {
+	return &Broadcaster{
+		size:        size,
+		subscribers: make(map[*subscriber]struct{}),
+	}
+}
+
+func ValidWatchKind(kind string) bool {
+	switch kind {
+	case WatchTasks, WatchNodes, WatchEvents:
+		return true
+	}
+	return false
+}
+
+func (b *Broadcaster) Publish(kind string, eventType string, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		log.Printf("[manager][watch] unable to marshal %s object: %v", kind, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.cursor++
+	ev := WatchEvent{
+		Cursor:    b.cursor,
+		Kind:      kind,
+		Type:      eventType,
+		Timestamp: time.Now().UTC(),
+		Object:    data,
+	}
+
+	b.history = append(b.history, ev)
+	if len(b.history) > b.size {
+		b.history = b.history[len(b.history)-b.size:]
+	}
+
+	for s := range b.subscribers {
+		if s.kind != kind {
+			continue
+		}
+		select {
+		case s.ch <- ev:
+		default:
+			// slow watcher, drop it and let it resume from its last cursor
+			log.Printf("[manager][watch] dropping slow %s watcher", s.kind)
+			delete(b.subscribers, s)
+			close(s.ch)
+		}
+	}
+}
+
+// Cursor returns the cursor of the most recently published change.
+func (b *Broadcaster) Cursor() uint64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.cursor
+}
+
+// Subscribe registers a watcher for kind. If cursor is non-zero, any retained
+// changes after it are returned as a backlog to be sent before live changes.
+func (b *Broadcaster) Subscribe(kind string, cursor uint64) ([]WatchEvent, <-chan WatchEvent, func(), error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var backlog []WatchEvent
+
+	if b.closed {
+		return nil, nil, nil, errors.New("[manager] watch is shutting down")
+	}
+
+	if cursor > b.cursor {
+		// the manager restarted since the client last saw this cursor
+		return nil, nil, nil, fmt.Errorf("%w: cursor %d is ahead of %d", ErrCursorExpired, cursor, b.cursor)
+	}
+
+	if cursor > 0 && cursor < b.cursor {
+		if len(b.history) == 0 || b.history[0].Cursor > cursor+1 {
+			return nil, nil, nil, fmt.Errorf("%w: cursor %d", ErrCursorExpired, cursor)
+		}
+		for _, ev := range b.history {
+			if ev.Cursor > cursor && ev.Kind == kind {
+				backlog = append(backlog, ev)
+			}
+		}
+	}
+
+	s := &subscriber{kind: kind, ch: make(chan WatchEvent, 64)}
+	b.subscribers[s] = struct{}{}
+
+	cancel := func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		if _, ok := b.subscribers[s]; ok {
+			delete(b.subscribers, s)
+			close(s.ch)
+		}
+	}
+
+	return backlog, s.ch, cancel, nil
+}
+
+// Close ends every watch stream and refuses new watchers.
+func (b *Broadcaster) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for s := range b.subscribers {
+		delete(b.subscribers, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,209 @@
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/workflow"
+)
+
+func (m *Manager) AddWorkflow(wf workflow.Workflow) (*workflow.Workflow, error) {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	err := wf.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = m.WorkflowDb.Get(wf.Name)
+	if err == nil {
+		return nil, fmt.Errorf("[manager] workflow %s already exists", wf.Name)
+	}
+	if !errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("[manager] error looking up workflow %s: %v", wf.Name, err)
+	}
+
+	wf.ID = uuid.New()
+	wf.CreatedAt = time.Now().UTC()
+	wf.Runs = nil
+
+	err = m.WorkflowDb.Put(wf.Name, &wf)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] error storing workflow %s: %v", wf.Name, err)
+	}
+
+	log.Printf("[manager] added workflow %s with %d steps\n", wf.Name, len(wf.Steps))
+	return &wf, nil
+}
+
+func (m *Manager) GetWorkflows() []*workflow.Workflow {
+	workflows, err := store.All(m.WorkflowDb)
+	if err != nil {
+		log.Printf("[manager] error getting list of workflows: %v\n", err)
+		return nil
+	}
+
+	return workflows
+}
+
+func (m *Manager) GetWorkflow(name string) (*workflow.Workflow, error) {
+	result, err := m.WorkflowDb.Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// RunWorkflow starts a new run of a workflow. Its first steps are started by
+// the next reconcile pass.
+// ErrWorkflowRunning is returned by RunWorkflow while a run of the workflow
+// is still running.
+var ErrWorkflowRunning = errors.New("[manager] workflow is already running")
+
+// ErrInvalidWorkflow is returned by RunWorkflow for a stored workflow that
+// does not validate, e.g. one imported from a state export.
+var ErrInvalidWorkflow = errors.New("[manager] invalid workflow")
+
+func (m *Manager) RunWorkflow(name string) (*workflow.Run, error) {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	wf, err := m.GetWorkflow(name)
+	if err != nil {
+		return nil, err
+	}
+
+	err = wf.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("%w %s: %v", ErrInvalidWorkflow, name, err)
+	}
+
+	if last, err := wf.LatestRun(); err == nil && last.State == workflow.RunRunning {
+		return nil, fmt.Errorf("%w: run %v of %s has not finished", ErrWorkflowRunning, last.ID, name)
+	}
+
+	r := wf.NewRun()
+
+	err = m.WorkflowDb.Put(wf.Name, wf)
+	if err != nil {
+		return nil, fmt.Errorf("[manager] error storing workflow %s: %v", wf.Name, err)
+	}
+
+	log.Printf("[manager] started run %v of workflow %s\n", r.ID, wf.Name)
+	return r, nil
+}
+
+func (m *Manager) reconcileWorkflows() {
+	m.specMu.Lock()
+	defer m.specMu.Unlock()
+
+	for _, wf := range m.GetWorkflows() {
+		changed := false
+
+		for _, r := range wf.Runs {
+			if r.State != workflow.RunRunning {
+				continue
+			}
+
+			if m.advanceRun(wf, r) {
+				changed = true
+			}
+		}
+
+		if changed {
+			err := m.WorkflowDb.Put(wf.Name, wf)
+			if err != nil {
+				log.Printf("[manager] error storing workflow %s: %v\n", wf.Name, err)
+			}
+		}
+	}
+}
+
+// advanceRun starts steps whose dependencies have completed, records steps
+// whose task finished, retries failed steps and skips the steps behind one
+// that failed for good. It reports whether the run changed.
+func (m *Manager) advanceRun(wf *workflow.Workflow, r *workflow.Run) bool {
+	before := fmt.Sprint(r.Steps)
+
+	ready, err := wf.Ready(r)
+	if err != nil {
+		log.Printf("[manager] unable to order steps of workflow %s: %v\n", wf.Name, err)
+		return false
+	}
+
+	for _, i := range ready {
+		step := &wf.Steps[i]
+		sr := &r.Steps[i]
+
+		if sr.State == workflow.StepPending {
+			m.startStep(wf, r, step, sr)
+			continue
+		}
+
+		t, err := m.TaskDb.Get(sr.TaskID.String())
+		if err != nil {
+			log.Printf("[manager] task %v for step %s of workflow %s is gone\n", sr.TaskID, step.Name, wf.Name)
+			m.retryStep(wf, r, step, sr, "task record is gone")
+			continue
+		}
+
+		switch t.State {
+		case task.Completed:
+			sr.State = workflow.StepSucceeded
+			sr.FinishTime = t.FinishTime
+			log.Printf("[manager] step %s of workflow %s run %v succeeded\n", step.Name, wf.Name, r.ID)
+		case task.Failed:
+			m.retryStep(wf, r, step, sr, fmt.Sprintf("task %v failed", t.ID))
+		}
+	}
+
+	if r.Finish() {
+		log.Printf("[manager] run %v of workflow %s finished: %s\n", r.ID, wf.Name, r.State)
+	}
+
+	return before != fmt.Sprint(r.Steps) || r.State != workflow.RunRunning
+}
+
+func (m *Manager) startStep(wf *workflow.Workflow, r *workflow.Run, step *workflow.Step, sr *workflow.StepRun) {
+	t := wf.StepTask(r, step)
+
+	err := m.AddTask(task.TaskEvent{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now().UTC(),
+		Task:      t,
+	})
+	if err != nil {
+		log.Printf("[manager] unable to start step %s of workflow %s: %v\n", step.Name, wf.Name, err)
+		return
+	}
+
+	sr.State = workflow.StepRunning
+	sr.TaskID = t.ID
+	sr.Attempts++
+	if sr.StartTime.IsZero() {
+		sr.StartTime = time.Now().UTC()
+	}
+
+	log.Printf("[manager] started step %s of workflow %s run %v (attempt %d)\n", step.Name, wf.Name, r.ID, sr.Attempts)
+}
+
+func (m *Manager) retryStep(wf *workflow.Workflow, r *workflow.Run, step *workflow.Step, sr *workflow.StepRun, reason string) {
+	if sr.Attempts <= step.Retries {
+		log.Printf("[manager] retrying step %s of workflow %s: %s\n", step.Name, wf.Name, reason)
+		m.startStep(wf, r, step, sr)
+		return
+	}
+
+	log.Printf("[manager] step %s of workflow %s run %v failed after %d attempts: %s\n", step.Name, wf.Name, r.ID, sr.Attempts, reason)
+	sr.State = workflow.StepFailed
+	sr.Message = reason
+	sr.FinishTime = time.Now().UTC()
+}
@@ -0,0 +1,56 @@
+package manager
+
+import (
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/surajsharma/kanastar/task"
+	"github.com/surajsharma/kanastar/workflow"
+)
+
+func TestRunWorkflowHandlerStatus(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+
+	m, err := New(nil, "roundrobin", "memory", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	step := workflow.Step{Name: "extract", Task: task.Task{Image: "busybox"}}
+	_, err = m.AddWorkflow(workflow.Workflow{Name: "etl", Steps: []workflow.Step{step}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// stored without validation, as Import does
+	m.WorkflowDb.Put("broken", &workflow.Workflow{Name: "broken"})
+
+	a := &Api{Manager: m}
+	a.initRouter()
+
+	tests := []struct {
+		name     string
+		workflow string
+		status   int
+	}{
+		{"first run", "etl", http.StatusCreated},
+		{"while the first runs", "etl", http.StatusConflict},
+		{"unknown workflow", "missing", http.StatusNotFound},
+		{"invalid workflow", "broken", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			a.Router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/workflows/"+tt.workflow+"/runs", nil))
+			if rec.Code != tt.status {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.status, rec.Body)
+			}
+		})
+	}
+}
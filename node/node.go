@@ -1,6 +1,7 @@
 package node
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -34,12 +35,13 @@ func NewNode(role string, nApi string, name string) *Node {
 	}
 }
 
-func (n *Node) GetStats() (*stats.Stats, error) {
+// GetStats fetches the node's stats, giving up once ctx is cancelled.
+func (n *Node) GetStats(ctx context.Context) (*stats.Stats, error) {
 	var resp *http.Response
 	var err error
 
 	url := fmt.Sprintf("%s/stats", n.Api)
-	resp, err = utils.HTTPWithRetry(http.Get, url)
+	resp, err = utils.HTTPWithRetry(ctx, utils.HTTP, url)
 	if err != nil {
 		msg := fmt.Sprintf("[node] unable to connect to %v. permanent failure.\n", n.Api)
 		log.Println(msg)
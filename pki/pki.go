@@ -0,0 +1,246 @@
+package pki
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"slices"
+	"time"
+)
+
+// Files names the PEM files a manager, worker or client authenticates with:
+// the cluster CA and its own certificate and key, signed by that CA.
+type Files struct {
+	CA   string
+	Cert string
+	Key  string
+}
+
+// Enabled reports whether any file is set, i.e. whether TLS is wanted.
+func (f Files) Enabled() bool {
+	return f.CA != "" || f.Cert != "" || f.Key != ""
+}
+
+func (f Files) load() (tls.Certificate, *x509.CertPool, error) {
+	if f.CA == "" || f.Cert == "" || f.Key == "" {
+		return tls.Certificate{}, nil, errors.New("[pki] TLS needs a CA, a certificate and a key")
+	}
+
+	cert, err := tls.LoadX509KeyPair(f.Cert, f.Key)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("[pki] unable to load %s and %s: %v", f.Cert, f.Key, err)
+	}
+
+	data, err := os.ReadFile(f.CA)
+	if err != nil {
+		return tls.Certificate{}, nil, fmt.Errorf("[pki] unable to read %s: %v", f.CA, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return tls.Certificate{}, nil, fmt.Errorf("[pki] no certificates in %s", f.CA)
+	}
+
+	return cert, pool, nil
+}
+
+// ServerConfig is the TLS config of an API that only takes requests from
+// clients with a certificate signed by the CA.
+func ServerConfig(f Files) (*tls.Config, error) {
+	cert, pool, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		ClientCAs:    pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}, nil
+}
+
+// NodeServerConfig is the TLS config of an API only the other nodes may
+// call, like a worker's, which takes orders from the manager alone. Client
+// certificates, like kanactl's, are turned away, since they would bypass
+// what the manager checks before it passes requests on.
+func NodeServerConfig(f Files) (*tls.Config, error) {
+	c, err := ServerConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	c.VerifyPeerCertificate = func(_ [][]byte, chains [][]*x509.Certificate) error {
+		if len(chains) == 0 || len(chains[0]) == 0 || !slices.Contains(chains[0][0].ExtKeyUsage, x509.ExtKeyUsageServerAuth) {
+			return errors.New("[pki] only node certificates may call this API")
+		}
+		return nil
+	}
+	return c, nil
+}
+
+// ClientConfig is the TLS config of a client that presents its certificate
+// and only trusts servers with a certificate signed by the CA.
+func ClientConfig(f Files) (*tls.Config, error) {
+	cert, pool, err := f.load()
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{cert},
+		RootCAs:      pool,
+	}, nil
+}
+
+// PeerConfig is the TLS config of a member of a group whose members both
+// accept connections from and make connections to each other.
+func PeerConfig(f Files) (*tls.Config, error) {
+	c, err := ServerConfig(f)
+	if err != nil {
+		return nil, err
+	}
+	c.RootCAs = c.ClientCAs
+	return c, nil
+}
+
+// Kinds of certificates Issue makes.
+const (
+	// Node certificates serve an API and talk to the other nodes' APIs
+	Node = "node"
+	// Client certificates only talk to APIs, like kanactl does
+	Client = "client"
+)
+
+// CA is a certificate authority that issues the certificates of a cluster.
+type CA struct {
+	Cert *x509.Certificate
+	Key  *ecdsa.PrivateKey
+}
+
+// NewCA creates a self-signed CA valid for the given duration.
+func NewCA(name string, validity time.Duration) (*CA, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("[pki] unable to generate CA key: %v", err)
+	}
+
+	tmpl, err := template(name, validity)
+	if err != nil {
+		return nil, err
+	}
+	tmpl.IsCA = true
+	tmpl.BasicConstraintsValid = true
+	tmpl.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, fmt.Errorf("[pki] unable to create CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, fmt.Errorf("[pki] unable to parse CA certificate: %v", err)
+	}
+
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// LoadCA reads a CA written by Write.
+func LoadCA(certFile string, keyFile string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("[pki] unable to load CA from %s and %s: %v", certFile, keyFile, err)
+	}
+
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, fmt.Errorf("[pki] unable to parse %s: %v", certFile, err)
+	}
+	key, ok := pair.PrivateKey.(*ecdsa.PrivateKey)
+	if !ok || !cert.IsCA {
+		return nil, fmt.Errorf("[pki] %s is not a CA issued by kanactl", certFile)
+	}
+
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// Issue signs a certificate of the given kind for name, valid for the given
+// hosts, which may be host names or IP addresses. It returns the
+// certificate and key as PEM.
+func (ca *CA) Issue(name string, kind string, hosts []string, validity time.Duration) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[pki] unable to generate key for %s: %v", name, err)
+	}
+
+	tmpl, err := template(name, validity)
+	if err != nil {
+		return nil, nil, err
+	}
+	tmpl.KeyUsage = x509.KeyUsageDigitalSignature
+
+	switch kind {
+	case Node:
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}
+		for _, h := range hosts {
+			if ip := net.ParseIP(h); ip != nil {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+			} else {
+				tmpl.DNSNames = append(tmpl.DNSNames, h)
+			}
+		}
+	case Client:
+		tmpl.ExtKeyUsage = []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}
+	default:
+		return nil, nil, fmt.Errorf("[pki] unknown certificate kind %q, want %s or %s", kind, Node, Client)
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, ca.Cert, &key.PublicKey, ca.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("[pki] unable to create certificate for %s: %v", name, err)
+	}
+
+	keyPEM, err := encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+// PEM returns the CA's certificate and key as PEM.
+func (ca *CA) PEM() ([]byte, []byte, error) {
+	keyPEM, err := encodeKey(ca.Key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw}), keyPEM, nil
+}
+
+func template(name string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("[pki] unable to generate serial number: %v", err)
+	}
+
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name, Organization: []string{"kanastar"}},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(validity),
+	}, nil
+}
+
+func encodeKey(key *ecdsa.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("[pki] unable to encode key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der}), nil
+}
@@ -0,0 +1,259 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func parse(t *testing.T, certPEM []byte) *x509.Certificate {
+	t.Helper()
+	block, _ := pem.Decode(certPEM)
+	if block == nil {
+		t.Fatal("no PEM block")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert
+}
+
+func newCA(t *testing.T) *CA {
+	t.Helper()
+	ca, err := NewCA("test-ca", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ca
+}
+
+func TestNewCA(t *testing.T) {
+	ca := newCA(t)
+	if !ca.Cert.IsCA || !ca.Cert.BasicConstraintsValid {
+		t.Fatal("the CA certificate is not a CA")
+	}
+	if ca.Cert.KeyUsage != x509.KeyUsageCertSign|x509.KeyUsageCRLSign {
+		t.Fatalf("CA key usage %v", ca.Cert.KeyUsage)
+	}
+}
+
+func TestIssue(t *testing.T) {
+	ca := newCA(t)
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.Cert)
+
+	tests := []struct {
+		name   string
+		kind   string
+		hosts  []string
+		usages []x509.ExtKeyUsage
+		dns    []string
+		ips    []string
+	}{
+		{"node", Node, []string{"manager-1", "10.0.0.1", "localhost"},
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+			[]string{"manager-1", "localhost"}, []string{"10.0.0.1"}},
+		{"node without hosts", Node, nil,
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth}, nil, nil},
+		{"client", Client, []string{"laptop"},
+			[]x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}, nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			certPEM, keyPEM, err := ca.Issue(tt.name, tt.kind, tt.hosts, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := tls.X509KeyPair(certPEM, keyPEM); err != nil {
+				t.Fatalf("certificate and key do not match: %v", err)
+			}
+
+			cert := parse(t, certPEM)
+			if cert.IsCA {
+				t.Fatal("issued a CA certificate")
+			}
+			if cert.KeyUsage != x509.KeyUsageDigitalSignature {
+				t.Fatalf("key usage %v", cert.KeyUsage)
+			}
+			if !slices.Equal(cert.ExtKeyUsage, tt.usages) {
+				t.Fatalf("extended key usage %v, want %v", cert.ExtKeyUsage, tt.usages)
+			}
+			if !slices.Equal(cert.DNSNames, tt.dns) {
+				t.Fatalf("DNS names %v, want %v", cert.DNSNames, tt.dns)
+			}
+			var ips []string
+			for _, ip := range cert.IPAddresses {
+				ips = append(ips, ip.String())
+			}
+			if !slices.Equal(ips, tt.ips) {
+				t.Fatalf("IP addresses %v, want %v", ips, tt.ips)
+			}
+
+			_, err = cert.Verify(x509.VerifyOptions{Roots: roots, KeyUsages: tt.usages})
+			if err != nil {
+				t.Fatalf("not valid for its usages: %v", err)
+			}
+		})
+	}
+
+	if _, _, err := ca.Issue("x", "server", nil, time.Hour); err == nil {
+		t.Fatal("issued a certificate of an unknown kind")
+	}
+}
+
+func TestLoadCA(t *testing.T) {
+	ca := newCA(t)
+	dir := t.TempDir()
+
+	write := func(name string, data []byte) string {
+		file := filepath.Join(dir, name)
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+		return file
+	}
+
+	certPEM, keyPEM, err := ca.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCA(write("ca.crt", certPEM), write("ca.key", keyPEM))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !loaded.Cert.Equal(ca.Cert) || !loaded.Key.Equal(ca.Key) {
+		t.Fatal("the loaded CA differs")
+	}
+
+	leafPEM, leafKey, err := ca.Issue("node", Node, nil, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadCA(write("node.crt", leafPEM), write("node.key", leafKey)); err == nil {
+		t.Fatal("loaded a node certificate as a CA")
+	}
+}
+
+// files writes ca and a certificate of kind issued by signer as PEM files.
+func files(t *testing.T, ca *CA, signer *CA, name string, kind string) Files {
+	t.Helper()
+	dir := t.TempDir()
+
+	caPEM, _, err := ca.PEM()
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM, err := signer.Issue(name, kind, []string{"localhost"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f := Files{CA: filepath.Join(dir, "ca.crt"), Cert: filepath.Join(dir, name+".crt"), Key: filepath.Join(dir, name+".key")}
+	for file, data := range map[string][]byte{f.CA: caPEM, f.Cert: certPEM, f.Key: keyPEM} {
+		if err := os.WriteFile(file, data, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return f
+}
+
+// handshake connects a client with the client config to a server with the
+// server config over loopback and returns the server's error.
+func handshake(t *testing.T, server *tls.Config, client *tls.Config) error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	client = client.Clone()
+	client.ServerName = "localhost"
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		conn, err := tls.Dial("tcp", l.Addr().String(), client)
+		if err != nil {
+			return
+		}
+		// takes in what the server sends after the handshake, like TLS
+		// 1.3 session tickets or its alert, until it hangs up
+		io.Copy(io.Discard, conn)
+		conn.Close()
+	}()
+
+	conn, err := l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = tls.Server(conn, server).Handshake()
+	conn.Close()
+	<-done
+	return err
+}
+
+func TestServerConfigs(t *testing.T) {
+	ca := newCA(t)
+	other := newCA(t)
+
+	server := files(t, ca, ca, "manager", Node)
+
+	tests := []struct {
+		name   string
+		config func(Files) (*tls.Config, error)
+		client Files
+		ok     bool
+	}{
+		{"node to server", ServerConfig, files(t, ca, ca, "worker", Node), true},
+		{"client to server", ServerConfig, files(t, ca, ca, "kanactl", Client), true},
+		{"other CA to server", ServerConfig, files(t, ca, other, "stranger", Node), false},
+		{"node to node server", NodeServerConfig, files(t, ca, ca, "worker", Node), true},
+		{"client to node server", NodeServerConfig, files(t, ca, ca, "kanactl", Client), false},
+		{"other CA to node server", NodeServerConfig, files(t, ca, other, "stranger", Node), false},
+		{"node to peer", PeerConfig, files(t, ca, ca, "manager-2", Node), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sc, err := tt.config(server)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cc, err := ClientConfig(tt.client)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = handshake(t, sc, cc)
+			if tt.ok && err != nil {
+				t.Fatalf("refused: %v", err)
+			}
+			if !tt.ok && err == nil {
+				t.Fatal("accepted")
+			}
+		})
+	}
+}
+
+func TestFilesIncomplete(t *testing.T) {
+	for _, f := range []Files{{CA: "ca.crt"}, {Cert: "a.crt", Key: "a.key"}} {
+		if !f.Enabled() {
+			t.Fatalf("%+v is not enabled", f)
+		}
+		if _, err := ServerConfig(f); err == nil {
+			t.Fatalf("%+v: no error", f)
+		}
+	}
+	if (Files{}).Enabled() {
+		t.Fatal("no files enabled TLS")
+	}
+}
@@ -1,14 +1,26 @@
 package scheduler
 
 import (
+	"context"
 	"log"
 	"math"
+	"sync"
+	"time"
 
 	"github.com/surajsharma/kanastar/node"
 	"github.com/surajsharma/kanastar/task"
 	"github.com/surajsharma/kanastar/utils"
 )
 
+// CpuSampleInterval is how long the scorers wait between the two CPU samples
+// they take of a node.
+var CpuSampleInterval = 3 * time.Second
+
+const (
+	ReasonInsufficientMemory = "insufficient memory"
+	ReasonInsufficientDisk   = "insufficient disk"
+)
+
 const (
 	// LIEB square ice constant
 	// https://en.wikipedia.org/wiki/Lieb%27s_square_ice_constant
@@ -17,13 +29,14 @@ const (
 
 type Scheduler interface {
 	SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node
-	Score(t task.Task, nodes []*node.Node) map[string]float64
+	Score(ctx context.Context, t task.Task, nodes []*node.Node) map[string]float64
 	Pick(scores map[string]float64, candidates []*node.Node) *node.Node
 }
 
 type RoundRobin struct {
 	Name       string
 	LastWorker int
+	mu         sync.Mutex
 }
 
 type Epvm struct {
@@ -39,11 +52,11 @@ func (g *Greedy) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.N
 	return selectCandidateNodes(t, nodes)
 }
 
-func (g *Greedy) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+func (g *Greedy) Score(ctx context.Context, t task.Task, nodes []*node.Node) map[string]float64 {
 	nodeScores := make(map[string]float64)
 
 	for _, node := range nodes {
-		cpuUsage, err := calculateCpuUsage(node)
+		cpuUsage, err := calculateCpuUsage(ctx, node)
 
 		if err != nil {
 			log.Printf("[scheduler] error calculating CPU usage for node %s, skipping: %v\n", node.Name, err)
@@ -82,12 +95,12 @@ func (e *Epvm) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Nod
 	return selectCandidateNodes(t, nodes)
 }
 
-func (e *Epvm) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+func (e *Epvm) Score(ctx context.Context, t task.Task, nodes []*node.Node) map[string]float64 {
 	nodeScores := make(map[string]float64)
 	maxJobs := 4.0
 
 	for _, node := range nodes {
-		cpuUsage, err := calculateCpuUsage(node)
+		cpuUsage, err := calculateCpuUsage(ctx, node)
 		if err != nil {
 			log.Printf("[scheduler] error calculating CPU usage for node %s, skipping: %v\n", node.Name, err)
 			continue
@@ -128,7 +141,10 @@ func (r *RoundRobin) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*no
 	return nodes
 }
 
-func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+func (r *RoundRobin) Score(ctx context.Context, t task.Task, nodes []*node.Node) map[string]float64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
 	nodeScores := make(map[string]float64)
 
 	var newWorker int
@@ -186,6 +202,33 @@ func checkDisk(t task.Task, diskAvailable int64) bool {
 	return t.Disk <= diskAvailable
 }
 
+// Fits reports whether a node has room left for a task's memory and disk,
+// given what is already allocated to it. A node whose capacity has not been
+// collected yet is assumed to have room.
+func Fits(t task.Task, n *node.Node) bool {
+	return FitsIn(t, n, n.Memory-n.MemoryAllocated, n.Disk-n.DiskAllocated)
+}
+
+// FitsIn is like Fits but checks against the given free memory (KiB) and
+// disk (bytes) instead of the node's current allocation.
+func FitsIn(t task.Task, n *node.Node, memFree int64, diskFree int64) bool {
+	return UnfitReason(t, n, memFree, diskFree) == ""
+}
+
+// UnfitReason explains why t does not fit in the given free memory (KiB) and
+// disk (bytes) on n, or returns an empty string if it does.
+func UnfitReason(t task.Task, n *node.Node, memFree int64, diskFree int64) string {
+	if n.Memory > 0 && t.Memory/1000 > memFree {
+		return ReasonInsufficientMemory
+	}
+
+	if n.Disk > 0 && !checkDisk(t, diskFree) {
+		return ReasonInsufficientDisk
+	}
+
+	return ""
+}
+
 func calculateLoad(usage float64, capacity float64) float64 {
 	return usage / capacity
 
@@ -193,17 +236,19 @@ func calculateLoad(usage float64, capacity float64) float64 {
 
 // See discussion from this StackOverflow thread:
 // https://stackoverflow.com/questions/23367857/accurate-calculation-of-cpu-usage-given-in-percentage-in-linux
-func calculateCpuUsage(node *node.Node) (*float64, error) {
+func calculateCpuUsage(ctx context.Context, node *node.Node) (*float64, error) {
 	//stat1 := getNodeStats(node)
-	stat1, err := node.GetStats()
+	stat1, err := node.GetStats(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	utils.Sleep("scheduler", 3)
+	if !utils.SleepContext(ctx, "scheduler", CpuSampleInterval) {
+		return nil, ctx.Err()
+	}
 
 	//stat2 := getNodeStats(node)
-	stat2, err := node.GetStats()
+	stat2, err := node.GetStats(ctx)
 	if err != nil {
 		return nil, err
 	}
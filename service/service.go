@@ -0,0 +1,209 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/task"
+)
+
+const (
+	RolloutComplete    = "complete"
+	RolloutProgressing = "progressing"
+	RolloutPaused      = "paused"
+
+	FailureActionPause    = "pause"
+	FailureActionRollback = "rollback"
+
+	revisionHistoryLimit = 10
+)
+
+// Service keeps a number of identical tasks running from a template.
+type Service struct {
+	ID           uuid.UUID
+	Name         string
+	Replicas     int
+	Template     task.Task
+	UpdateConfig UpdateConfig
+	Revision     int
+	History      []Revision
+	Rollout      Rollout
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// UpdateConfig controls how replicas are replaced when the template changes.
+// MaxSurge is how many replicas may exist above Replicas during an update,
+// MaxUnavailable how many may be missing, and Monitor how long, in seconds, a
+// new replica must keep running before it counts as healthy.
+type UpdateConfig struct {
+	MaxSurge       int
+	MaxUnavailable int
+	Monitor        int
+	FailureAction  string
+}
+
+type Revision struct {
+	Number    int
+	Template  task.Task
+	CreatedAt time.Time
+}
+
+type Rollout struct {
+	State     string
+	Message   string
+	UpdatedAt time.Time
+	// Restarts holds the restart counts the replicas of the revision being
+	// rolled out had when the rollout started; only restarts beyond them
+	// fail it
+	Restarts map[string]int `json:",omitempty"`
+}
+
+type ScaleRequest struct {
+	Replicas int
+}
+
+type RollbackRequest struct {
+	Revision int
+}
+
+type RolloutStatus struct {
+	Service     string
+	Revision    int
+	State       string
+	Message     string
+	Replicas    int
+	Updated     int
+	Available   int
+	Outdated    int
+	History     []Revision
+	LastUpdated time.Time
+}
+
+func (s *Service) Validate() error {
+	if s.Name == "" {
+		return errors.New("[service] name is required")
+	}
+
+	if s.Replicas < 0 {
+		return fmt.Errorf("[service] replicas must not be negative, got %d", s.Replicas)
+	}
+
+	if s.Template.Image == "" {
+		return errors.New("[service] template image is required")
+	}
+
+	u := s.UpdateConfig
+	if u.MaxSurge < 0 || u.MaxUnavailable < 0 || u.Monitor < 0 {
+		return errors.New("[service] update config values must not be negative")
+	}
+
+	if u.MaxSurge == 0 && u.MaxUnavailable == 0 {
+		return errors.New("[service] one of MaxSurge or MaxUnavailable must be greater than zero")
+	}
+
+	switch u.FailureAction {
+	case FailureActionPause, FailureActionRollback:
+	default:
+		return fmt.Errorf("[service] unknown failure action %q", u.FailureAction)
+	}
+
+	return nil
+}
+
+// SetDefaults fills in the update config left empty in a specification.
+func (s *Service) SetDefaults() {
+	if s.UpdateConfig.MaxSurge == 0 && s.UpdateConfig.MaxUnavailable == 0 {
+		s.UpdateConfig.MaxSurge = 1
+	}
+
+	if s.UpdateConfig.FailureAction == "" {
+		s.UpdateConfig.FailureAction = FailureActionPause
+	}
+}
+
+// AddRevision records the current template as a new revision and makes it
+// the one replicas should run.
+func (s *Service) AddRevision() {
+	next := 1
+	if len(s.History) > 0 {
+		next = s.History[len(s.History)-1].Number + 1
+	}
+
+	s.Revision = next
+	s.History = append(s.History, Revision{
+		Number:    next,
+		Template:  s.Template,
+		CreatedAt: time.Now().UTC(),
+	})
+
+	if len(s.History) > revisionHistoryLimit {
+		s.History = s.History[len(s.History)-revisionHistoryLimit:]
+	}
+}
+
+func (s *Service) GetRevision(number int) (*Revision, error) {
+	for i := range s.History {
+		if s.History[i].Number == number {
+			return &s.History[i], nil
+		}
+	}
+	return nil, fmt.Errorf("[service] revision %d of %s not found", number, s.Name)
+}
+
+// PreviousRevision returns the newest revision recorded before the current one.
+func (s *Service) PreviousRevision() (*Revision, error) {
+	var prev *Revision
+	for i := range s.History {
+		if s.History[i].Number < s.Revision && (prev == nil || s.History[i].Number > prev.Number) {
+			prev = &s.History[i]
+		}
+	}
+
+	if prev == nil {
+		return nil, fmt.Errorf("[service] %s has no revision before %d", s.Name, s.Revision)
+	}
+
+	return prev, nil
+}
+
+func (s *Service) SetRollout(state string, msg string) {
+	s.Rollout = Rollout{
+		State:     state,
+		Message:   msg,
+		UpdatedAt: time.Now().UTC(),
+	}
+}
+
+// NewTask creates a replica from the service template. The task name doubles
+// as the container name, so it gets a unique suffix.
+func (s *Service) NewTask() task.Task {
+	return s.newTask(s.Template, s.Revision)
+}
+
+// RevisionTask creates a replica of an earlier revision, as long as the
+// history still holds it.
+func (s *Service) RevisionTask(number int) (task.Task, error) {
+	rev, err := s.GetRevision(number)
+	if err != nil {
+		return task.Task{}, err
+	}
+	return s.newTask(rev.Template, rev.Number), nil
+}
+
+func (s *Service) newTask(template task.Task, revision int) task.Task {
+	t := template
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%s", s.Name, t.ID.String()[:8])
+	t.Service = s.Name
+	t.Revision = revision
+	t.State = task.Pending
+	t.ContainerID = ""
+	t.HostPorts = nil
+	t.RestartCount = 0
+	t.StartTime = time.Time{}
+	t.FinishTime = time.Time{}
+	return t
+}
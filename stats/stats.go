@@ -2,6 +2,7 @@ package stats
 
 import (
 	"log"
+	"time"
 
 	"github.com/c9s/goprocinfo/linux"
 )
@@ -12,6 +13,26 @@ type Stats struct {
 	CpuStats  *linux.CPUStat
 	LoadStats *linux.LoadAvg
 	TaskCount int
+	// containers of the worker that no task accounts for
+	Orphans []Orphan
+}
+
+// Orphan is a container labelled as created by a worker that no task on the
+// worker accounts for: its task is unknown, or the task has moved on to
+// another container or spec.
+type Orphan struct {
+	ContainerID string
+	Name        string
+	Image       string
+	TaskID      string
+	TaskName    string
+	State       string
+	Created     time.Time
+	// why no task accounts for it
+	Reason string
+	// what the worker did with it, after its orphan policy
+	Action string
+	Error  string `json:",omitempty"`
 }
 
 func (s *Stats) MemTotalKb() uint64 {
@@ -0,0 +1,130 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// BoltStore keeps values as JSON in a single bucket of a bolt database.
+type BoltStore[T any] struct {
+	Db       *bolt.DB
+	DbFile   string
+	FileMode os.FileMode
+	Bucket   string
+}
+
+func NewBoltStore[T any](file string, mode os.FileMode, bucket string) (*BoltStore[T], error) {
+	db, err := bolt.Open(file, mode, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("[bolt] unable to open boltDB file %v: %v", file, err)
+	}
+
+	s := BoltStore[T]{
+		DbFile:   file,
+		FileMode: mode,
+		Db:       db,
+		Bucket:   bucket,
+	}
+
+	err = s.CreateBucket()
+	if err != nil {
+		log.Printf("[bolt] bucket %s already exists, will use it instead of creating new one", bucket)
+	}
+
+	return &s, nil
+}
+
+func (s *BoltStore[T]) Put(key string, value *T) error {
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.Bucket))
+
+		buf, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+
+		err = b.Put([]byte(key), buf)
+		if err != nil {
+			log.Printf("[bolt] unable to save item %s", key)
+			return err
+		}
+		return nil
+	})
+}
+
+func (s *BoltStore[T]) Get(key string) (*T, error) {
+	var v T
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.Bucket))
+		data := b.Get([]byte(key))
+		if data == nil {
+			return notFound(s.Bucket, key)
+		}
+		return json.Unmarshal(data, &v)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+func (s *BoltStore[T]) Delete(key string) error {
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.Bucket))
+		if b.Get([]byte(key)) == nil {
+			return notFound(s.Bucket, key)
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
+func (s *BoltStore[T]) List(q Query[T]) (Page[T], error) {
+	p := newPager(q)
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(s.Bucket))
+		return b.ForEach(func(k, data []byte) error {
+			var v T
+			err := json.Unmarshal(data, &v)
+			if err != nil {
+				return fmt.Errorf("[bolt] unable to decode %s %s: %v", s.Bucket, k, err)
+			}
+			p.add(&v)
+			return nil
+		})
+	})
+	if err != nil {
+		return Page[T]{}, err
+	}
+	return p.page, nil
+}
+
+func (s *BoltStore[T]) Count() (int, error) {
+	count := 0
+	err := s.Db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket([]byte(s.Bucket)).Stats().KeyN
+		return nil
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+func (s *BoltStore[T]) Close() error {
+	return s.Db.Close()
+}
+
+func (s *BoltStore[T]) CreateBucket() error {
+	return s.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(s.Bucket))
+		if err != nil {
+			return fmt.Errorf("[bolt] could not create bucket %s: %s", s.Bucket, err)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,113 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Retention bounds how long finished values are kept and how many of them.
+// A zero field means no bound.
+type Retention struct {
+	TTL      time.Duration
+	MaxCount int
+}
+
+// Compactor deletes finished values from a store once its Retention no longer
+// covers them. Values that are not finished are never deleted and do not
+// count towards MaxCount; of the finished ones the most recent are kept.
+type Compactor[T any] struct {
+	Name      string
+	Store     Store[T]
+	Retention Retention
+	// Key returns the key v is stored under
+	Key func(*T) string
+	// Finished reports whether v may be deleted and when it finished
+	Finished func(*T) (time.Time, bool)
+	// Lock, if set, is held while compacting so the values cannot change
+	// between being judged finished and being deleted
+	Lock sync.Locker
+	// Removed, if set, is called by Run with the values each round deleted
+	Removed func([]*T)
+}
+
+type finished[T any] struct {
+	value *T
+	at    time.Time
+}
+
+// Compact deletes the values that fell out of the retention as of now and
+// returns them.
+func (c *Compactor[T]) Compact(now time.Time) ([]*T, error) {
+	if c.Retention.TTL <= 0 && c.Retention.MaxCount <= 0 {
+		return nil, nil
+	}
+
+	if c.Lock != nil {
+		c.Lock.Lock()
+		defer c.Lock.Unlock()
+	}
+
+	var done []finished[T]
+	_, err := c.Store.List(Query[T]{
+		Match: func(v *T) bool {
+			at, ok := c.Finished(v)
+			if ok {
+				done = append(done, finished[T]{value: v, at: at})
+			}
+			return false
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// newest first, so everything past MaxCount is the oldest
+	sort.Slice(done, func(i, j int) bool {
+		return done[i].at.After(done[j].at)
+	})
+
+	var removed []*T
+	for i, f := range done {
+		expired := c.Retention.TTL > 0 && now.Sub(f.at) > c.Retention.TTL
+		surplus := c.Retention.MaxCount > 0 && i >= c.Retention.MaxCount
+		if !expired && !surplus {
+			continue
+		}
+
+		err := c.Store.Delete(c.Key(f.value))
+		if err != nil && !errors.Is(err, ErrNotFound) {
+			return removed, err
+		}
+		removed = append(removed, f.value)
+	}
+
+	return removed, nil
+}
+
+// Run compacts the store every interval until ctx is cancelled.
+func (c *Compactor[T]) Run(ctx context.Context, interval time.Duration) {
+	for {
+		values, err := c.Compact(time.Now().UTC())
+		if err != nil {
+			log.Printf("[store] error compacting %s: %v\n", c.Name, err)
+		}
+		if len(values) > 0 {
+			log.Printf("[store] compacted %d %s\n", len(values), c.Name)
+			if c.Removed != nil {
+				c.Removed(values)
+			}
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCompact(t *testing.T) {
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// items in group "done" finished Size minutes before now; the others
+	// have not finished
+	items := []item{
+		{Name: "done-1", Group: "done", Size: 1},
+		{Name: "done-5", Group: "done", Size: 5},
+		{Name: "done-10", Group: "done", Size: 10},
+		{Name: "done-60", Group: "done", Size: 60},
+		{Name: "running-90", Group: "running", Size: 90},
+		{Name: "running-120", Group: "running", Size: 120},
+	}
+
+	tests := []struct {
+		name      string
+		retention Retention
+		removed   []string
+	}{
+		{"no retention", Retention{}, nil},
+		{"ttl", Retention{TTL: 8 * time.Minute}, []string{"done-10", "done-60"}},
+		{"ttl is exclusive", Retention{TTL: 10 * time.Minute}, []string{"done-60"}},
+		{"ttl longer than all", Retention{TTL: 24 * time.Hour}, nil},
+		{"max count keeps the newest", Retention{MaxCount: 2}, []string{"done-10", "done-60"}},
+		{"unfinished do not count", Retention{MaxCount: 4}, nil},
+		{"max count of one", Retention{MaxCount: 1}, []string{"done-5", "done-10", "done-60"}},
+		{"ttl and max count", Retention{TTL: 30 * time.Minute, MaxCount: 3}, []string{"done-60"}},
+		{"max count within ttl", Retention{TTL: 30 * time.Minute, MaxCount: 1}, []string{"done-5", "done-10", "done-60"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewMemoryStore[item]("items")
+			for i := range items {
+				err := s.Put(items[i].Name, &items[i])
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			c := Compactor[item]{
+				Name:      "items",
+				Store:     s,
+				Retention: tt.retention,
+				Key:       func(v *item) string { return v.Name },
+				Finished: func(v *item) (time.Time, bool) {
+					return now.Add(-time.Duration(v.Size) * time.Minute), v.Group == "done"
+				},
+			}
+
+			removed, err := c.Compact(now)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, v := range removed {
+				got = append(got, v.Name)
+			}
+			sort.Strings(got)
+			want := append([]string(nil), tt.removed...)
+			sort.Strings(want)
+			if fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("removed %v, want %v", got, want)
+			}
+
+			n, err := s.Count()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(items)-len(want) {
+				t.Errorf("%d items left, want %d", n, len(items)-len(want))
+			}
+			for _, name := range want {
+				_, err := s.Get(name)
+				if err == nil {
+					t.Errorf("%s is still in the store", name)
+				}
+			}
+		})
+	}
+}
+
+func TestCompactorRun(t *testing.T) {
+	quiet(t)
+
+	s := NewMemoryStore[item]("items")
+	for i := 0; i < 3; i++ {
+		name := fmt.Sprint("item-", i)
+		err := s.Put(name, &item{Name: name})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	removed := make(chan []*item, 1)
+	c := Compactor[item]{
+		Name:      "items",
+		Store:     s,
+		Retention: Retention{MaxCount: 1},
+		Key:       func(v *item) string { return v.Name },
+		Finished:  func(v *item) (time.Time, bool) { return time.Time{}, true },
+		Removed: func(values []*item) {
+			removed <- values
+			cancel()
+		},
+	}
+
+	done := make(chan struct{})
+	go func() {
+		c.Run(ctx, time.Hour)
+		close(done)
+	}()
+
+	select {
+	case values := <-removed:
+		if len(values) != 2 {
+			t.Errorf("removed %d items, want 2", len(values))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not compact")
+	}
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run did not stop when its context was cancelled")
+	}
+}
@@ -0,0 +1,90 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// MemoryStore keeps values in a map. Values are copied on the way in and
+// out, like the bolt store, so callers never share them.
+type MemoryStore[T any] struct {
+	Db   map[string]*T
+	Name string
+	mu   sync.RWMutex
+}
+
+// NewMemoryStore returns an empty store. The name only appears in errors.
+func NewMemoryStore[T any](name string) *MemoryStore[T] {
+	return &MemoryStore[T]{
+		Db:   make(map[string]*T),
+		Name: name,
+	}
+}
+
+func (s *MemoryStore[T]) Put(key string, value *T) error {
+	c, err := clone(value)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.Db[key] = c
+	return nil
+}
+
+func (s *MemoryStore[T]) Get(key string) (*T, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.Db[key]
+	if !ok {
+		return nil, notFound(s.Name, key)
+	}
+	return clone(v)
+}
+
+func (s *MemoryStore[T]) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.Db[key]; !ok {
+		return notFound(s.Name, key)
+	}
+	delete(s.Db, key)
+	return nil
+}
+
+func (s *MemoryStore[T]) List(q Query[T]) (Page[T], error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	// same order as bolt, which keeps keys sorted
+	keys := make([]string, 0, len(s.Db))
+	for k := range s.Db {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	p := newPager(q)
+	for _, k := range keys {
+		c, err := clone(s.Db[k])
+		if err != nil {
+			return Page[T]{}, err
+		}
+		p.add(c)
+	}
+	return p.page, nil
+}
+
+func (s *MemoryStore[T]) Count() (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return len(s.Db), nil
+}
+
+func (s *MemoryStore[T]) Close() error {
+	return nil
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// ErrSnapshotUnsupported is returned for stores that cannot be snapshotted.
+var ErrSnapshotUnsupported = errors.New("[store] store does not support snapshots")
+
+// Snapshotter is implemented by stores that can write a consistent copy of
+// their database while it is in use.
+type Snapshotter interface {
+	// BeginSnapshot fixes the point in time the copy is taken at. Writes
+	// made afterwards are not in it, however long writing it out takes.
+	BeginSnapshot() (Snapshot, error)
+}
+
+// Snapshot is a copy of a store as of when it was begun. It must be closed
+// once written out.
+type Snapshot interface {
+	io.WriterTo
+	Close() error
+}
+
+// BeginSnapshot starts a read transaction the database is copied from, so
+// writers are not blocked while the copy is written.
+func (s *BoltStore[T]) BeginSnapshot() (Snapshot, error) {
+	tx, err := s.Db.Begin(false)
+	if err != nil {
+		return nil, fmt.Errorf("[bolt] unable to begin snapshot: %v", err)
+	}
+	return boltSnapshot{tx}, nil
+}
+
+type boltSnapshot struct {
+	tx *bolt.Tx
+}
+
+func (s boltSnapshot) WriteTo(w io.Writer) (int64, error) {
+	return s.tx.WriteTo(w)
+}
+
+func (s boltSnapshot) Close() error {
+	return s.tx.Rollback()
+}
+
+// BeginSnapshot begins a snapshot of s if it supports snapshots.
+func BeginSnapshot(s interface{}) (Snapshot, error) {
+	snap, ok := s.(Snapshotter)
+	if !ok {
+		return nil, ErrSnapshotUnsupported
+	}
+	return snap.BeginSnapshot()
+}
+
+// RestoreBoltFile replaces the bolt database at file with the snapshot read
+// from r. The snapshot is checked before anything is replaced, and it fails
+// if file is held open by a running process.
+func RestoreBoltFile(file string, mode os.FileMode, r io.Reader) error {
+	tmp := file + ".restore"
+
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return fmt.Errorf("[bolt] unable to create %s: %v", tmp, err)
+	}
+
+	_, err = io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("[bolt] unable to write %s: %v", tmp, err)
+	}
+
+	db, err := bolt.Open(tmp, mode, &bolt.Options{Timeout: time.Second, ReadOnly: true})
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("[bolt] snapshot for %s is not a valid database: %v", file, err)
+	}
+	db.Close()
+
+	if _, err := os.Stat(file); err == nil {
+		db, err := bolt.Open(file, mode, &bolt.Options{Timeout: time.Second})
+		if err != nil {
+			os.Remove(tmp)
+			return fmt.Errorf("[bolt] unable to open %s, is the manager still running? %v", file, err)
+		}
+		db.Close()
+	}
+
+	err = os.Rename(tmp, file)
+	if err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("[bolt] unable to replace %s: %v", file, err)
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Migration is one step of a SQLite schema. Migrations are applied in order
+// of Version, each in its own transaction, and recorded so that every step
+// runs once.
+type Migration struct {
+	Version     int
+	Description string
+	SQL         string
+}
+
+// SQLiteDB is a SQLite database shared by the stores kept in its tables. It
+// is closed when the last of them is.
+type SQLiteDB struct {
+	Db   *sql.DB
+	File string
+
+	mu   sync.Mutex
+	refs int
+}
+
+// OpenSQLite opens the database in file, creating it if needed, and brings
+// its schema up to date.
+func OpenSQLite(file string, migrations []Migration) (*SQLiteDB, error) {
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000&_foreign_keys=on", file)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("[sqlite] unable to open %v: %v", file, err)
+	}
+
+	err = Migrate(db, migrations)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &SQLiteDB{Db: db, File: file}, nil
+}
+
+// Migrate applies the migrations db has not seen yet. It refuses a database
+// written by a newer schema than it knows.
+func Migrate(db *sql.DB, migrations []Migration) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version INTEGER PRIMARY KEY,
+		description TEXT NOT NULL,
+		applied_at INTEGER NOT NULL
+	)`)
+	if err != nil {
+		return fmt.Errorf("[sqlite] unable to create schema_migrations: %v", err)
+	}
+
+	var current int
+	err = db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&current)
+	if err != nil {
+		return fmt.Errorf("[sqlite] unable to read schema version: %v", err)
+	}
+
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	if n := len(sorted); n > 0 && current > sorted[n-1].Version {
+		return fmt.Errorf("[sqlite] database schema version %d is newer than %d, the latest this build knows", current, sorted[n-1].Version)
+	}
+
+	for _, m := range sorted {
+		if m.Version <= current {
+			continue
+		}
+
+		tx, err := db.Begin()
+		if err != nil {
+			return fmt.Errorf("[sqlite] unable to start migration %d: %v", m.Version, err)
+		}
+
+		_, err = tx.Exec(m.SQL)
+		if err == nil {
+			_, err = tx.Exec(`INSERT INTO schema_migrations (version, description, applied_at) VALUES (?, ?, ?)`,
+				m.Version, m.Description, time.Now().UTC().Unix())
+		}
+		if err == nil {
+			err = tx.Commit()
+		}
+		if err != nil {
+			tx.Rollback()
+			return fmt.Errorf("[sqlite] migration %d (%s) failed: %v", m.Version, m.Description, err)
+		}
+
+		log.Printf("[sqlite] applied migration %d: %s\n", m.Version, m.Description)
+	}
+
+	return nil
+}
+
+func (d *SQLiteDB) acquire() {
+	d.mu.Lock()
+	d.refs++
+	d.mu.Unlock()
+}
+
+func (d *SQLiteDB) release() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.refs--
+	if d.refs > 0 {
+		return nil
+	}
+	return d.Db.Close()
+}
+
+// Column is an indexed column of a SQLite table, filled from each value
+// when it is stored.
+type Column[T any] struct {
+	Name  string
+	Value func(*T) interface{}
+}
+
+// SQLiteStore keeps values as JSON in the data column of a table keyed by
+// the key column, next to the indexed columns the schema defines for it.
+type SQLiteStore[T any] struct {
+	db      *SQLiteDB
+	table   string
+	columns []Column[T]
+}
+
+func NewSQLiteStore[T any](db *SQLiteDB, table string, columns ...Column[T]) *SQLiteStore[T] {
+	db.acquire()
+	return &SQLiteStore[T]{db: db, table: table, columns: columns}
+}
+
+func (s *SQLiteStore[T]) Put(key string, value *T) error {
+	buf, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+
+	names := []string{"key", "data"}
+	args := []interface{}{key, string(buf)}
+	updates := []string{"data = excluded.data"}
+	for _, c := range s.columns {
+		names = append(names, c.Name)
+		args = append(args, c.Value(value))
+		updates = append(updates, fmt.Sprintf("%s = excluded.%s", c.Name, c.Name))
+	}
+
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s) ON CONFLICT(key) DO UPDATE SET %s",
+		s.table, strings.Join(names, ", "), placeholders(len(names)), strings.Join(updates, ", "))
+
+	_, err = s.db.Db.Exec(query, args...)
+	if err != nil {
+		log.Printf("[sqlite] unable to save item %s", key)
+		return err
+	}
+	return nil
+}
+
+func (s *SQLiteStore[T]) Get(key string) (*T, error) {
+	var data string
+	err := s.db.Db.QueryRow(fmt.Sprintf("SELECT data FROM %s WHERE key = ?", s.table), key).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, notFound(s.table, key)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var v T
+	err = json.Unmarshal([]byte(data), &v)
+	if err != nil {
+		return nil, fmt.Errorf("[sqlite] unable to decode %s %s: %v", s.table, key, err)
+	}
+	return &v, nil
+}
+
+func (s *SQLiteStore[T]) Delete(key string) error {
+	result, err := s.db.Db.Exec(fmt.Sprintf("DELETE FROM %s WHERE key = ?", s.table), key)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return notFound(s.table, key)
+	}
+	return nil
+}
+
+// List turns the query's Where conditions on indexed columns into SQL, so
+// only matching rows are read; Match is applied to those as usual.
+func (s *SQLiteStore[T]) List(q Query[T]) (Page[T], error) {
+	query := fmt.Sprintf("SELECT key, data FROM %s", s.table)
+
+	var conds []string
+	var args []interface{}
+	for _, name := range sortedKeys(q.Where) {
+		if !s.hasColumn(name) {
+			continue
+		}
+		conds = append(conds, name+" = ?")
+		args = append(args, q.Where[name])
+	}
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	query += " ORDER BY key"
+
+	rows, err := s.db.Db.Query(query, args...)
+	if err != nil {
+		return Page[T]{}, err
+	}
+	defer rows.Close()
+
+	p := newPager(q)
+	for rows.Next() {
+		var key, data string
+		err := rows.Scan(&key, &data)
+		if err != nil {
+			return Page[T]{}, err
+		}
+
+		var v T
+		err = json.Unmarshal([]byte(data), &v)
+		if err != nil {
+			return Page[T]{}, fmt.Errorf("[sqlite] unable to decode %s %s: %v", s.table, key, err)
+		}
+		p.add(&v)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Page[T]{}, err
+	}
+	return p.page, nil
+}
+
+func (s *SQLiteStore[T]) Count() (int, error) {
+	var count int
+	err := s.db.Db.QueryRow(fmt.Sprintf("SELECT COUNT(*) FROM %s", s.table)).Scan(&count)
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+func (s *SQLiteStore[T]) Close() error {
+	return s.db.release()
+}
+
+func (s *SQLiteStore[T]) hasColumn(name string) bool {
+	for _, c := range s.columns {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// UnixMilli is a column value for a timestamp, NULL for the zero time so
+// unset timestamps stay out of range scans.
+func UnixMilli(t time.Time) interface{} {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UnixMilli()
+}
+
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
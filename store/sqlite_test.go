@@ -0,0 +1,286 @@
+package store
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"path/filepath"
+	"testing"
+)
+
+type item struct {
+	Name  string
+	Group string
+	Size  int
+}
+
+var itemMigrations = []Migration{
+	{
+		Version:     1,
+		Description: "create items",
+		SQL: `
+CREATE TABLE items (
+	key TEXT PRIMARY KEY,
+	data TEXT NOT NULL,
+	item_group TEXT NOT NULL
+);
+CREATE INDEX items_group ON items (item_group);
+`,
+	},
+	{
+		Version:     2,
+		Description: "add the size of items",
+		SQL: `
+ALTER TABLE items ADD COLUMN size INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX items_size ON items (size);
+`,
+	},
+}
+
+var itemColumns = []Column[item]{
+	{Name: "item_group", Value: func(i *item) interface{} { return i.Group }},
+	{Name: "size", Value: func(i *item) interface{} { return i.Size }},
+}
+
+func quiet(t *testing.T) {
+	out := log.Writer()
+	log.SetOutput(io.Discard)
+	t.Cleanup(func() { log.SetOutput(out) })
+}
+
+func openRaw(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite3", "file:"+filepath.Join(t.TempDir(), "test.sqlite"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func schemaVersion(t *testing.T, db *sql.DB) int {
+	var v int
+	err := db.QueryRow(`SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func TestMigrateFresh(t *testing.T) {
+	quiet(t)
+	db := openRaw(t)
+
+	err := Migrate(db, itemMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := schemaVersion(t, db); v != 2 {
+		t.Fatalf("schema version %d, want 2", v)
+	}
+
+	_, err = db.Exec(`INSERT INTO items (key, data, item_group, size) VALUES ('a', '{}', 'g', 3)`)
+	if err != nil {
+		t.Fatalf("the migrated schema lacks a column: %v", err)
+	}
+
+	// running it again changes nothing
+	err = Migrate(db, itemMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&n)
+	if n != 2 {
+		t.Fatalf("%d migrations recorded, want 2", n)
+	}
+}
+
+func TestMigrateUpgrade(t *testing.T) {
+	quiet(t)
+	db := openRaw(t)
+
+	err := Migrate(db, itemMigrations[:1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.Exec(`INSERT INTO items (key, data, item_group) VALUES ('a', '{"Name":"a"}', 'g')`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// migrations are applied in version order whatever order they are given in
+	err = Migrate(db, []Migration{itemMigrations[1], itemMigrations[0]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := schemaVersion(t, db); v != 2 {
+		t.Fatalf("schema version %d, want 2", v)
+	}
+
+	var data string
+	var size int
+	err = db.QueryRow(`SELECT data, size FROM items WHERE key = 'a'`).Scan(&data, &size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data != `{"Name":"a"}` || size != 0 {
+		t.Fatalf("row became %s with size %d after the upgrade", data, size)
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	quiet(t)
+	db := openRaw(t)
+
+	err := Migrate(db, itemMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = Migrate(db, itemMigrations[:1])
+	if err == nil {
+		t.Fatal("a build that knows version 1 accepted a version 2 database")
+	}
+}
+
+func TestMigrateRollsBackFailedStep(t *testing.T) {
+	quiet(t)
+	db := openRaw(t)
+
+	broken := []Migration{
+		itemMigrations[0],
+		{Version: 2, Description: "broken", SQL: `ALTER TABLE items ADD COLUMN extra TEXT; ALTER TABLE missing ADD COLUMN x TEXT;`},
+	}
+	err := Migrate(db, broken)
+	if err == nil {
+		t.Fatal("a failing migration was not reported")
+	}
+	if v := schemaVersion(t, db); v != 1 {
+		t.Fatalf("schema version %d after a failed step, want 1", v)
+	}
+
+	_, err = db.Exec(`SELECT extra FROM items`)
+	if err == nil {
+		t.Fatal("the failed migration was partly applied")
+	}
+}
+
+func openItems(t *testing.T) *SQLiteStore[item] {
+	quiet(t)
+	db, err := OpenSQLite(filepath.Join(t.TempDir(), "items.sqlite"), itemMigrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewSQLiteStore(db, "items", itemColumns...)
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestSQLiteStorePutGetDelete(t *testing.T) {
+	s := openItems(t)
+
+	err := s.Put("a", &item{Name: "a", Group: "g1", Size: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// a second put replaces the value and its indexed columns
+	err = s.Put("a", &item{Name: "a", Group: "g2", Size: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Group != "g2" || got.Size != 2 {
+		t.Fatalf("got %+v, want the second put", got)
+	}
+
+	page, err := s.List(Query[item]{Where: map[string]interface{}{"item_group": "g1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 0 {
+		t.Fatalf("the old indexed value still matches %d items", page.Total)
+	}
+
+	err = s.Delete("a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.Get("a")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("get after delete: %v, want ErrNotFound", err)
+	}
+	err = s.Delete("a")
+	if !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second delete: %v, want ErrNotFound", err)
+	}
+}
+
+func TestSQLiteStoreList(t *testing.T) {
+	s := openItems(t)
+
+	for i := 0; i < 10; i++ {
+		group := "even"
+		if i%2 == 1 {
+			group = "odd"
+		}
+		err := s.Put(fmt.Sprintf("k%02d", i), &item{Name: fmt.Sprintf("k%02d", i), Group: group, Size: i})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		q     Query[item]
+		total int
+		names []string
+	}{
+		{"everything", Query[item]{}, 10, []string{"k00", "k01", "k02", "k03", "k04", "k05", "k06", "k07", "k08", "k09"}},
+		{"where", Query[item]{Where: map[string]interface{}{"item_group": "odd"}}, 5, []string{"k01", "k03", "k05", "k07", "k09"}},
+		{"two columns", Query[item]{Where: map[string]interface{}{"item_group": "odd", "size": 3}}, 1, []string{"k03"}},
+		{"unknown column is ignored", Query[item]{Where: map[string]interface{}{"colour": "red"}}, 10, nil},
+		{"offset and limit", Query[item]{Offset: 2, Limit: 3}, 10, []string{"k02", "k03", "k04"}},
+		{"where and page", Query[item]{Where: map[string]interface{}{"item_group": "even"}, Offset: 1, Limit: 2}, 5, []string{"k02", "k04"}},
+		{"offset past the end", Query[item]{Offset: 20}, 10, []string{}},
+		{"match on top of where", Query[item]{
+			Where: map[string]interface{}{"item_group": "even"},
+			Match: func(i *item) bool { return i.Size > 4 },
+		}, 2, []string{"k06", "k08"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := s.List(tt.q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page.Total != tt.total {
+				t.Fatalf("total %d, want %d", page.Total, tt.total)
+			}
+			if tt.names == nil {
+				return
+			}
+			var names []string
+			for _, i := range page.Items {
+				names = append(names, i.Name)
+			}
+			if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+				t.Fatalf("got %v, want %v", names, tt.names)
+			}
+		})
+	}
+
+	n, err := s.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatalf("count %d, want 10", n)
+	}
+}
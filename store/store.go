@@ -2,343 +2,100 @@ package store
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
-	"os"
-
-	"github.com/boltdb/bolt"
-	"github.com/surajsharma/kanastar/task"
 )
 
-type Store interface {
-	Put(key string, value interface{}) error
-	Get(key string) (interface{}, error)
-	List() (interface{}, error)
-	Count() (int, error)
-}
-
-type TaskStore struct {
-	Db       *bolt.DB
-	DbFile   string
-	FileMode os.FileMode
-	Bucket   string
-}
-
-type EventStore struct {
-	DbFile   string
-	FileMode os.FileMode
-	Db       *bolt.DB
-	Bucket   string
-}
-
-type InMemoryTaskStore struct {
-	Db map[string]*task.Task
-}
-
-type InMemoryTaskEventStore struct {
-	Db map[string]*task.TaskEvent
-}
-
-func NewEventStore(file string, mode os.FileMode, bucket string) (*EventStore, error) {
-	db, err := bolt.Open(file, mode, nil)
-	if err != nil {
-		return nil, fmt.Errorf("[bolt] unable to open file %v", file)
-	}
-	e := EventStore{
-		DbFile:   file,
-		FileMode: mode,
-		Db:       db,
-		Bucket:   bucket,
-	}
-
-	err = e.CreateBucket()
-	if err != nil {
-		log.Printf("[bolt] bucket already exists, will use it instead of creating new one")
-	}
-
-	return &e, nil
-}
-
-func NewTaskStore(file string, mode os.FileMode, bucket string) (*TaskStore, error) {
-	db, err := bolt.Open(file, mode, nil)
-
-	if err != nil {
-		return nil, fmt.Errorf("[bolt] unable to open boltDB file %v", file)
-	}
-
-	t := TaskStore{
-		DbFile:   file,
-		FileMode: mode,
-		Db:       db,
-		Bucket:   bucket,
-	}
-
-	err = t.CreateBucket()
-	if err != nil {
-		log.Printf("[bolt] transaction bucket already exists, will use it instead of creating new one")
-	}
-
-	return &t, nil
-}
-
-func NewInMemoryTaskStore() *InMemoryTaskStore {
-	return &InMemoryTaskStore{
-		Db: make(map[string]*task.Task),
-	}
-}
-
-func NewInMemoryTaskEventStore() *InMemoryTaskEventStore {
-	return &InMemoryTaskEventStore{
-		Db: make(map[string]*task.TaskEvent),
-	}
-}
-
-func (e *EventStore) Put(key string, value interface{}) error {
-	return e.Db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(e.Bucket))
-
-		buf, err := json.Marshal(value.(*task.TaskEvent))
-		if err != nil {
-			return err
-		}
-
-		err = b.Put([]byte(key), buf)
-		if err != nil {
-			log.Printf("[bolt] unable to save item %s", key)
-			return err
-		}
-		return nil
-	})
-}
-
-func (t *TaskStore) Put(key string, value interface{}) error {
-	return t.Db.Update(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(t.Bucket))
-
-		buf, err := json.Marshal(value.(*task.Task))
-		if err != nil {
-			return err
-		}
-
-		err = b.Put([]byte(key), buf)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
-}
-
-func (i *InMemoryTaskStore) Put(key string, value interface{}) error {
-	t, ok := value.(*task.Task)
-
-	if !ok {
-		return fmt.Errorf("[store] value %v is not a task.Task type", value)
-	}
-
-	i.Db[key] = t
-	return nil
-}
-
-func (i *InMemoryTaskEventStore) Put(key string, value interface{}) error {
-	te, ok := value.(*task.TaskEvent)
-
-	if !ok {
-		return fmt.Errorf("[store] value %v is not a task.TaskEvent type", value)
-	}
-
-	i.Db[key] = te
-	return nil
-}
-
-func (e *EventStore) Get(key string) (interface{}, error) {
-	var event task.TaskEvent
-	err := e.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(e.Bucket))
-		t := b.Get([]byte(key))
-		if t == nil {
-			return fmt.Errorf("[bolt] event %v not found", key)
-		}
-		err := json.Unmarshal(t, &event)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
+// ErrNotFound is wrapped by every store's Get and Delete when the key does
+// not exist, so callers can check for it with errors.Is.
+var ErrNotFound = errors.New("[store] not found")
 
+// Store keeps values of one type by key.
+type Store[T any] interface {
+	Put(key string, value *T) error
+	Get(key string) (*T, error)
+	Delete(key string) error
+	List(q Query[T]) (Page[T], error)
+	Count() (int, error)
+	Close() error
+}
+
+// Query selects and pages through the values of a store. Values are visited
+// in key order; the zero Query returns everything.
+type Query[T any] struct {
+	// Match keeps only the values it returns true for, all if nil
+	Match func(*T) bool
+	// Offset skips that many matching values
+	Offset int
+	// Limit caps the number of values returned, no cap if zero
+	Limit int
+	// Where narrows the values down by indexed column in the stores that
+	// have such columns, like the SQLite stores. The other stores ignore it,
+	// so Match has to select the same values on its own.
+	Where map[string]interface{}
+}
+
+// Page is one page of a List. Total counts every value matching the query,
+// not just the ones on the page.
+type Page[T any] struct {
+	Items  []*T
+	Total  int
+	Offset int
+}
+
+// All returns every value in s.
+func All[T any](s Store[T]) ([]*T, error) {
+	page, err := s.List(Query[T]{})
 	if err != nil {
 		return nil, err
 	}
-	return &event, nil
+	return page.Items, nil
 }
 
-func (t *TaskStore) Get(key string) (interface{}, error) {
-	var task task.Task
-	err := t.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(t.Bucket))
-		t := b.Get([]byte(key))
-		if t == nil {
-			return fmt.Errorf("[bolt] task %v not found", key)
-		}
-		err := json.Unmarshal(t, &task)
-		if err != nil {
-			return err
-		}
-		return nil
-	})
-	if err != nil {
-		return nil, err
-	}
-	return &task, nil
+func notFound(bucket string, key string) error {
+	return fmt.Errorf("%w: %s %s", ErrNotFound, bucket, key)
 }
 
-func (i *InMemoryTaskStore) Get(key string) (interface{}, error) {
-	t, ok := i.Db[key]
-
-	if !ok {
-		return nil, fmt.Errorf("[store] task with key %s does not exist", key)
-	}
-
-	return t, nil
+// pager collects the values of a List in order, applying the query.
+type pager[T any] struct {
+	q    Query[T]
+	page Page[T]
 }
 
-func (i *InMemoryTaskEventStore) Get(key string) (interface{}, error) {
-	te, ok := i.Db[key]
-
-	if !ok {
-		return nil, fmt.Errorf("[store] task with key %s does not exist", key)
+func newPager[T any](q Query[T]) *pager[T] {
+	if q.Offset < 0 {
+		q.Offset = 0
 	}
-
-	return te, nil
+	return &pager[T]{q: q, page: Page[T]{Offset: q.Offset}}
 }
 
-func (e *EventStore) List() (interface{}, error) {
-	var events []*task.TaskEvent
-	err := e.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(e.Bucket))
-		b.ForEach(func(k, v []byte) error {
-			var event task.TaskEvent
-			err := json.Unmarshal(v, &event)
-			if err != nil {
-				return err
-			}
-			events = append(events, &event)
-			return nil
-		})
-		return nil
-	})
-	if err != nil {
-		return nil, err
+func (p *pager[T]) add(v *T) {
+	if p.q.Match != nil && !p.q.Match(v) {
+		return
 	}
 
-	return events, nil
-}
-
-func (t *TaskStore) List() (interface{}, error) {
-	var tasks []*task.Task
-	err := t.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(t.Bucket))
-		b.ForEach(func(k, v []byte) error {
-			var task task.Task
-			err := json.Unmarshal(v, &task)
-			if err != nil {
-				return err
-			}
-			tasks = append(tasks, &task)
-			return nil
-		})
-		return nil
-	})
-	if err != nil {
-		return nil, err
+	p.page.Total++
+	if p.page.Total <= p.q.Offset {
+		return
 	}
-
-	return tasks, nil
-}
-
-func (i *InMemoryTaskStore) List() (interface{}, error) {
-	var tasks []*task.Task
-	for _, t := range i.Db {
-		tasks = append(tasks, t)
-	}
-	return tasks, nil
-}
-
-func (i *InMemoryTaskEventStore) List() (interface{}, error) {
-	var tasks []*task.TaskEvent
-	for _, te := range i.Db {
-		tasks = append(tasks, te)
+	if p.q.Limit > 0 && len(p.page.Items) >= p.q.Limit {
+		return
 	}
-	return tasks, nil
+	p.page.Items = append(p.page.Items, v)
 }
 
-func (e *EventStore) Count() (int, error) {
-	eventCount := 0
-	err := e.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte(e.Bucket))
-		b.ForEach(func(k, v []byte) error {
-			eventCount++
-			return nil
-		})
-		return nil
-	})
+// clone copies v the same way the bolt stores do, through JSON, so callers of
+// the in-memory stores never share a value with the store or each other.
+func clone[T any](v *T) (*T, error) {
+	buf, err := json.Marshal(v)
 	if err != nil {
-		return -1, err
+		return nil, fmt.Errorf("[store] unable to copy value: %v", err)
 	}
 
-	return eventCount, nil
-}
-
-func (t *TaskStore) Count() (int, error) {
-	taskCount := 0
-	err := t.Db.View(func(tx *bolt.Tx) error {
-		b := tx.Bucket([]byte("tasks"))
-		b.ForEach(func(k, v []byte) error {
-			taskCount++
-			return nil
-		})
-		return nil
-	})
+	var c T
+	err = json.Unmarshal(buf, &c)
 	if err != nil {
-		return -1, err
+		return nil, fmt.Errorf("[store] unable to copy value: %v", err)
 	}
-
-	return taskCount, nil
-
-}
-
-func (i *InMemoryTaskStore) Count() (int, error) {
-	return len(i.Db), nil
-}
-
-func (i *InMemoryTaskEventStore) Count() (int, error) {
-	return len(i.Db), nil
-}
-
-func (t *TaskStore) Close() {
-	t.Db.Close()
-}
-
-func (e *EventStore) Close() {
-	e.Db.Close()
-}
-
-func (e *EventStore) CreateBucket() error {
-	return e.Db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucket([]byte(e.Bucket))
-		if err != nil {
-			return fmt.Errorf("[bolt] could not create EventStore bucket %s: %s", e.Bucket, err)
-		}
-		return nil
-	})
-}
-
-func (t *TaskStore) CreateBucket() error {
-	return t.Db.Update(func(tx *bolt.Tx) error {
-		_, err := tx.CreateBucket([]byte(t.Bucket))
-		if err != nil {
-			return fmt.Errorf("[bolt] could not create TaskStore bucket %s: %s", t.Bucket, err)
-		}
-		return nil
-	})
-
+	return &c, nil
 }
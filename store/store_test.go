@@ -0,0 +1,131 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// stores returns a fresh store of each kind that is safe for concurrent use.
+func stores(t *testing.T) map[string]Store[item] {
+	quiet(t)
+
+	bolt, err := NewBoltStore[item](filepath.Join(t.TempDir(), "items.db"), 0600, "items")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := map[string]Store[item]{
+		"memory": NewMemoryStore[item]("items"),
+		"bolt":   bolt,
+	}
+	t.Cleanup(func() {
+		for _, st := range s {
+			st.Close()
+		}
+	})
+	return s
+}
+
+// TestConcurrentAccess puts, gets, lists and deletes from many goroutines at
+// once. Run it with -race.
+func TestConcurrentAccess(t *testing.T) {
+	for name, s := range stores(t) {
+		t.Run(name, func(t *testing.T) {
+			const writers = 8
+			const perWriter = 50
+
+			var wg sync.WaitGroup
+			for w := 0; w < writers; w++ {
+				wg.Add(1)
+				go func(w int) {
+					defer wg.Done()
+					for i := 0; i < perWriter; i++ {
+						key := fmt.Sprintf("w%d-%03d", w, i)
+						err := s.Put(key, &item{Name: key, Group: fmt.Sprint(w), Size: i})
+						if err != nil {
+							t.Errorf("put %s: %v", key, err)
+							return
+						}
+
+						got, err := s.Get(key)
+						if err != nil {
+							t.Errorf("get %s: %v", key, err)
+							return
+						}
+						// a value handed out is the caller's own
+						got.Size = -1
+
+						// every writer also updates one shared key
+						err = s.Put("shared", &item{Name: "shared", Size: w})
+						if err != nil {
+							t.Errorf("put shared: %v", err)
+							return
+						}
+
+						if i%2 == 1 {
+							err = s.Delete(key)
+							if err != nil {
+								t.Errorf("delete %s: %v", key, err)
+								return
+							}
+						}
+					}
+				}(w)
+			}
+
+			for r := 0; r < 4; r++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := 0; i < perWriter; i++ {
+						page, err := s.List(Query[item]{Limit: 10, Match: func(v *item) bool { return v.Size >= 0 }})
+						if err != nil {
+							t.Errorf("list: %v", err)
+							return
+						}
+						if len(page.Items) > 10 {
+							t.Errorf("list returned %d items with a limit of 10", len(page.Items))
+							return
+						}
+						if _, err := s.Count(); err != nil {
+							t.Errorf("count: %v", err)
+							return
+						}
+					}
+				}()
+			}
+			wg.Wait()
+
+			n, err := s.Count()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// half of each writer's keys are left, plus the shared one
+			if want := writers*perWriter/2 + 1; n != want {
+				t.Fatalf("count %d, want %d", n, want)
+			}
+
+			for w := 0; w < writers; w++ {
+				for i := 0; i < perWriter; i++ {
+					key := fmt.Sprintf("w%d-%03d", w, i)
+					got, err := s.Get(key)
+					if i%2 == 1 {
+						if !errors.Is(err, ErrNotFound) {
+							t.Fatalf("deleted %s: %v, want ErrNotFound", key, err)
+						}
+						continue
+					}
+					if err != nil {
+						t.Fatal(err)
+					}
+					if got.Size != i {
+						t.Fatalf("%s has size %d, want %d", key, got.Size, i)
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package task
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
+)
+
+// Labels set on every container a worker creates, so a restarted worker can
+// tell which of the containers Docker runs belong to it and to which task.
+// The task itself is not kept on the container, labels are readable by
+// anyone with access to Docker; it is looked up in the worker's store.
+const (
+	LabelTaskID   = "kanastar.task.id"
+	LabelTaskName = "kanastar.task.name"
+	LabelWorker   = "kanastar.worker"
+	// LabelSpecHash holds SpecHash of the task the container was made for
+	LabelSpecHash = "kanastar.task.spec"
+)
+
+// ContainerLabels returns the labels of the container that runs t on the
+// named worker.
+func ContainerLabels(t *Task, worker string) map[string]string {
+	return map[string]string{
+		LabelTaskID:   t.ID.String(),
+		LabelTaskName: t.Name,
+		LabelWorker:   worker,
+		LabelSpecHash: SpecHash(t),
+	}
+}
+
+// SpecHash returns a digest of what the container of t is made from, so a
+// container can be told apart from one made for an earlier spec of the task.
+func SpecHash(t *Task) string {
+	buf, err := json.Marshal(NewConfig(t))
+	if err != nil {
+		log.Printf("[task] unable to encode the spec of task %v: %v\n", t.ID, err)
+		return ""
+	}
+	sum := sha256.Sum256(buf)
+	return hex.EncodeToString(sum[:])
+}
+
+// ListWorkerContainers returns every container, running or not, labelled
+// as created by the named worker.
+func (d *Docker) ListWorkerContainers(worker string) ([]types.Container, error) {
+	args := filters.NewArgs(filters.Arg("label", fmt.Sprintf("%s=%s", LabelWorker, worker)))
+	containers, err := d.Client.ContainerList(context.Background(), container.ListOptions{All: true, Filters: args})
+	if err != nil {
+		return nil, fmt.Errorf("[task] unable to list containers of worker %s: %v", worker, err)
+	}
+	return containers, nil
+}
+
+// Halt stops a container but keeps it, unlike Stop, so its logs and file
+// system can still be looked at.
+func (d *Docker) Halt(id string) DockerResult {
+	log.Printf("[task] attempting to halt container %v", id)
+
+	err := d.Client.ContainerStop(context.Background(), id, container.StopOptions{})
+	if err != nil {
+		log.Printf("[task] error attempting to halt container %v", id)
+		return DockerResult{Error: err}
+	}
+
+	return DockerResult{Action: "halt", Result: "success"}
+}
@@ -1,5 +1,10 @@
 package task
 
+import (
+	"fmt"
+	"strings"
+)
+
 type State int
 
 const (
@@ -10,6 +15,32 @@ const (
 	Failed
 )
 
+var stateNames = map[State]string{
+	Pending:   "Pending",
+	Scheduled: "Scheduled",
+	Running:   "Running",
+	Completed: "Completed",
+	Failed:    "Failed",
+}
+
+func (s State) String() string {
+	name, ok := stateNames[s]
+	if !ok {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return name
+}
+
+// ParseState returns the state with the given name, ignoring case.
+func ParseState(name string) (State, error) {
+	for s, n := range stateNames {
+		if strings.EqualFold(n, name) {
+			return s, nil
+		}
+	}
+	return 0, fmt.Errorf("[task] unknown state %q", name)
+}
+
 var stateTransitionMap = map[State][]State{
 	Pending:   {Scheduled},
 	Scheduled: {Scheduled, Running, Failed},
@@ -30,3 +61,15 @@ func Contains(states []State, state State) bool {
 func ValidStateTransitions(src State, dst State) bool {
 	return Contains(stateTransitionMap[src], dst)
 }
+
+// desiredTransitionMap lists the changes of intent a user may make to a task.
+// Pending means no intent was recorded yet.
+var desiredTransitionMap = map[State][]State{
+	Pending:   {Running, Completed},
+	Running:   {Completed},
+	Completed: {},
+}
+
+func ValidDesiredTransition(src State, dst State) bool {
+	return Contains(desiredTransitionMap[src], dst)
+}
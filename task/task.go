@@ -5,6 +5,7 @@ import (
 	"io"
 	"log"
 	"os"
+	"regexp"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -21,6 +22,7 @@ type Task struct {
 	ContainerID   string
 	Name          string
 	State         State
+	DesiredState  State
 	Image         string
 	Memory        int64
 	Disk          int64
@@ -33,6 +35,70 @@ type Task struct {
 	FinishTime    time.Time
 	HealthCheck   string
 	RestartCount  int
+	Service       string
+	Revision      int
+	CronJob       string
+	Workflow      string
+	PriorityClass string
+	SubmittedAt   time.Time
+	Labels        map[string]string
+	// namespace the task belongs to, DefaultNamespace if empty
+	Namespace string
+	// name of the worker the task is placed on, empty while unplaced
+	Worker string
+	// set while the task waits for a worker with room for it
+	PendingReason    string
+	ScheduleAttempts int
+	NextScheduleTime time.Time
+	// set once the task is stopped to make room for a higher priority one,
+	// until its worker reports it stopped and it is put back to Pending
+	Preempted bool
+}
+
+const DefaultPriorityClass = "normal"
+
+// PriorityClasses maps the priority class names a task may use to their
+// priority. Higher priorities are scheduled first and may preempt lower ones.
+var PriorityClasses = map[string]int{
+	"low":      100,
+	"normal":   500,
+	"high":     1000,
+	"critical": 2000,
+}
+
+func ValidPriorityClass(class string) bool {
+	if class == "" {
+		return true
+	}
+	_, ok := PriorityClasses[class]
+	return ok
+}
+
+func (t *Task) Priority() int {
+	if p, ok := PriorityClasses[t.PriorityClass]; ok {
+		return p
+	}
+	return PriorityClasses[DefaultPriorityClass]
+}
+
+// DefaultNamespace holds the tasks submitted without a namespace.
+const DefaultNamespace = "default"
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// ValidNamespace reports whether name is a valid namespace: lower case
+// letters, digits and dashes, like a DNS label. Empty stands for the default.
+func ValidNamespace(name string) bool {
+	return name == "" || namespacePattern.MatchString(name)
+}
+
+// NamespaceOrDefault returns the namespace of t, DefaultNamespace for the
+// tasks submitted without one.
+func (t *Task) NamespaceOrDefault() string {
+	if t.Namespace == "" {
+		return DefaultNamespace
+	}
+	return t.Namespace
 }
 
 type TaskEvent struct {
@@ -55,6 +121,8 @@ type Config struct {
 	Disk          int64
 	Env           []string
 	RestartPolicy string
+	// Labels are set on the container, see ContainerLabels
+	Labels map[string]string
 }
 
 type Docker struct {
@@ -68,6 +136,54 @@ type DockerInspectResponse struct {
 	Container *types.ContainerJSON
 }
 
+type ContainerSummary struct {
+	ID           string
+	Name         string
+	Image        string
+	Status       string
+	Running      bool
+	OOMKilled    bool
+	ExitCode     int
+	Error        string
+	StartedAt    string
+	FinishedAt   string
+	RestartCount int
+	Ports        nat.PortMap
+}
+
+func NewContainerSummary(c *types.ContainerJSON) *ContainerSummary {
+	if c == nil || c.ContainerJSONBase == nil {
+		return nil
+	}
+
+	s := ContainerSummary{
+		ID:           c.ID,
+		Name:         c.Name,
+		Image:        c.Image,
+		RestartCount: c.RestartCount,
+	}
+
+	if c.Config != nil {
+		s.Image = c.Config.Image
+	}
+
+	if c.State != nil {
+		s.Status = c.State.Status
+		s.Running = c.State.Running
+		s.OOMKilled = c.State.OOMKilled
+		s.ExitCode = c.State.ExitCode
+		s.Error = c.State.Error
+		s.StartedAt = c.State.StartedAt
+		s.FinishedAt = c.State.FinishedAt
+	}
+
+	if c.NetworkSettings != nil {
+		s.Ports = c.NetworkSettings.Ports
+	}
+
+	return &s
+}
+
 func NewConfig(t *Task) *Config {
 	return &Config{
 		Name:          t.Name,
@@ -154,8 +270,9 @@ func (d *Docker) Run() DockerResult {
 	}
 
 	cc := container.Config{
-		Image: d.Config.Image,
-		Env:   d.Config.Env,
+		Image:  d.Config.Image,
+		Env:    d.Config.Env,
+		Labels: d.Config.Labels,
 	}
 
 	hc := container.HostConfig{
@@ -0,0 +1,43 @@
+package utils
+
+import (
+	"crypto/tls"
+	"net/http"
+)
+
+// HTTP is the client the manager, workers and kanactl talk to each other
+// with, and Scheme the scheme of the URLs they use. Both switch to TLS with
+// UseTLS.
+var (
+	HTTP   = &http.Client{}
+	Scheme = "http"
+)
+
+// UseTLS makes HTTP present the certificate in c and talk https.
+func UseTLS(c *tls.Config) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = c
+	HTTP = &http.Client{Transport: t}
+	Scheme = "https"
+}
+
+// UseToken makes HTTP send token with every request, as kanactl does to
+// authenticate to the manager. Call it after UseTLS.
+func UseToken(token string) {
+	base := HTTP.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	HTTP = &http.Client{Transport: &tokenTransport{base: base, token: token}}
+}
+
+type tokenTransport struct {
+	base  http.RoundTripper
+	token string
+}
+
+func (t *tokenTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(r)
+}
@@ -1,22 +1,43 @@
 package utils
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"time"
 )
 
-func HTTPWithRetry(f func(string) (*http.Response, error), url string) (*http.Response, error) {
-	count := 10
+// RetryAttempts and RetryDelay control HTTPWithRetry.
+var (
+	RetryAttempts = 10
+	RetryDelay    = 5 * time.Second
+)
+
+// HTTPWithRetry GETs url with client, trying again after RetryDelay up to
+// RetryAttempts times. It gives up as soon as ctx is cancelled, including
+// during a request or the delay between two.
+func HTTPWithRetry(ctx context.Context, client *http.Client, url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
 	var resp *http.Response
-	var err error
-	for i := 0; i < count; i++ {
-		resp, err = f(url)
-		if err != nil {
-			fmt.Printf("[retry] error calling url %v\n", url)
-			Sleep("retry", 5)
-		} else {
+	for i := 0; i < RetryAttempts; i++ {
+		resp, err = client.Do(req)
+		if err == nil {
 			break
 		}
+		fmt.Printf("[retry] error calling url %v\n", url)
+		if i == RetryAttempts-1 {
+			break
+		}
+		if !SleepContext(ctx, "retry", RetryDelay) {
+			return nil, ctx.Err()
+		}
+	}
+	if err == nil && resp == nil {
+		err = fmt.Errorf("[retry] no attempts made to call %v", url)
 	}
 	return resp, err
 }
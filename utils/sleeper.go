@@ -1,6 +1,7 @@
 package utils
 
 import (
+	"context"
 	"log"
 	"time"
 )
@@ -9,3 +10,20 @@ func Sleep(origin string, d time.Duration) {
 	log.Printf("[💤][%s] sleeping for %d seconds", origin, d)
 	time.Sleep(d * time.Second)
 }
+
+// SleepContext sleeps for d, unlike Sleep a full duration rather than a
+// number of seconds, and wakes up early when ctx is cancelled. It reports
+// whether the full duration elapsed.
+func SleepContext(ctx context.Context, origin string, d time.Duration) bool {
+	log.Printf("[💤][%s] sleeping for %v", origin, d)
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -1,11 +1,16 @@
 package worker
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"sync"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/surajsharma/kanastar/task"
 )
 
 type ErrResponse struct {
@@ -13,11 +18,21 @@ type ErrResponse struct {
 	Message        string
 }
 
+type TaskDetail struct {
+	Task      *task.Task
+	Container *task.ContainerSummary
+}
+
 type Api struct {
 	Address string
 	Port    int
 	Worker  *Worker
 	Router  *chi.Mux
+	// TLS serves the API over TLS if set
+	TLS    *tls.Config
+	mu     sync.Mutex
+	server *http.Server
+	closed bool
 }
 
 func (a *Api) initRouter() {
@@ -26,17 +41,56 @@ func (a *Api) initRouter() {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTaskHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
+			r.Get("/", a.InspectTaskHandler)
 			r.Delete("/", a.StopTaskHandler)
+			r.Delete("/record", a.PurgeTaskHandler)
 		})
 	})
 
 	a.Router.Route("/stats", func(r chi.Router) {
 		r.Get("/", a.GetStatsHandler)
 	})
+
+	a.Router.Get("/orphans", a.GetOrphansHandler)
 }
 
-func (a *Api) Start() {
+// Start serves the API until Shutdown is called.
+func (a *Api) Start() error {
+	a.mu.Lock()
+	if a.closed {
+		a.mu.Unlock()
+		return nil
+	}
 	a.initRouter()
+	a.server = &http.Server{
+		Addr:      fmt.Sprintf("%s:%d", a.Address, a.Port),
+		Handler:   a.Router,
+		TLSConfig: a.TLS,
+	}
+	a.mu.Unlock()
+
 	log.Printf("[worker][api] started listening at %s:%d", a.Address, a.Port)
-	http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	var err error
+	if a.TLS != nil {
+		err = a.server.ListenAndServeTLS("", "")
+	} else {
+		err = a.server.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting requests and waits for the ones in progress until
+// ctx is done.
+func (a *Api) Shutdown(ctx context.Context) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.closed = true
+	if a.server == nil {
+		return nil
+	}
+	return a.server.Shutdown(ctx)
 }
@@ -2,14 +2,15 @@ package worker
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/store"
 	"github.com/surajsharma/kanastar/task"
-	"github.com/surajsharma/kanastar/utils"
 )
 
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -48,22 +49,19 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	if taskID == "" {
 		log.Printf("[worker][api] no taskID passed in request.\n")
 		w.WriteHeader(http.StatusBadRequest)
+		return
 	}
 
 	tID, _ := uuid.Parse(taskID)
 
 	taskToStop, err := a.Worker.Db.Get(tID.String())
-
 	if err != nil {
-
-		err := fmt.Sprintf("[worker][api] task not found %v", tID)
-		w.Write([]byte(err))
-		defer utils.HandlePanic(err)
-		w.WriteHeader(http.StatusNotFound)
+		writeError(w, lookupStatus(err), fmt.Sprintf("[worker][api] unable to get task %v: %v", tID, err))
+		return
 	}
 
 	// make a copy to not modify the task in datastore
-	taskCopy := *taskToStop.(*task.Task)
+	taskCopy := *taskToStop
 
 	taskCopy.State = task.Completed
 
@@ -73,14 +71,91 @@ func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// PurgeTaskHandler drops the worker's record of a finished task.
+func (a *Api) PurgeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[worker][api] invalid task ID %q", taskID))
+		return
+	}
+
+	err = a.Worker.PurgeTask(tID)
+	if errors.Is(err, ErrTaskActive) {
+		writeError(w, http.StatusConflict, fmt.Sprintf("[worker][api] unable to purge task %v: %v", tID, err))
+		return
+	}
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[worker][api] unable to purge task %v: %v", tID, err))
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(a.Worker.GetTasks())
 }
 
+func (a *Api) InspectTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("[worker][api] invalid task ID %q", taskID))
+		return
+	}
+
+	t, err := a.Worker.Db.Get(tID.String())
+	if err != nil {
+		writeError(w, lookupStatus(err), fmt.Sprintf("[worker][api] unable to get task %v: %v", tID, err))
+		return
+	}
+
+	detail := TaskDetail{Task: t}
+
+	if t.ContainerID != "" {
+		resp := a.Worker.InspectTask(*t)
+		if resp.Error != nil {
+			log.Printf("[worker][api] error inspecting container for task %v: %v", tID, resp.Error)
+		}
+		detail.Container = task.NewContainerSummary(resp.Container)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(detail)
+}
+
 func (a *Api) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(a.Worker.Stats)
+	json.NewEncoder(w).Encode(a.Worker.CurrentStats())
+}
+
+// GetOrphansHandler lists the containers of this worker no task accounts
+// for, as found when the worker started.
+func (a *Api) GetOrphansHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(a.Worker.Orphans())
+}
+
+// lookupStatus is the status to answer a failed lookup with: not found if the
+// key does not exist, an internal error if the store failed.
+func lookupStatus(err error) int {
+	if errors.Is(err, store.ErrNotFound) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+func writeError(w http.ResponseWriter, status int, msg string) {
+	log.Print(msg)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: status, Message: msg})
 }
@@ -0,0 +1,162 @@
+package worker
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/surajsharma/kanastar/stats"
+	"github.com/surajsharma/kanastar/store"
+	"github.com/surajsharma/kanastar/task"
+)
+
+// What Recover does with the orphans it finds.
+const (
+	// OrphanReport leaves orphans alone and only reports them
+	OrphanReport = "report"
+	// OrphanStop stops orphans but keeps their containers
+	OrphanStop = "stop"
+	// OrphanRemove stops and removes orphans
+	OrphanRemove = "remove"
+)
+
+func ValidOrphanPolicy(policy string) bool {
+	return policy == OrphanReport || policy == OrphanStop || policy == OrphanRemove
+}
+
+// Recover brings the task records in line with the containers Docker still
+// has for this worker, so a restarted worker carries on where it stopped. A
+// container is adopted by the task in the worker's store it was started for.
+// Tasks that were being started when the worker stopped, and have no
+// container, are marked Failed so the manager restarts them. The remaining
+// containers, including those of tasks whose record was lost, as it is with
+// the memory store, are orphans: they are handled after OrphanPolicy and
+// reported to the manager with the worker's stats.
+func (w *Worker) Recover() error {
+	d := task.NewDocker(&task.Config{})
+	containers, err := d.ListWorkerContainers(w.Name)
+	if err != nil {
+		return err
+	}
+
+	tasks, err := store.All(w.Db)
+	if err != nil {
+		return fmt.Errorf("[worker] unable to list tasks: %v", err)
+	}
+
+	byID := make(map[string]*task.Task, len(tasks))
+	for _, t := range tasks {
+		byID[t.ID.String()] = t
+	}
+
+	adopted := make(map[string]bool)
+	var orphans []stats.Orphan
+	for _, c := range containers {
+		id := c.Labels[task.LabelTaskID]
+
+		t, known := byID[id]
+		switch {
+		case !known:
+			orphans = append(orphans, w.handleOrphan(d, c, "unknown task"))
+			continue
+		case adopted[id] || !claims(t, c):
+			orphans = append(orphans, w.handleOrphan(d, c, "task runs in another container"))
+			continue
+		case c.Labels[task.LabelSpecHash] != task.SpecHash(t):
+			orphans = append(orphans, w.handleOrphan(d, c, "made for another spec of the task"))
+			continue
+		}
+
+		adopted[id] = true
+		if t.State == task.Completed || t.State == task.Failed {
+			// kept for the record until the manager purges the task
+			continue
+		}
+		if t.ContainerID == c.ID && t.State == task.Running {
+			continue
+		}
+
+		// updateTasks inspects the container next and records how it
+		// exited if it is no longer running
+		t.ContainerID = c.ID
+		t.State = task.Running
+		err := w.Db.Put(id, t)
+		if err != nil {
+			return fmt.Errorf("[worker] unable to adopt container %v for task %v: %v", c.ID, id, err)
+		}
+		log.Printf("[worker] adopted container %v for task %v\n", c.ID, id)
+	}
+
+	for id, t := range byID {
+		if adopted[id] || t.State != task.Scheduled {
+			continue
+		}
+		log.Printf("[worker] task %v was being started when the worker stopped, marking it failed\n", id)
+		t.State = task.Failed
+		t.FinishTime = time.Now().UTC()
+		err := w.Db.Put(id, t)
+		if err != nil {
+			return fmt.Errorf("[worker] unable to update task %v: %v", id, err)
+		}
+	}
+
+	w.mu.Lock()
+	w.orphans = orphans
+	w.mu.Unlock()
+
+	log.Printf("[worker] recovered %d containers, found %d orphans\n", len(adopted), len(orphans))
+	return nil
+}
+
+// claims reports whether c is the container t runs in, or the one it was
+// being started in when the worker stopped.
+func claims(t *task.Task, c types.Container) bool {
+	if t.ContainerID != "" {
+		return t.ContainerID == c.ID
+	}
+	return t.State == task.Scheduled
+}
+
+func (w *Worker) handleOrphan(d *task.Docker, c types.Container, reason string) stats.Orphan {
+	o := stats.Orphan{
+		ContainerID: c.ID,
+		Image:       c.Image,
+		TaskID:      c.Labels[task.LabelTaskID],
+		TaskName:    c.Labels[task.LabelTaskName],
+		State:       c.State,
+		Created:     time.Unix(c.Created, 0).UTC(),
+		Reason:      reason,
+		Action:      "kept",
+	}
+	if len(c.Names) > 0 {
+		o.Name = c.Names[0]
+	}
+
+	var result task.DockerResult
+	switch w.OrphanPolicy {
+	case OrphanStop:
+		if c.State != "running" {
+			break
+		}
+		result = d.Halt(c.ID)
+		o.Action = "stopped"
+	case OrphanRemove:
+		result = d.Stop(c.ID)
+		o.Action = "removed"
+	}
+
+	if result.Error != nil {
+		o.Action = "kept"
+		o.Error = result.Error.Error()
+	}
+	log.Printf("[worker] orphaned container %v of task %q (%s) %s\n", o.ContainerID, o.TaskID, reason, o.Action)
+	return o
+}
+
+// Orphans returns the orphans the last Recover found.
+func (w *Worker) Orphans() []stats.Orphan {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return append([]stats.Orphan{}, w.orphans...)
+}
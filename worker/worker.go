@@ -1,78 +1,137 @@
 package worker
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"log"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/golang-collections/collections/queue"
+	"github.com/google/uuid"
 	"github.com/surajsharma/kanastar/stats"
 	"github.com/surajsharma/kanastar/store"
 	"github.com/surajsharma/kanastar/task"
 	"github.com/surajsharma/kanastar/utils"
 )
 
+const DefaultParallelism = 4
+
+// ErrTaskActive is returned by PurgeTask for a task that has not finished.
+var ErrTaskActive = errors.New("[worker] task has not finished")
+
 type Worker struct {
 	Name      string
 	Queue     queue.Queue
-	Db        store.Store
+	Db        store.Store[task.Task]
 	Stats     *stats.Stats
 	TaskCount int
+	// Parallelism caps how many task starts and stops run at once
+	Parallelism    int
+	RunInterval    time.Duration
+	UpdateInterval time.Duration
+	StatsInterval  time.Duration
+
+	// OrphanPolicy is what Recover does with containers of this worker no
+	// task accounts for
+	OrphanPolicy string
+
+	// mu guards Queue, active, Stats, TaskCount and orphans
+	mu sync.Mutex
+	// tasks with an operation in flight, and the operations queued behind it
+	active  map[uuid.UUID][]task.Task
+	orphans []stats.Orphan
+	ops     sync.WaitGroup
+	wake    chan struct{}
 }
 
-func New(name string, taskDbType string) *Worker {
+// New creates a worker whose task store is of type taskDbType, keeping its
+// file in dataDir.
+func New(name string, taskDbType string, dataDir string) (*Worker, error) {
 	w := Worker{
-		Name:  name,
-		Queue: *queue.New(),
+		Name:           name,
+		Queue:          *queue.New(),
+		Parallelism:    DefaultParallelism,
+		RunInterval:    10 * time.Second,
+		UpdateInterval: 10 * time.Second,
+		StatsInterval:  15 * time.Second,
+		OrphanPolicy:   OrphanReport,
+		active:         make(map[uuid.UUID][]task.Task),
+		wake:           make(chan struct{}, 1),
 	}
 
-	var s store.Store
-	var err error
-
 	switch taskDbType {
 	case "memory":
-		s = store.NewInMemoryTaskStore()
+		w.Db = store.NewMemoryStore[task.Task]("tasks")
 	case "persistent":
-		filename := fmt.Sprintf("%s_tasks.db", name)
-		s, err = store.NewTaskStore(filename, 0600, "tasks")
-	}
-
-	if err != nil {
-		log.Printf("eunable to create new task store: %v", err)
+		filename := filepath.Join(dataDir, fmt.Sprintf("%s_tasks.db", name))
+		s, err := store.NewBoltStore[task.Task](filename, 0600, "tasks")
+		if err != nil {
+			return nil, fmt.Errorf("[worker] unable to create task store: %v", err)
+		}
+		w.Db = s
+	default:
+		return nil, fmt.Errorf("[worker] unknown store type %q, want memory or persistent", taskDbType)
 	}
 
-	w.Db = s
-	return &w
+	return &w, nil
 }
 
 func (w *Worker) GetTasks() []*task.Task {
-	taskList, err := w.Db.List()
+	tasks, err := store.All(w.Db)
 	if err != nil {
 		log.Printf("error getting list of tasks: %v\n", err)
 		return nil
 	}
 
-	return taskList.([]*task.Task)
+	return tasks
 }
 
-func (w *Worker) CollectStats() {
+func (w *Worker) CollectStats(ctx context.Context) {
 	for {
 		log.Println("[worker] collecting stats...")
-		w.Stats = stats.GetStats()
-		w.Stats.TaskCount = w.TaskCount
-		utils.Sleep("worker", 15)
+		s := stats.GetStats()
+
+		w.mu.Lock()
+		s.TaskCount = w.TaskCount
+		for _, o := range w.orphans {
+			if o.Action != "removed" {
+				s.Orphans = append(s.Orphans, o)
+			}
+		}
+		w.Stats = s
+		w.mu.Unlock()
 
+		if !utils.SleepContext(ctx, "worker", w.StatsInterval) {
+			return
+		}
 	}
 }
 
+// CurrentStats returns the stats gathered by the last CollectStats round.
+func (w *Worker) CurrentStats() *stats.Stats {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.Stats
+}
+
 func (w *Worker) StartTask(t task.Task) task.DockerResult {
 
 	t.StartTime = time.Now().UTC()
 
 	config := task.NewConfig(&t)
+	config.Labels = task.ContainerLabels(&t, w.Name)
 	d := task.NewDocker(config)
 
+	if t.ContainerID != "" {
+		// a restart: the previous container still holds the task's name
+		log.Printf("[worker] removing previous container %v for task %v\n", t.ContainerID, t.ID)
+		d.Stop(t.ContainerID)
+		t.ContainerID = ""
+	}
+
 	result := d.Run()
 
 	if result.Error != nil {
@@ -114,19 +173,17 @@ func (w *Worker) StopTask(t task.Task) task.DockerResult {
 }
 
 func (w *Worker) AddTask(t task.Task) {
+	w.mu.Lock()
 	w.Queue.Enqueue(t)
-}
-
-func (w *Worker) runTask() task.DockerResult {
-
-	t := w.Queue.Dequeue()
+	w.mu.Unlock()
 
-	if t == nil {
-		log.Println("[worker] no tasks in queue")
-		return task.DockerResult{Error: nil}
+	select {
+	case w.wake <- struct{}{}:
+	default:
 	}
+}
 
-	taskQueued := t.(task.Task)
+func (w *Worker) runTask(taskQueued task.Task) task.DockerResult {
 	fmt.Printf("[worker] Found task in queue: %v:\n", taskQueued)
 
 	err := w.Db.Put(taskQueued.ID.String(), &taskQueued)
@@ -143,7 +200,7 @@ func (w *Worker) runTask() task.DockerResult {
 		return task.DockerResult{Error: msg}
 	}
 
-	taskPersisted := *result.(*task.Task)
+	taskPersisted := *result
 
 	if taskPersisted.State == task.Completed {
 		return w.StopTask(taskPersisted)
@@ -169,34 +226,150 @@ func (w *Worker) runTask() task.DockerResult {
 	return dockerResult
 }
 
-func (w *Worker) RunTasks() {
+// RunTasks starts and stops queued tasks as soon as they are posted, running
+// up to Parallelism operations at once. Operations for the same task run one
+// after another in the order they were posted, so a stop never races the
+// start it follows. When ctx is cancelled it stops taking new work and
+// returns once the operations in flight have finished.
+func (w *Worker) RunTasks(ctx context.Context) {
+	parallelism := w.Parallelism
+	if parallelism < 1 {
+		parallelism = 1
+	}
+	slots := make(chan struct{}, parallelism)
+
 	for {
-		if w.Queue.Len() != 0 {
-			result := w.runTask()
-			if result.Error != nil {
-				log.Printf("[worker] error running task: %v\n", result.Error)
+		for {
+			t, ok := w.dequeue()
+			if !ok {
+				break
 			}
-		} else {
-			log.Printf("[worker] no tasks to process currently\n")
+			w.runOrQueue(t, slots)
+		}
+
+		select {
+		case <-ctx.Done():
+			log.Println("[worker] stopping, waiting for task operations in flight")
+			w.ops.Wait()
+			return
+		case <-w.wake:
+		case <-time.After(w.RunInterval):
 		}
+	}
+}
+
+func (w *Worker) dequeue() (task.Task, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.Queue.Len() == 0 {
+		return task.Task{}, false
+	}
+	return w.Queue.Dequeue().(task.Task), true
+}
+
+// runOrQueue runs t's operation in its own goroutine, or queues it behind the
+// operation already in flight for the same task.
+func (w *Worker) runOrQueue(t task.Task, slots chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-		utils.Sleep("worker", 10)
+	if backlog, busy := w.active[t.ID]; busy {
+		w.active[t.ID] = append(backlog, t)
+		return
+	}
+
+	w.active[t.ID] = nil
+	w.ops.Add(1)
+	go w.runOps(t, slots)
+}
+
+func (w *Worker) runOps(t task.Task, slots chan struct{}) {
+	defer w.ops.Done()
 
+	for {
+		slots <- struct{}{}
+		result := w.runTask(t)
+		<-slots
+
+		if result.Error != nil {
+			log.Printf("[worker] error running task: %v\n", result.Error)
+		}
+
+		w.mu.Lock()
+		backlog := w.active[t.ID]
+		if len(backlog) == 0 {
+			delete(w.active, t.ID)
+			w.mu.Unlock()
+			return
+		}
+		t = backlog[0]
+		w.active[t.ID] = backlog[1:]
+		w.mu.Unlock()
 	}
 }
 
+func (w *Worker) busy(id uuid.UUID) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	_, ok := w.active[id]
+	return ok
+}
+
+// PurgeTask drops the record of a finished task, and the container it left
+// behind if any. The manager calls it once it has recorded the final state.
+func (w *Worker) PurgeTask(id uuid.UUID) error {
+	t, err := w.Db.Get(id.String())
+	if err != nil {
+		return err
+	}
+
+	if (t.State != task.Completed && t.State != task.Failed) || w.busy(id) {
+		return fmt.Errorf("%w: task %v is %v", ErrTaskActive, id, t.State)
+	}
+
+	if t.ContainerID != "" {
+		d := task.NewDocker(task.NewConfig(t))
+		result := d.Stop(t.ContainerID)
+		if result.Error != nil {
+			log.Printf("[worker] error removing container %v of task %v: %v\n", t.ContainerID, id, result.Error)
+		}
+	}
+
+	err = w.Db.Delete(id.String())
+	if err != nil {
+		return err
+	}
+
+	log.Printf("[worker] purged record of task %v\n", id)
+	return nil
+}
+
 func (w *Worker) InspectTask(t task.Task) task.DockerInspectResponse {
 	config := task.NewConfig(&t)
 	d := task.NewDocker(config)
 	return d.Inspect(t.ContainerID)
 }
 
-func (w *Worker) UpdateTasks() {
+func (w *Worker) UpdateTasks(ctx context.Context) {
 	for {
 		log.Println("[worker] checking status of tasks")
 		w.updateTasks()
 		log.Println("[worker] tasks update completed")
-		utils.Sleep("worker", 10)
+		if !utils.SleepContext(ctx, "worker", w.UpdateInterval) {
+			return
+		}
+	}
+}
+
+// Close closes the worker's task store. Call it once the loops have returned.
+func (w *Worker) Close() {
+	if w.Db == nil {
+		return
+	}
+	err := w.Db.Close()
+	if err != nil {
+		log.Printf("[worker] error closing task store: %v\n", err)
 	}
 }
 
@@ -205,14 +378,21 @@ func (w *Worker) updateTasks() {
 	// for each task in the worker's datastore:
 	// 1. call InspectTask method
 	// 2. verify task is in running state
-	// 3. if task is not in running state, or not running at all, mark task as `failed`
-	tasks, err := w.Db.List()
+	// 3. if task is not in running state, or not running at all, mark task as `failed`,
+	//    unless its container exited cleanly, in which case it is `completed`
+	tasks, err := store.All(w.Db)
 	if err != nil {
 		log.Printf("[worker] error getting list of tasks: %v\n", err)
 		return
 	}
-	for _, t := range tasks.([]*task.Task) {
+	for _, t := range tasks {
+		if w.busy(t.ID) {
+			// being started or stopped right now, check it next time
+			continue
+		}
+
 		if t.State == task.Running {
+			seen := *t
 			resp := w.InspectTask(*t)
 			if resp.Error != nil {
 				fmt.Printf("[worker] error inspecting task %v\n", resp.Error)
@@ -221,18 +401,52 @@ func (w *Worker) updateTasks() {
 			if resp.Container == nil {
 				log.Printf("[worker] no container for running task %s\n", t.ID)
 				t.State = task.Failed
-				w.Db.Put(t.ID.String(), t)
+				w.record(t, seen)
+				continue
 			}
 
 			if resp.Container.State.Status == "exited" {
-				log.Printf("[worker] container for task %s in non-running state %s\n", t.ID, resp.Container.State.Status)
-				t.State = task.Failed
-				w.Db.Put(t.ID.String(), t)
+				log.Printf("[worker] container for task %s in non-running state %s (exit code %d)\n", t.ID, resp.Container.State.Status, resp.Container.State.ExitCode)
+				if resp.Container.State.ExitCode == 0 {
+					t.State = task.Completed
+				} else {
+					t.State = task.Failed
+				}
+				t.FinishTime = time.Now().UTC()
+				w.record(t, seen)
+				continue
 			}
 
 			// task is running, update exposed ports
 			t.HostPorts = resp.Container.NetworkSettings.NetworkSettingsBase.Ports
-			w.Db.Put(t.ID.String(), t)
+			w.record(t, seen)
 		}
 	}
 }
+
+// record stores what updateTasks found out about t, unless the task was
+// started, stopped or purged since seen was read from the store: an
+// operation in flight, or a record that changed, wins over the inspection.
+func (w *Worker) record(t *task.Task, seen task.Task) {
+	// operations only begin once they are marked active under w.mu, so
+	// none can start between the checks and the put
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if _, busy := w.active[t.ID]; busy {
+		return
+	}
+
+	current, err := w.Db.Get(t.ID.String())
+	if err != nil {
+		return
+	}
+	if current.State != seen.State || current.ContainerID != seen.ContainerID {
+		return
+	}
+
+	err = w.Db.Put(t.ID.String(), t)
+	if err != nil {
+		log.Printf("[worker] error storing task %v: %v\n", t.ID, err)
+	}
+}
@@ -0,0 +1,272 @@
+package workflow
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surajsharma/kanastar/task"
+)
+
+const (
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+
+	StepPending   = "pending"
+	StepRunning   = "running"
+	StepSucceeded = "succeeded"
+	StepFailed    = "failed"
+	StepSkipped   = "skipped"
+
+	runHistoryLimit = 10
+)
+
+// Workflow is a set of steps, each a task template, that run once all the
+// steps they depend on have completed.
+type Workflow struct {
+	ID        uuid.UUID
+	Name      string
+	Steps     []Step
+	Runs      []*Run
+	CreatedAt time.Time
+}
+
+// Step is one node of the workflow DAG. A failed step is retried up to
+// Retries times with a fresh task before it fails the run.
+type Step struct {
+	Name      string
+	DependsOn []string
+	Retries   int
+	Task      task.Task
+}
+
+type Run struct {
+	ID         uuid.UUID
+	Workflow   string
+	State      string
+	Steps      []StepRun
+	StartTime  time.Time
+	FinishTime time.Time
+}
+
+type StepRun struct {
+	Name       string
+	State      string
+	TaskID     uuid.UUID
+	Attempts   int
+	Message    string
+	StartTime  time.Time
+	FinishTime time.Time
+}
+
+// Validate checks that step names are unique, every dependency exists and
+// the dependencies do not form a cycle.
+func (w *Workflow) Validate() error {
+	if w.Name == "" {
+		return errors.New("[workflow] name is required")
+	}
+
+	if len(w.Steps) == 0 {
+		return errors.New("[workflow] at least one step is required")
+	}
+
+	steps := make(map[string]*Step)
+	for i := range w.Steps {
+		s := &w.Steps[i]
+		if s.Name == "" {
+			return errors.New("[workflow] every step needs a name")
+		}
+		if _, ok := steps[s.Name]; ok {
+			return fmt.Errorf("[workflow] duplicate step %q", s.Name)
+		}
+		if s.Task.Image == "" {
+			return fmt.Errorf("[workflow] step %q needs a task image", s.Name)
+		}
+		if s.Retries < 0 {
+			return fmt.Errorf("[workflow] step %q retries must not be negative", s.Name)
+		}
+		steps[s.Name] = s
+	}
+
+	for _, s := range w.Steps {
+		for _, dep := range s.DependsOn {
+			if _, ok := steps[dep]; !ok {
+				return fmt.Errorf("[workflow] step %q depends on unknown step %q", s.Name, dep)
+			}
+		}
+	}
+
+	_, err := w.order()
+	return err
+}
+
+// order returns the step indexes sorted so every step comes after the steps
+// it depends on.
+func (w *Workflow) order() ([]int, error) {
+	index := make(map[string]int)
+	for i, s := range w.Steps {
+		index[s.Name] = i
+	}
+
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+
+	marks := make([]int, len(w.Steps))
+	var sorted []int
+
+	var visit func(i int) error
+	visit = func(i int) error {
+		switch marks[i] {
+		case visiting:
+			return fmt.Errorf("[workflow] dependency cycle through step %q", w.Steps[i].Name)
+		case done:
+			return nil
+		}
+
+		marks[i] = visiting
+		for _, dep := range w.Steps[i].DependsOn {
+			err := visit(index[dep])
+			if err != nil {
+				return err
+			}
+		}
+		marks[i] = done
+		sorted = append(sorted, i)
+		return nil
+	}
+
+	for i := range w.Steps {
+		err := visit(i)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return sorted, nil
+}
+
+func (w *Workflow) NewRun() *Run {
+	r := Run{
+		ID:        uuid.New(),
+		Workflow:  w.Name,
+		State:     RunRunning,
+		StartTime: time.Now().UTC(),
+	}
+
+	for _, s := range w.Steps {
+		r.Steps = append(r.Steps, StepRun{Name: s.Name, State: StepPending})
+	}
+
+	w.Runs = append(w.Runs, &r)
+	if len(w.Runs) > runHistoryLimit {
+		w.Runs = w.Runs[len(w.Runs)-runHistoryLimit:]
+	}
+
+	return &r
+}
+
+func (w *Workflow) GetRun(id uuid.UUID) (*Run, error) {
+	for _, r := range w.Runs {
+		if r.ID == id {
+			return r, nil
+		}
+	}
+	return nil, fmt.Errorf("[workflow] run %v of %s not found", id, w.Name)
+}
+
+func (w *Workflow) LatestRun() (*Run, error) {
+	if len(w.Runs) == 0 {
+		return nil, fmt.Errorf("[workflow] %s has not been run", w.Name)
+	}
+	return w.Runs[len(w.Runs)-1], nil
+}
+
+// StepTask creates the task for one attempt of a step.
+func (w *Workflow) StepTask(r *Run, s *Step) task.Task {
+	t := s.Task
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%s-%s", w.Name, s.Name, t.ID.String()[:8])
+	t.Workflow = w.Name
+	t.State = task.Pending
+	t.ContainerID = ""
+	t.HostPorts = nil
+	t.RestartCount = 0
+	t.StartTime = time.Time{}
+	t.FinishTime = time.Time{}
+	return t
+}
+
+// Ready returns the steps, in dependency order, whose state may change now:
+// pending steps whose dependencies have all finished, and running steps. It
+// also marks pending steps behind a failed or skipped dependency as skipped.
+func (w *Workflow) Ready(r *Run) ([]int, error) {
+	sorted, err := w.order()
+	if err != nil {
+		return nil, err
+	}
+
+	state := make(map[string]*StepRun)
+	for i := range r.Steps {
+		state[r.Steps[i].Name] = &r.Steps[i]
+	}
+
+	var ready []int
+	for _, i := range sorted {
+		s := &w.Steps[i]
+		sr := state[s.Name]
+
+		if sr.State == StepRunning {
+			ready = append(ready, i)
+			continue
+		}
+
+		if sr.State != StepPending {
+			continue
+		}
+
+		runnable := true
+		for _, dep := range s.DependsOn {
+			switch state[dep].State {
+			case StepFailed, StepSkipped:
+				sr.State = StepSkipped
+				sr.Message = fmt.Sprintf("dependency %q did not succeed", dep)
+				sr.FinishTime = time.Now().UTC()
+			case StepSucceeded:
+				continue
+			}
+			runnable = false
+			break
+		}
+
+		if runnable {
+			ready = append(ready, i)
+		}
+	}
+
+	return ready, nil
+}
+
+// Finish sets the final state of a run once none of its steps can change.
+func (r *Run) Finish() bool {
+	succeeded := true
+	for _, s := range r.Steps {
+		switch s.State {
+		case StepPending, StepRunning:
+			return false
+		case StepFailed, StepSkipped:
+			succeeded = false
+		}
+	}
+
+	r.State = RunFailed
+	if succeeded {
+		r.State = RunSucceeded
+	}
+	r.FinishTime = time.Now().UTC()
+	return true
+}